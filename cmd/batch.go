@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	sysos "os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/linuxsuren/http-downloader/pkg/common"
+	"github.com/linuxsuren/http-downloader/pkg/log"
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/spf13/cobra"
+)
+
+// batchItem is a line of the input file
+type batchItem struct {
+	URL      string
+	Output   string
+	Checksum string
+	Header   map[string]string
+}
+
+// batchResult is the result of a batchItem
+type batchResult struct {
+	item   batchItem
+	output string
+	status string
+	err    error
+}
+
+const (
+	batchSucceeded = "ok"
+	batchFailed    = "failed"
+	batchSkipped   = "skipped"
+)
+
+// parseBatchList parses the download list. Each line holds a URL with the optional fields:
+//
+//	https://foo.com/bar.tar.gz out=bar.tar.gz checksum=sha256:<hex> header="Authorization: Bearer token"
+//
+// the output must be a relative path in the output directory, the empty lines and the lines start with "#" are ignored.
+// The URL could be an oci:// artifact or an s3:// object as well. Two lines cannot have the same output.
+func parseBatchList(reader io.Reader) (items []batchItem, err error) {
+	outputs := map[string]int{}
+	scanner := bufio.NewScanner(reader)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var item batchItem
+		if item, err = parseBatchItem(line); err != nil {
+			err = fmt.Errorf("invalid line %d, %v", lineNum, err)
+			return
+		}
+		if output := batchItemOutput(item); output != "" {
+			if previous, ok := outputs[output]; ok {
+				err = fmt.Errorf("line %d and line %d have the same output '%s', please set another one via out=<name>",
+					previous, lineNum, output)
+				return
+			}
+			outputs[output] = lineNum
+		}
+		items = append(items, item)
+	}
+	err = scanner.Err()
+	return
+}
+
+func parseBatchItem(line string) (item batchItem, err error) {
+	var fields []string
+	if fields, err = splitFields(line); err != nil {
+		return
+	}
+
+	item.URL = fields[0]
+	if !net.IsSupportedURL(item.URL) && !net.IsOCIReference(item.URL) && !net.IsS3URL(item.URL) {
+		err = fmt.Errorf("not supported URL: %s", item.URL)
+		return
+	}
+
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			err = fmt.Errorf("the field '%s' should be like key=value", field)
+			return
+		}
+
+		switch key {
+		case "out":
+			if err = validateOutput(value); err != nil {
+				return
+			}
+			item.Output = value
+		case "checksum":
+			if _, err = net.ParseChecksum(value); err != nil {
+				return
+			}
+			item.Checksum = value
+		case "header":
+			var name, headerValue string
+			if name, headerValue, err = parseHeader(value); err != nil {
+				return
+			}
+			if item.Header == nil {
+				item.Header = map[string]string{}
+			}
+			item.Header[name] = headerValue
+		default:
+			err = fmt.Errorf("unknown field '%s'", key)
+			return
+		}
+	}
+	return
+}
+
+// batchItemOutput returns the output of the item, it's empty if it's unknown before resolving the oci:// artifact
+func batchItemOutput(item batchItem) (output string) {
+	switch {
+	case item.Output != "":
+		output = item.Output
+	case net.IsOCIReference(item.URL):
+	case net.IsS3URL(item.URL):
+		if object, err := net.ParseS3URL(item.URL); err == nil {
+			output = path.Base(object.Key)
+		}
+	default:
+		if urlObj, err := url.Parse(item.URL); err == nil {
+			output = path.Base(urlObj.Path)
+		}
+	}
+	if output = path.Clean(filepath.ToSlash(output)); output == "." || output == "/" || output == ".." {
+		output = ""
+	}
+	return
+}
+
+// validateOutput makes sure the output is a relative path in the output directory
+func validateOutput(output string) error {
+	if output == "" || filepath.IsAbs(output) || path.IsAbs(output) || strings.HasPrefix(output, "\\") {
+		return fmt.Errorf("the output '%s' should be a relative path", output)
+	}
+	for _, item := range strings.FieldsFunc(output, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if item == ".." {
+			return fmt.Errorf("the output '%s' should not be out of the output directory", output)
+		}
+	}
+	return nil
+}
+
+// splitFields splits the line by the whitespaces, the double quoted text is taken as one field
+func splitFields(line string) (fields []string, err error) {
+	var field strings.Builder
+	var quoted, hasField bool
+	for _, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			hasField = true
+		case !quoted && (c == ' ' || c == '\t'):
+			if hasField {
+				fields = append(fields, field.String())
+				field.Reset()
+				hasField = false
+			}
+		default:
+			field.WriteRune(c)
+			hasField = true
+		}
+	}
+
+	if quoted {
+		err = fmt.Errorf("unclosed quote in: %s", line)
+	} else if hasField {
+		fields = append(fields, field.String())
+	}
+	return
+}
+
+func (o *downloadOption) preRunBatch(cmd *cobra.Command, args []string) (err error) {
+	if len(args) > 0 {
+		return fmt.Errorf("the URL arguments cannot be used with --input-file")
+	}
+	if o.Output != "" {
+		return fmt.Errorf("--output cannot be used with --input-file, please use --output-dir instead")
+	}
+	if o.Parallel <= 0 {
+		return fmt.Errorf("--parallel should be bigger than zero")
+	}
+
+	var reader io.Reader
+	if o.InputFile == "-" {
+		reader = cmd.InOrStdin()
+	} else {
+		var f *sysos.File
+		if f, err = sysos.Open(o.InputFile); err != nil {
+			return
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		reader = f
+	}
+
+	if o.batchItems, err = parseBatchList(reader); err != nil {
+		return
+	}
+	if len(o.batchItems) == 0 {
+		return fmt.Errorf("no URL found in %s", o.InputFile)
+	}
+
+	if err = o.setupRateLimiter(); err != nil {
+		return
+	}
+	if err = o.setupHeader(); err != nil {
+		return
+	}
+	if err = o.setupCredentials(); err != nil {
+		return
+	}
+	if err = o.setupTLSConfig(); err != nil {
+		return
+	}
+	if err = o.setupProgress(); err == nil && o.OutputDir != "" {
+		err = sysos.MkdirAll(o.OutputDir, 0755)
+	}
+	return
+}
+
+// runBatch downloads the items in parallel, then prints the summary
+func (o *downloadOption) runBatch(cmd *cobra.Command) (err error) {
+	logger := log.GetLoggerFromContextOrDefault(cmd)
+	var requireGitHub bool
+	for _, item := range o.batchItems {
+		requireGitHub = requireGitHub || net.IsGitHubURL(item.URL)
+	}
+	o.resolveGitHubProxy(cmd.Context(), logger, requireGitHub)
+
+	results := make([]batchResult, len(o.batchItems))
+	semaphore := make(chan struct{}, o.Parallel)
+	wg := sync.WaitGroup{}
+	for i := range o.batchItems {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			results[i] = o.downloadBatchItem(cmd.Context(), logger, o.batchItems[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var failed, skipped int
+	writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "STATUS\tURL\tOUTPUT\tERROR")
+	for _, result := range results {
+		var errMsg string
+		switch result.status {
+		case batchFailed:
+			failed++
+			errMsg = result.err.Error()
+		case batchSkipped:
+			skipped++
+		}
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", result.status, result.item.URL, result.output, errMsg)
+	}
+	if err = writer.Flush(); err != nil {
+		return
+	}
+	cmd.Printf("%d succeeded, %d failed, %d skipped\n", len(results)-failed-skipped, failed, skipped)
+
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d downloads failed", failed, len(results))
+	}
+	return
+}
+
+func (o *downloadOption) downloadBatchItem(ctx context.Context, logger *log.LevelLog, item batchItem) (result batchResult) {
+	result.item = item
+	result.status = batchFailed
+
+	// each item has its own option, the rate limiter, cookie jar and credentials are shared
+	opt := *o
+	opt.URL = item.URL
+	opt.Checksum = item.Checksum
+	if len(item.Header) > 0 {
+		// the headers of the item take precedence over the global ones
+		opt.hostHeader = make(map[string]string, len(o.hostHeader)+len(item.Header))
+		for k, v := range o.hostHeader {
+			opt.hostHeader[k] = v
+		}
+		for k, v := range item.Header {
+			opt.hostHeader[k] = v
+		}
+	}
+	opt.Mirrors = nil
+	opt.ContinueAt = -1
+
+	// the output is taken from the oci:// artifact or the s3:// object if it's empty
+	opt.Output = item.Output
+	switch {
+	case net.IsOCIReference(item.URL):
+		opt.URL, result.err = opt.resolveOCIBlob(ctx, logger, item.URL)
+	case net.IsS3URL(item.URL):
+		opt.URL, result.err = opt.resolveS3Object(item.URL)
+	}
+	if result.err != nil {
+		return
+	}
+
+	if opt.Output == "" {
+		urlObj, err := url.Parse(opt.URL)
+		if err != nil {
+			result.err = fmt.Errorf("cannot parse the target URL, error: '%v'", err)
+			return
+		}
+		if opt.Output = path.Base(urlObj.Path); opt.Output == "/" || opt.Output == "." || opt.Output == ".." {
+			result.err = fmt.Errorf("cannot get the output name from the URL, please set it via out=<name>")
+			return
+		}
+	}
+	if o.OutputDir != "" {
+		opt.Output = filepath.Join(o.OutputDir, opt.Output)
+	}
+	result.output = opt.Output
+
+	if common.Exist(opt.Output) && !opt.Force {
+		result.status = batchSkipped
+		return
+	}
+
+	if result.err = sysos.MkdirAll(filepath.Dir(opt.Output), 0755); result.err != nil {
+		return
+	}
+	if _, result.err = opt.download(ctx, logger); result.err == nil {
+		result.status = batchSucceeded
+	}
+	return
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBatchList(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect []batchItem
+		hasErr bool
+	}{{
+		name:  "empty lines and comments",
+		input: "\n# comment\n  \n",
+	}, {
+		name: "all fields",
+		input: `https://foo.com/a.tar.gz
+https://foo.com/b.tar.gz out=bar/b.tgz checksum=sha256:c31b829ca8935a8054312faaf42a5392756e65abfa94b91d41c306409542ef98 header="Authorization: Bearer token"`,
+		expect: []batchItem{{
+			URL: "https://foo.com/a.tar.gz",
+		}, {
+			URL:      "https://foo.com/b.tar.gz",
+			Output:   "bar/b.tgz",
+			Checksum: "sha256:c31b829ca8935a8054312faaf42a5392756e65abfa94b91d41c306409542ef98",
+			Header:   map[string]string{"Authorization": "Bearer token"},
+		}},
+	}, {
+		name:   "registered scheme",
+		input:  "ftp://foo.com/a.tar.gz out=a.tgz",
+		expect: []batchItem{{URL: "ftp://foo.com/a.tar.gz", Output: "a.tgz"}},
+	}, {
+		name: "oci artifact and s3 object",
+		input: `oci://ghcr.io/foo/bar:v1
+s3://releases/v1/tool.tar.gz`,
+		expect: []batchItem{{URL: "oci://ghcr.io/foo/bar:v1"}, {URL: "s3://releases/v1/tool.tar.gz"}},
+	}, {
+		name:   "not a HTTP URL",
+		input:  "foo/bar",
+		hasErr: true,
+	}, {
+		name:   "unknown field",
+		input:  "https://foo.com/a.tar.gz name=a",
+		hasErr: true,
+	}, {
+		name:   "invalid checksum",
+		input:  "https://foo.com/a.tar.gz checksum=invalid",
+		hasErr: true,
+	}, {
+		name:   "invalid header",
+		input:  `https://foo.com/a.tar.gz header=invalid`,
+		hasErr: true,
+	}, {
+		name:   "output out of the directory",
+		input:  "https://foo.com/a.tar.gz out=../../.bashrc",
+		hasErr: true,
+	}, {
+		name:   "absolute output",
+		input:  "https://foo.com/a.tar.gz out=/etc/profile",
+		hasErr: true,
+	}, {
+		name:   "empty output",
+		input:  "https://foo.com/a.tar.gz out=",
+		hasErr: true,
+	}, {
+		name:   "unclosed quote",
+		input:  `https://foo.com/a.tar.gz header="Authorization: Bearer`,
+		hasErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := parseBatchList(strings.NewReader(tt.input))
+			if tt.hasErr {
+				assert.ErrorContains(t, err, "invalid line 1")
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expect, items)
+			}
+		})
+	}
+}
+
+func TestParseBatchListWithSameOutput(t *testing.T) {
+	_, err := parseBatchList(strings.NewReader(`https://foo.com/v1/a.tar.gz
+https://foo.com/b.tar.gz
+https://bar.com/v2/a.tar.gz`))
+	assert.EqualError(t, err, "line 1 and line 3 have the same output 'a.tar.gz', please set another one via out=<name>")
+
+	_, err = parseBatchList(strings.NewReader(`https://foo.com/a.tar.gz out=sub/a.tgz
+s3://releases/v1/a.tgz out=sub//a.tgz`))
+	assert.EqualError(t, err, "line 1 and line 2 have the same output 'sub/a.tgz', please set another one via out=<name>")
+
+	// the output of the oci:// artifact is unknown before resolving it
+	items, err := parseBatchList(strings.NewReader(`https://foo.com/v1/a.tar.gz out=v1/a.tar.gz
+https://foo.com/v2/a.tar.gz out=v2/a.tar.gz
+oci://ghcr.io/foo/bar:v1
+oci://ghcr.io/foo/bar:v2`))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(items))
+}
+
+func TestBatchDownloadS3Object(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/releases/v1/tool.tar.gz" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio-key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", path.Join(dir, "credentials"))
+	t.Setenv("AWS_CONFIG_FILE", path.Join(dir, "config"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "minio-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "minio-secret")
+
+	cmd := newGetCmd(context.Background())
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetIn(strings.NewReader("s3://releases/v1/tool.tar.gz\n"))
+	cmd.SetArgs([]string{"-i", "-", "--output-dir", dir, "--s3-endpoint", server.URL,
+		"--max-attempts", "0", "--no-cache", "--show-progress=false"})
+	assert.Nil(t, cmd.Execute())
+	assert.Contains(t, buf.String(), "1 succeeded, 0 failed, 0 skipped")
+
+	data, err := os.ReadFile(path.Join(dir, "tool.tar.gz"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestSplitFields(t *testing.T) {
+	fields, err := splitFields(` a  "b c"	d="e f" "" `)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b c", "d=e f", ""}, fields)
+}
+
+func TestBatchDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/private" && r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(path.Join(dir, "exist"), []byte("exist"), 0600))
+	input := fmt.Sprintf(`%[1]s/public
+%[1]s/private out=sub/private header="Authorization: Bearer token"
+%[1]s/missing
+%[1]s/exist
+`, server.URL)
+
+	cmd := newGetCmd(context.Background())
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetIn(strings.NewReader(input))
+	cmd.SetArgs([]string{"-i", "-", "--output-dir", dir, "--parallel", "2",
+		"--max-attempts", "0", "--no-cache", "--show-progress=false"})
+	err := cmd.Execute()
+	assert.NotNil(t, err)
+
+	output := buf.String()
+	assert.Contains(t, output, "2 succeeded, 1 failed, 1 skipped")
+	for _, name := range []string{"public", path.Join("sub", "private")} {
+		data, readErr := os.ReadFile(path.Join(dir, name))
+		assert.Nil(t, readErr)
+		assert.Equal(t, "hello", string(data))
+	}
+	assert.NoFileExists(t, path.Join(dir, "missing"))
+
+	// the URL arguments cannot be used with the input file
+	cmd = newGetCmd(context.Background())
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	cmd.SetArgs([]string{"-i", "-", "https://foo.com/a.tar.gz"})
+	assert.NotNil(t, cmd.Execute())
+}
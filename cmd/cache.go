@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newCacheCmd() (cmd *cobra.Command) {
+	opt := &cacheOption{}
+	cmd = &cobra.Command{
+		Use:     "cache",
+		Short:   "Manage the cache of the downloaded files",
+		GroupID: configGroup.ID,
+	}
+	dir := viper.GetString("cache")
+	if dir == "" {
+		dir = net.DefaultCacheDir()
+	}
+	cmd.PersistentFlags().StringVarP(&opt.dir, "dir", "", dir,
+		"The directory of the cache, it's the one of the config or $XDG_CACHE_HOME/hd by default")
+
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the cached files",
+		RunE:    opt.runList,
+	}
+
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove the cached files which exceed the size or age limit",
+		Example: `hd cache prune --max-size 1G
+hd cache prune --max-age 720h`,
+		PreRunE: opt.preRunPrune,
+		RunE:    opt.runPrune,
+	}
+	pruneCmd.Flags().StringVarP(&opt.maxSize, "max-size", "", "",
+		"Remove the least recently used files until the total size is not bigger than it, for instance: 500M, 2G")
+	pruneCmd.Flags().DurationVarP(&opt.maxAge, "max-age", "", 0,
+		"Remove the files which were not used in this duration")
+
+	cleanCmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove all the cached files",
+		RunE:  opt.runClean,
+	}
+
+	cmd.AddCommand(listCmd, pruneCmd, cleanCmd)
+	return
+}
+
+type cacheOption struct {
+	dir     string
+	maxSize string
+	maxAge  time.Duration
+
+	// inner fields
+	maxSizeBytes int64
+}
+
+func (o *cacheOption) runList(cmd *cobra.Command, _ []string) (err error) {
+	var entries []*net.CacheEntry
+	if entries, err = net.NewCache(o.dir).List(); err != nil {
+		return
+	}
+
+	var total int64
+	writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "URL\tSIZE\tLAST USED")
+	for _, entry := range entries {
+		total += entry.Size
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\n", entry.URL, net.FormatSize(entry.Size),
+			entry.LastUsedAt.Format(time.RFC3339))
+	}
+	err = writer.Flush()
+	cmd.Printf("%d files, %s in total\n", len(entries), net.FormatSize(total))
+	return
+}
+
+func (o *cacheOption) preRunPrune(_ *cobra.Command, _ []string) (err error) {
+	if o.maxSizeBytes, err = net.ParseSize(o.maxSize); err == nil && o.maxSizeBytes <= 0 && o.maxAge <= 0 {
+		err = fmt.Errorf("--max-size or --max-age is required")
+	}
+	return
+}
+
+func (o *cacheOption) runPrune(cmd *cobra.Command, _ []string) (err error) {
+	var removed []*net.CacheEntry
+	if removed, err = net.NewCache(o.dir).Prune(o.maxSizeBytes, o.maxAge); err == nil {
+		for _, entry := range removed {
+			cmd.Println("removed", entry.URL)
+		}
+		cmd.Printf("%d files were removed\n", len(removed))
+	}
+	return
+}
+
+func (o *cacheOption) runClean(cmd *cobra.Command, _ []string) (err error) {
+	if err = net.NewCache(o.dir).Clean(); err == nil {
+		cmd.Println("removed the cache directory", o.dir)
+	}
+	return
+}
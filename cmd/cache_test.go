@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheCmd(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := path.Join(dir, "cache")
+	file := path.Join(dir, "hello")
+	assert.Nil(t, os.WriteFile(file, []byte("hello"), 0600))
+	_, err := net.NewCache(cacheDir).Put("https://foo.com/hello", `"v1"`, "", file)
+	assert.Nil(t, err)
+
+	run := func(args ...string) (string, error) {
+		cmd := newCacheCmd()
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetArgs(append(args, "--dir", cacheDir))
+		err := cmd.Execute()
+		return buf.String(), err
+	}
+
+	output, err := run("list")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "https://foo.com/hello")
+	assert.Contains(t, output, "1 files, 5B in total")
+
+	_, err = run("prune")
+	assert.NotNil(t, err)
+	_, err = run("prune", "--max-size", "invalid")
+	assert.NotNil(t, err)
+
+	output, err = run("prune", "--max-size", "1K")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "0 files were removed")
+
+	output, err = run("prune", "--max-size", "1")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "removed https://foo.com/hello")
+
+	_, err = run("clean")
+	assert.Nil(t, err)
+	assert.NoDirExists(t, cacheDir)
+}
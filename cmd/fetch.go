@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"os"
 	"strings"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/linuxsuren/http-downloader/pkg"
 	"github.com/linuxsuren/http-downloader/pkg/log"
+	"github.com/linuxsuren/http-downloader/pkg/net"
 
 	"github.com/linuxsuren/http-downloader/pkg/installer"
 	"github.com/spf13/cobra"
@@ -62,6 +64,18 @@ func (o *fetchOption) preRunE(c *cobra.Command, _ []string) (err error) {
 func (o *fetchOption) runE(c *cobra.Command, _ []string) (err error) {
 	logger := log.GetLoggerFromContextOrDefault(c)
 
+	var credentials net.CredentialResolver
+	if credentials, err = loadCredentials(); err != nil {
+		return
+	}
+	o.fetcher.SetCredentials(credentials)
+
+	var tlsConfig *tls.Config
+	if tlsConfig, err = loadTLSConfig(); err != nil {
+		return
+	}
+	o.fetcher.SetTLSConfig(tlsConfig)
+
 	var i int
 	for i = 0; i < o.retry; i++ {
 		err = o.fetcher.FetchLatestRepo(o.Provider, o.branch, c.OutOrStdout())
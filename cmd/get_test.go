@@ -3,12 +3,16 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -18,6 +22,8 @@ import (
 	fakeruntime "github.com/linuxsuren/go-fake-runtime"
 	"github.com/linuxsuren/http-downloader/mock/mhttp"
 	"github.com/linuxsuren/http-downloader/pkg/installer"
+	"github.com/linuxsuren/http-downloader/pkg/log"
+	"github.com/linuxsuren/http-downloader/pkg/net"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 )
@@ -38,10 +44,70 @@ func Test_newGetCmd(t *testing.T) {
 		name: "timeout",
 	}, {
 		name: "max-attempts",
+	}, {
+		name: "retry-interval",
+	}, {
+		name: "retry-max-interval",
+	}, {
+		name: "retry-status-codes",
+	}, {
+		name: "limit-rate",
+	}, {
+		name: "mirror",
+	}, {
+		name: "cache-dir",
+	}, {
+		name: "no-cache",
+	}, {
+		name:      "input-file",
+		shorthand: "i",
+	}, {
+		name: "parallel",
+	}, {
+		name: "output-dir",
+	}, {
+		name: "follow-metalink",
+	}, {
+		name:      "header",
+		shorthand: "H",
+	}, {
+		name: "cookie",
+	}, {
+		name: "cookie-jar",
+	}, {
+		name: "user-agent",
+	}, {
+		name: "cacert",
+	}, {
+		name: "capath",
+	}, {
+		name: "cert",
+	}, {
+		name: "key",
+	}, {
+		name: "oci-media-type",
+	}, {
+		name: "oci-file",
+	}, {
+		name: "plain-http",
+	}, {
+		name: "s3-endpoint",
+	}, {
+		name: "content-disposition",
+	}, {
+		name: "redirect-filename",
+	}, {
+		name: "proxy-github-ttl",
 	}, {
 		name: "no-proxy",
+	}, {
+		name: "proxy",
+	}, {
+		name: "no-proxy-hosts",
 	}, {
 		name: "show-progress",
+	}, {
+		name: "progress",
 	}, {
 		name: "continue-at",
 	}, {
@@ -58,6 +124,10 @@ func Test_newGetCmd(t *testing.T) {
 		name: "print-categories",
 	}, {
 		name: "print-version-count",
+	}, {
+		name: "checksum",
+	}, {
+		name: "checksum-url",
 	}}
 	for i := range flags {
 		tt := flags[i]
@@ -114,6 +184,36 @@ func TestPreRunE(t *testing.T) {
 	// not args provided
 	opt.PrintCategories = false
 	assert.NotNil(t, opt.preRunE(fakeC, nil))
+
+	// invalid rate
+	opt.LimitRate = "fast"
+	assert.NotNil(t, opt.preRunE(fakeC, []string{"https://foo.com/bar.tar.gz"}))
+
+	opt.LimitRate = "5M"
+	assert.Nil(t, opt.preRunE(fakeC, []string{"https://foo.com/bar.tar.gz"}))
+	assert.Equal(t, int64(5*1024*1024), opt.rateLimiter.Rate())
+}
+
+func TestPreRunEWithMirrors(t *testing.T) {
+	opt := &downloadOption{
+		wait:    &sync.WaitGroup{},
+		fetcher: &installer.FakeFetcher{},
+		Mirrors: []string{"https://mirror.foo.com/bar.tar.gz"},
+	}
+	err := opt.preRunEWithMirrors(&cobra.Command{}, []string{"https://foo.com/bar.tar.gz", "https://bar.com/bar.tar.gz"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://foo.com/bar.tar.gz", opt.URL)
+	assert.Equal(t, "bar.tar.gz", opt.Output)
+	assert.Equal(t, []string{"https://mirror.foo.com/bar.tar.gz", "https://bar.com/bar.tar.gz"}, opt.Mirrors)
+
+	opt.ProxyGitHub = "ghproxy.com"
+	opt.Mirrors = []string{"https://github.com/linuxsuren/http-downloader/releases/download/v0.0.1/hd.tar.gz"}
+	assert.Equal(t, []string{"https://ghproxy.com/github.com/linuxsuren/http-downloader/releases/download/v0.0.1/hd.tar.gz"},
+		opt.getMirrors())
+
+	opt.Mirrors = nil
+	err = opt.preRunEWithMirrors(&cobra.Command{}, []string{"https://foo.com/bar.tar.gz", "bar.tar.gz"})
+	assert.NotNil(t, err)
 }
 
 func TestRunE(t *testing.T) {
@@ -122,6 +222,7 @@ func TestRunE(t *testing.T) {
 		opt     *downloadOption
 		args    []string
 		prepare func(t *testing.T, do *downloadOption)
+		verify  func(t *testing.T, do *downloadOption)
 		wantErr bool
 	}{{
 		name: "print shcema only",
@@ -171,25 +272,72 @@ func TestRunE(t *testing.T) {
 
 			ctrl := gomock.NewController(t)
 			roundTripper := mhttp.NewMockRoundTripper(ctrl)
-			ctx, cancel := context.WithCancel(context.Background())
-			defer func() {
-				cancel()
-			}()
-
-			// for size detecting
-			mockRequest, _ := http.NewRequestWithContext(ctx, http.MethodGet, do.URL, nil)
-			mockRequest.Header.Set("Range", "bytes=2-")
-			mockResponse := &http.Response{
-				StatusCode: http.StatusPartialContent,
-				Proto:      "HTTP/1.1",
-				Request:    mockRequest,
-				Header: map[string][]string{
-					"Content-Length": {"100"},
-				},
-				Body: io.NopCloser(bytes.NewBufferString("responseBody")),
-			}
+			roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+				// serve the range requests
+				recorder := httptest.NewRecorder()
+				http.ServeContent(recorder, req, "", time.Time{}, strings.NewReader(strings.Repeat("responseBody", 10)))
+				resp := recorder.Result()
+				resp.Request = req
+				return resp, nil
+			}).AnyTimes()
+			do.RoundTripper = roundTripper
+		},
+	}, {
+		name: "checksum matched",
+		opt: &downloadOption{
+			fetcher:  &installer.FakeFetcher{},
+			NoProxy:  true,
+			Checksum: "sha256:c31b829ca8935a8054312faaf42a5392756e65abfa94b91d41c306409542ef98",
+		},
+		prepare: func(t *testing.T, do *downloadOption) {
+			do.Output = path.Join(os.TempDir(), fmt.Sprintf("fake-%d", time.Now().Nanosecond()))
+			do.URL = "https://foo.com"
+			do.RoundTripper = newFakeBodyRoundTripper(t, do.URL, "responseBody")
+		},
+		wantErr: false,
+	}, {
+		name: "checksum mismatched",
+		opt: &downloadOption{
+			fetcher:  &installer.FakeFetcher{},
+			NoProxy:  true,
+			Checksum: "md5:5d41402abc4b2a76b9719d911017c592",
+		},
+		prepare: func(t *testing.T, do *downloadOption) {
+			do.Output = path.Join(os.TempDir(), fmt.Sprintf("fake-%d", time.Now().Nanosecond()))
+			do.URL = "https://foo.com"
+			do.RoundTripper = newFakeBodyRoundTripper(t, do.URL, "responseBody")
+		},
+		verify: func(t *testing.T, do *downloadOption) {
+			_, err := os.Stat(do.Output)
+			assert.True(t, os.IsNotExist(err), "the output file should be removed")
+		},
+		wantErr: true,
+	}, {
+		name: "checksum from a checksum file",
+		opt: &downloadOption{
+			fetcher:     &installer.FakeFetcher{},
+			NoProxy:     true,
+			ChecksumURL: "https://foo.com/checksums.txt",
+		},
+		prepare: func(t *testing.T, do *downloadOption) {
+			do.Output = path.Join(os.TempDir(), fmt.Sprintf("fake-%d", time.Now().Nanosecond()))
+			do.URL = "https://foo.com/hd.tar.gz"
 
-			roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(mockResponse, nil).AnyTimes()
+			ctrl := gomock.NewController(t)
+			roundTripper := mhttp.NewMockRoundTripper(ctrl)
+			roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+				body := "responseBody"
+				if req.URL.String() == do.ChecksumURL {
+					body = "c31b829ca8935a8054312faaf42a5392756e65abfa94b91d41c306409542ef98  hd.tar.gz\n"
+				}
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Proto:      "HTTP/1.1",
+					Request:    req,
+					Header:     http.Header{},
+					Body:       io.NopCloser(bytes.NewBufferString(body)),
+				}, nil
+			}).Times(2)
 			do.RoundTripper = roundTripper
 		},
 		wantErr: false,
@@ -216,10 +364,276 @@ func TestRunE(t *testing.T) {
 			} else {
 				assert.Nil(t, err, "should not error in [%d][%s]", i, tt.name)
 			}
+			if tt.verify != nil {
+				tt.verify(t, tt.opt)
+			}
 		})
 	}
 }
 
+func TestRunEWithStdout(t *testing.T) {
+	content := strings.Repeat("responseBody", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		thread   int
+		checksum string
+		wantErr  bool
+	}{{
+		name: "one thread",
+	}, {
+		name:   "multi-threads",
+		thread: 4,
+	}, {
+		name:     "checksum matched",
+		thread:   4,
+		checksum: "sha256:a71b68d182032bd5565faa1fa63b515a5fe76adb42dd62be32e65ffd5b2fc718",
+	}, {
+		name:     "checksum mismatched",
+		checksum: "md5:5d41402abc4b2a76b9719d911017c592",
+		wantErr:  true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := &downloadOption{
+				fetcher:  &installer.FakeFetcher{},
+				NoProxy:  true,
+				URL:      server.URL,
+				Output:   "-",
+				Thread:   tt.thread,
+				Checksum: tt.checksum,
+			}
+			buf := new(bytes.Buffer)
+			fakeCmd := &cobra.Command{}
+			fakeCmd.SetOut(buf)
+
+			err := opt.runE(fakeCmd, nil)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, content, buf.String())
+			assert.NoFileExists(t, "-")
+		})
+	}
+}
+
+func TestRunEWithMirrorsIntoStdout(t *testing.T) {
+	content := strings.Repeat("responseBody", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/other":
+			// it's different from the others, so it's dropped
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content[1:]))
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+		}
+	}))
+	defer server.Close()
+
+	newOption := func(output, progress string) *downloadOption {
+		return &downloadOption{
+			fetcher:      &installer.FakeFetcher{},
+			NoProxy:      true,
+			URL:          server.URL + "/target",
+			Mirrors:      []string{server.URL + "/mirror", server.URL + "/other", server.URL + "/missing"},
+			Output:       output,
+			Thread:       4,
+			Mod:          -1,
+			ShowProgress: true,
+			Progress:     progress,
+		}
+	}
+
+	t.Run("the stdout only has the data", func(t *testing.T) {
+		opt := newOption(outputStdout, net.ProgressPlain)
+		var err error
+		stdout := captureStdout(t, func() {
+			if err = opt.setupProgress(); err == nil {
+				err = opt.runE(&cobra.Command{}, nil)
+			}
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, content, stdout)
+	})
+
+	t.Run("the stdout only has the JSON events", func(t *testing.T) {
+		opt := newOption(path.Join(t.TempDir(), "target"), net.ProgressJSON)
+		var err error
+		stdout := captureStdout(t, func() {
+			if err = opt.setupProgress(); err == nil {
+				err = opt.runE(&cobra.Command{}, nil)
+			}
+		})
+		assert.Nil(t, err)
+
+		var messages int
+		for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+			event := net.ProgressEvent{}
+			assert.Nil(t, json.Unmarshal([]byte(line), &event), line)
+			if event.Type == net.ProgressMessage {
+				messages++
+			}
+		}
+		assert.Equal(t, 2, messages)
+	})
+}
+
+// captureStdout returns the data which is written into the stdout by the function
+func captureStdout(t *testing.T, f func()) string {
+	reader, writer, err := os.Pipe()
+	assert.Nil(t, err)
+	data := make(chan []byte)
+	go func() {
+		all, _ := io.ReadAll(reader)
+		data <- all
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() {
+		os.Stdout = stdout
+	}()
+	f()
+	_ = writer.Close()
+	return string(<-data)
+}
+
+func TestRunEWithFileScheme(t *testing.T) {
+	dir := t.TempDir()
+	source := path.Join(dir, "source.txt")
+	assert.Nil(t, os.WriteFile(source, []byte("responseBody"), 0644))
+
+	opt := &downloadOption{
+		fetcher:  &installer.FakeFetcher{},
+		URL:      (&url.URL{Scheme: "file", Path: source}).String(),
+		Output:   path.Join(dir, "target.txt"),
+		Checksum: "md5:5d41402abc4b2a76b9719d911017c592",
+	}
+	fakeCmd := &cobra.Command{}
+	fakeCmd.SetOut(new(bytes.Buffer))
+	// the checksum is verified after the download
+	assert.NotNil(t, opt.runE(fakeCmd, nil))
+
+	opt.Checksum = "sha256:c31b829ca8935a8054312faaf42a5392756e65abfa94b91d41c306409542ef98"
+	assert.Nil(t, opt.runE(fakeCmd, nil))
+	data, err := os.ReadFile(opt.Output)
+	assert.Nil(t, err)
+	assert.Equal(t, "responseBody", string(data))
+}
+
+func newFakeBodyRoundTripper(t *testing.T, targetURL, body string) http.RoundTripper {
+	ctrl := gomock.NewController(t)
+	roundTripper := mhttp.NewMockRoundTripper(ctrl)
+
+	mockRequest, _ := http.NewRequest(http.MethodGet, targetURL, nil)
+	mockResponse := &http.Response{
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Request:    mockRequest,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+	}
+	roundTripper.EXPECT().
+		RoundTrip(mockRequest).Return(mockResponse, nil)
+	return roundTripper
+}
+
+func TestGetRetryPolicy(t *testing.T) {
+	opt := &downloadOption{MaxAttempts: 5}
+	policy := opt.getRetryPolicy(log.GetLogger())
+	assert.Equal(t, 5, policy.MaxAttempts)
+	assert.Equal(t, net.DefaultRetryStatusCodes, policy.RetryStatusCodes)
+	assert.Equal(t, time.Second, policy.InitialInterval)
+	assert.NotNil(t, policy.OnRetry)
+
+	opt = &downloadOption{
+		RetryInterval:    time.Millisecond,
+		RetryMaxInterval: time.Second,
+		RetryStatusCodes: []int{http.StatusNotFound},
+	}
+	policy = opt.getRetryPolicy(log.GetLogger())
+	assert.Equal(t, 0, policy.MaxAttempts)
+	assert.Equal(t, time.Millisecond, policy.InitialInterval)
+	assert.Equal(t, time.Second, policy.MaxInterval)
+	assert.Equal(t, []int{http.StatusNotFound}, policy.RetryStatusCodes)
+}
+
+func TestSetupHeader(t *testing.T) {
+	opt := &downloadOption{
+		Headers:   []string{"x-token: abc", "Accept:application/json"},
+		Cookies:   []string{"session=def", "lang=en"},
+		UserAgent: "hd",
+	}
+	assert.Nil(t, opt.setupHeader())
+	assert.Equal(t, map[string]string{
+		"X-Token": "abc",
+		"Accept":  "application/json",
+		"Cookie":  "session=def; lang=en",
+	}, opt.hostHeader)
+	assert.Equal(t, map[string]string{"User-Agent": "hd"}, opt.header)
+	assert.Nil(t, opt.cookieJar)
+
+	opt = &downloadOption{}
+	assert.Nil(t, opt.setupHeader())
+	assert.Nil(t, opt.header)
+	assert.Nil(t, opt.hostHeader)
+
+	assert.NotNil(t, (&downloadOption{Headers: []string{"invalid"}}).setupHeader())
+	assert.NotNil(t, (&downloadOption{Cookies: []string{"invalid"}}).setupHeader())
+	assert.NotNil(t, (&downloadOption{CookieJarFile: path.Join(t.TempDir(), "missing")}).setupHeader())
+
+	cookieFile := path.Join(t.TempDir(), "cookies.txt")
+	assert.Nil(t, os.WriteFile(cookieFile, []byte("foo.com\tFALSE\t/\tFALSE\t0\tsession\tdef\n"), 0600))
+	opt = &downloadOption{CookieJarFile: cookieFile}
+	assert.Nil(t, opt.setupHeader())
+	assert.NotNil(t, opt.cookieJar)
+}
+
+func TestSetupCredentials(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("NETRC", path.Join(dir, "netrc"))
+	assert.Nil(t, os.WriteFile(path.Join(dir, "netrc"), []byte("machine foo.com login user password pass"), 0600))
+
+	opt := &downloadOption{fetcher: &installer.FakeFetcher{}}
+	assert.Nil(t, opt.setupCredentials())
+	if credential := opt.credentials.Resolve(&url.URL{Host: "foo.com"}); assert.NotNil(t, credential) {
+		assert.Equal(t, "user", credential.Username)
+	}
+
+	assert.Nil(t, os.WriteFile(path.Join(dir, "netrc"), []byte("login user"), 0600))
+	assert.NotNil(t, (&downloadOption{}).setupCredentials())
+}
+
+func TestSetupTLSConfig(t *testing.T) {
+	opt := &downloadOption{fetcher: &installer.FakeFetcher{}}
+	assert.Nil(t, opt.setupTLSConfig())
+	assert.Nil(t, opt.tlsConfig)
+
+	assert.NotNil(t, (&downloadOption{CACert: path.Join(t.TempDir(), "missing.pem")}).setupTLSConfig())
+	assert.NotNil(t, (&downloadOption{Key: path.Join(t.TempDir(), "client.key")}).setupTLSConfig())
+}
+
+func TestSetupProgress(t *testing.T) {
+	opt := &downloadOption{Progress: "json", ShowProgress: true}
+	assert.Nil(t, opt.setupProgress())
+	assert.NotNil(t, opt.getObserver())
+
+	opt = &downloadOption{Progress: "none", ShowProgress: true}
+	assert.Nil(t, opt.setupProgress())
+	assert.False(t, opt.ShowProgress)
+	assert.Nil(t, opt.getObserver())
+
+	assert.NotNil(t, (&downloadOption{Progress: "fake"}).setupProgress())
+}
+
 func TestDownloadMagnetFile(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -275,3 +689,186 @@ func TestDownloadMagnetFile(t *testing.T) {
 		})
 	}
 }
+
+func TestRenameToSuggested(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        string
+		outputFromURL bool
+		exist         bool
+		force         bool
+		expect        string
+	}{{
+		name:          "auto with the output from the URL",
+		policy:        contentDispositionAuto,
+		outputFromURL: true,
+		expect:        "suggested.tar.gz",
+	}, {
+		name:   "auto with the specified output",
+		policy: contentDispositionAuto,
+		expect: "download",
+	}, {
+		name:          "the suggested file exists",
+		policy:        contentDispositionAuto,
+		outputFromURL: true,
+		exist:         true,
+		expect:        "download",
+	}, {
+		name:          "overwrite the suggested file",
+		policy:        contentDispositionAuto,
+		outputFromURL: true,
+		exist:         true,
+		force:         true,
+		expect:        "suggested.tar.gz",
+	}, {
+		name:          "ignore",
+		policy:        contentDispositionIgnore,
+		outputFromURL: true,
+		expect:        "download",
+	}, {
+		name:          "ask without a terminal",
+		policy:        contentDispositionAsk,
+		outputFromURL: true,
+		expect:        "download",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opt := &downloadOption{
+				Output:             path.Join(dir, "download"),
+				ContentDisposition: tt.policy,
+				Force:              tt.force,
+				outputFromURL:      tt.outputFromURL,
+			}
+			assert.Nil(t, os.WriteFile(opt.Output, []byte("content"), 0644))
+			if tt.exist {
+				assert.Nil(t, os.WriteFile(path.Join(dir, "suggested.tar.gz"), []byte("existing"), 0644))
+			}
+
+			assert.Nil(t, opt.renameToSuggested(log.GetLogger(), "suggested.tar.gz"))
+			assert.Equal(t, path.Join(dir, tt.expect), opt.Output)
+			data, err := os.ReadFile(opt.Output)
+			assert.Nil(t, err)
+			assert.Equal(t, "content", string(data))
+		})
+	}
+
+	opt := &downloadOption{wait: &sync.WaitGroup{}, fetcher: &installer.FakeFetcher{}, ContentDisposition: "always"}
+	assert.NotNil(t, opt.preRunE(&cobra.Command{}, []string{"https://foo.com/bar.tar.gz"}))
+}
+
+func TestGetWithRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/download" {
+			http.Redirect(w, r, "/files/foo-1.0.0.tar.gz", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name   string
+		args   []string
+		expect string
+	}{{
+		name:   "keep the name without the Content-Disposition",
+		expect: "download",
+	}, {
+		name:   "rename to the redirected URL",
+		args:   []string{"--redirect-filename"},
+		expect: "foo-1.0.0.tar.gz",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cmd := newGetCmd(context.Background())
+			cmd.SetOut(new(bytes.Buffer))
+			cmd.SetErr(new(bytes.Buffer))
+			cmd.SetArgs(append([]string{server.URL + "/download", "--output-dir", dir, "--thread", "0",
+				"--no-cache", "--show-progress=false"}, tt.args...))
+			assert.Nil(t, cmd.Execute())
+
+			files, err := os.ReadDir(dir)
+			assert.Nil(t, err)
+			if assert.Equal(t, 1, len(files)) {
+				assert.Equal(t, tt.expect, files[0].Name())
+			}
+		})
+	}
+}
+
+func TestDownloadWithGitHubProxy(t *testing.T) {
+	var hosts []string
+	ctrl := gomock.NewController(t)
+	roundTripper := mhttp.NewMockRoundTripper(ctrl)
+	roundTripper.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		hosts = append(hosts, req.URL.Host)
+		recorder := httptest.NewRecorder()
+		switch req.URL.Host {
+		case "bad.proxy":
+			_, _ = recorder.WriteString("tampered")
+		case "html.proxy":
+			recorder.Header().Set(net.ContentType, "text/html")
+			_, _ = recorder.WriteString("<html></html>")
+		default:
+			_, _ = recorder.WriteString("responseBody")
+		}
+		resp := recorder.Result()
+		resp.Request = req
+		return resp, nil
+	}).AnyTimes()
+	newOption := func(targetURL string) *downloadOption {
+		return &downloadOption{
+			URL:           targetURL,
+			Output:        path.Join(t.TempDir(), "download"),
+			Mod:           -1,
+			NoProxy:       true,
+			RoundTripper:  roundTripper,
+			Checksum:      "sha256:c31b829ca8935a8054312faaf42a5392756e65abfa94b91d41c306409542ef98",
+			githubProxy:   &net.GitHubProxySelector{},
+			githubProxies: []string{"bad.proxy", "html.proxy", "good.proxy", ""},
+		}
+	}
+
+	t.Run("fall back to the next proxy", func(t *testing.T) {
+		hosts = nil
+		opt := newOption("https://github.com/linuxsuren/hd/releases/download/v1/hd.tar.gz")
+		_, err := opt.download(context.Background(), log.GetLogger())
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"bad.proxy", "html.proxy", "good.proxy"}, hosts)
+		assert.Equal(t, "good.proxy", opt.ProxyGitHub)
+		data, err := os.ReadFile(opt.Output)
+		assert.Nil(t, err)
+		assert.Equal(t, "responseBody", string(data))
+	})
+
+	t.Run("no proxy for other URLs", func(t *testing.T) {
+		hosts = nil
+		opt := newOption("https://foo.com/hd.tar.gz")
+		_, err := opt.download(context.Background(), log.GetLogger())
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"foo.com"}, hosts)
+	})
+
+	t.Run("all of them failed", func(t *testing.T) {
+		hosts = nil
+		opt := newOption("https://github.com/linuxsuren/hd/releases/download/v1/hd.tar.gz")
+		opt.githubProxies = []string{"bad.proxy"}
+		_, err := opt.download(context.Background(), log.GetLogger())
+		assert.NotNil(t, err)
+		assert.NoFileExists(t, opt.Output)
+	})
+
+	t.Run("not auto", func(t *testing.T) {
+		opt := &downloadOption{}
+		opt.ProxyGitHub = "foo.com"
+		opt.resolveGitHubProxy(context.Background(), log.GetLogger(), true)
+		assert.Equal(t, "foo.com", opt.ProxyGitHub)
+		assert.Nil(t, opt.githubProxy)
+
+		opt.ProxyGitHub = net.GitHubProxyAuto
+		opt.resolveGitHubProxy(context.Background(), log.GetLogger(), false)
+		assert.Empty(t, opt.ProxyGitHub)
+		assert.Nil(t, opt.githubProxy)
+	})
+}
@@ -7,11 +7,13 @@ import (
 	sysos "os"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/AlecAivazis/survey/v2"
 	fakeruntime "github.com/linuxsuren/go-fake-runtime"
 	"github.com/linuxsuren/http-downloader/pkg/common"
 	"github.com/linuxsuren/http-downloader/pkg/installer"
+	hdlog "github.com/linuxsuren/http-downloader/pkg/log"
 	"github.com/linuxsuren/http-downloader/pkg/os"
 	"github.com/linuxsuren/http-downloader/pkg/version"
 	"github.com/spf13/cobra"
@@ -30,7 +32,8 @@ func newInstallCmd(ctx context.Context) (cmd *cobra.Command) {
 		Short:   "Install a package from https://github.com/LinuxSuRen/hd-home",
 		Long: `Install a package from https://github.com/LinuxSuRen/hd-home
 Cannot find your desired package? Please run command: hd fetch --reset, then try it again`,
-		Example: "hd install goget",
+		Example: `hd install goget
+hd install goget kubectl --parallel 2`,
 		PreRunE: opt.preRunE,
 		RunE:    opt.runE,
 		GroupID: coreGroup.ID,
@@ -62,6 +65,7 @@ Cannot find your desired package? Please run command: hd fetch --reset, then try
 		"Clean the package if the installation is success")
 	flags.BoolVarP(&opt.KeepPart, "keep-part", "", false,
 		"If you want to keep the part files instead of deleting them")
+	flags.IntVarP(&opt.Parallel, "parallel", "", 3, "The max number of the parallel installations of the packages")
 	return
 }
 
@@ -122,25 +126,26 @@ func (o *installOption) preRunE(cmd *cobra.Command, args []string) (err error) {
 		err = fmt.Errorf("tool or category name is requried")
 		return
 	}
+	if o.Category != "" || len(args) > 1 {
+		// each package is prepared by its own option, see installPackages
+		err = o.downloadOption.setup(cmd)
+		return
+	}
 
 	// try to find if it's a native package
 	o.nativePackage = os.HasPackage(o.tool)
 	if !o.nativePackage {
-		if o.Category == "" {
-			err = o.downloadOption.preRunE(cmd, args)
-
-			if o.downloadOption.Package != nil {
-				// try to find the real tool name
-				if o.downloadOption.Package.TargetBinary != "" {
-					o.tool = o.downloadOption.Package.TargetBinary
-				} else if o.downloadOption.Package.Binary != "" {
-					o.tool = o.downloadOption.Package.Binary
-				} else {
-					o.tool = o.downloadOption.Package.Repo
-				}
+		err = o.downloadOption.preRunE(cmd, args)
+
+		if o.downloadOption.Package != nil {
+			// try to find the real tool name
+			if o.downloadOption.Package.TargetBinary != "" {
+				o.tool = o.downloadOption.Package.TargetBinary
+			} else if o.downloadOption.Package.Binary != "" {
+				o.tool = o.downloadOption.Package.Binary
+			} else {
+				o.tool = o.downloadOption.Package.Repo
 			}
-		} else {
-			err = o.downloadOption.fetch()
 		}
 	}
 	return
@@ -156,6 +161,7 @@ func (o *installOption) install(cmd *cobra.Command, args []string) (err error) {
 			return
 		}
 
+		o.resolveGitHubProxy(cmd.Context(), hdlog.GetLoggerFromContextOrDefault(cmd), true)
 		var proxy map[string]string
 		if o.ProxyGitHub != "" {
 			proxy = map[string]string{
@@ -251,32 +257,85 @@ func (o *installOption) runE(cmd *cobra.Command, args []string) (err error) {
 		if err = survey.AskOne(selector, &choose); err != nil {
 			return
 		}
+		err = o.installPackages(cmd, choose)
+	} else if len(args) > 1 {
+		err = o.installPackages(cmd, args)
+	} else {
+		err = o.install(cmd, args)
+	}
+	return
+}
 
-		for _, item := range choose {
-			if err = o.downloadOption.preRunE(cmd, []string{item}); err != nil {
-				return
-			}
+// installPackages installs the packages in parallel. Each package has its own copy of the option, and
+// all the downloads share the progress renderer, so the bars of the packages are in the same region.
+func (o *installOption) installPackages(cmd *cobra.Command, packages []string) (err error) {
+	defer func() {
+		if o.cancel != nil {
+			o.cancel()
+			o.wait.Wait()
+		}
+	}()
+
+	// prepare the packages one by one, it might ask for the choice of the user
+	options := make([]*installOption, len(packages))
+	for i, item := range packages {
+		options[i] = o.clone()
+		if err = options[i].preRunE(cmd, []string{item}); err != nil {
+			err = fmt.Errorf("failed to prepare %s, error: %v", item, err)
+			return
+		}
+	}
 
-			// try to find the real tool name
-			if o.downloadOption.Package.TargetBinary != "" {
-				o.tool = o.downloadOption.Package.TargetBinary
-			} else if o.downloadOption.Package.Binary != "" {
-				o.tool = o.downloadOption.Package.Binary
-			} else {
-				o.tool = o.downloadOption.Package.Repo
+	parallel := o.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	// the package managers hold a lock, so the native packages are installed one by one
+	nativeLock := sync.Mutex{}
+	errs := make([]error, len(packages))
+	semaphore := make(chan struct{}, parallel)
+	wg := sync.WaitGroup{}
+	for i := range options {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			if options[i].nativePackage {
+				nativeLock.Lock()
+				defer nativeLock.Unlock()
 			}
+			errs[i] = options[i].install(cmd, []string{packages[i]})
+		}(i)
+	}
+	wg.Wait()
 
-			if err = o.install(cmd, []string{item}); err != nil {
-				return
-			}
-			o.Output = "" // TODO this field must be set to be empty for the next round, need a better solution here
+	var failed int
+	for i := range errs {
+		if errs[i] != nil {
+			failed++
+			cmd.PrintErrf("failed to install %s, error: %v\n", packages[i], errs[i])
 		}
-	} else {
-		err = o.install(cmd, args)
+	}
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d packages failed to install", failed, len(packages))
 	}
 	return
 }
 
+// clone returns a copy of the option for a package, the shared settings like the progress renderer are kept
+func (o *installOption) clone() *installOption {
+	opt := *o
+	downloadOption := *o.downloadOption
+	downloadOption.Category = ""
+	// the context is canceled once all the packages are installed, see installPackages
+	downloadOption.cancel = nil
+	opt.downloadOption = &downloadOption
+	return &opt
+}
+
 func (o *installOption) installFromSource() (err error) {
 	if !o.Package.FromSource {
 		err = fmt.Errorf("not support install it from source")
@@ -3,12 +3,19 @@ package cmd
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	sysos "os"
+	"path"
 	"sync"
 	"testing"
 
 	cotesting "github.com/linuxsuren/cobra-extension/pkg/testing"
 	fakeruntime "github.com/linuxsuren/go-fake-runtime"
 	"github.com/linuxsuren/http-downloader/pkg/installer"
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 )
@@ -56,6 +63,49 @@ func Test_newInstallCmd(t *testing.T) {
 		Name: "provider",
 	}, {
 		Name: "no-proxy",
+	}, {
+		Name: "proxy",
+	}, {
+		Name: "no-proxy-hosts",
+	}, {
+		Name: "max-attempts",
+	}, {
+		Name: "limit-rate",
+	}, {
+		Name:      "header",
+		Shorthand: "H",
+	}, {
+		Name: "cookie",
+	}, {
+		Name: "cookie-jar",
+	}, {
+		Name: "user-agent",
+	}, {
+		Name: "cacert",
+	}, {
+		Name: "capath",
+	}, {
+		Name: "cert",
+	}, {
+		Name: "key",
+	}, {
+		Name: "oci-media-type",
+	}, {
+		Name: "oci-file",
+	}, {
+		Name: "plain-http",
+	}, {
+		Name: "s3-endpoint",
+	}, {
+		Name: "content-disposition",
+	}, {
+		Name: "redirect-filename",
+	}, {
+		Name: "proxy-github-ttl",
+	}, {
+		Name: "progress",
+	}, {
+		Name: "parallel",
 	}}
 	test.Valid(t, cmd.Flags())
 }
@@ -228,3 +278,71 @@ func TestGetDefaultInstallDir(t *testing.T) {
 		})
 	}
 }
+
+func TestInstallPackages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("binary of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	// the packages are defined in the local config
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	homedir.DisableCache = true
+	defer func() {
+		homedir.DisableCache = false
+	}()
+	configDir := path.Join(tmpDir, ".config", "hd-home", "config", "org")
+	assert.Nil(t, sysos.MkdirAll(configDir, 0750))
+	for _, name := range []string{"foo", "bar"} {
+		assert.Nil(t, sysos.WriteFile(path.Join(configDir, name+".yml"),
+			[]byte(fmt.Sprintf("url: %s/%s\ntar: \"false\"\n", server.URL, name)), 0644))
+	}
+
+	// the packages are downloaded into the current directory
+	wd, err := sysos.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, sysos.Chdir(tmpDir))
+	defer func() {
+		_ = sysos.Chdir(wd)
+	}()
+
+	var lock sync.Mutex
+	bars := map[string]bool{}
+	observer := net.ProgressObserverFunc(func(event net.ProgressEvent) {
+		lock.Lock()
+		defer lock.Unlock()
+		bars[event.URL] = true
+	})
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+	opt := &installOption{
+		downloadOption: &downloadOption{
+			searchOption: searchOption{Fetch: false},
+			fetcher:      &installer.FakeFetcher{},
+			wait:         &sync.WaitGroup{},
+			ShowProgress: true,
+			observer:     observer,
+			Mod:          -1,
+			Parallel:     2,
+		},
+		Download: true,
+		target:   path.Join(tmpDir, "bin"),
+		execer: fakeruntime.FakeExecer{
+			ExpectLookPathError: errors.New("not found"),
+			ExpectOS:            "linux",
+		},
+	}
+	packages := []string{"org/foo@v1.0.0", "org/bar@v1.0.0"}
+	assert.Nil(t, opt.preRunE(cmd, packages))
+	assert.Nil(t, opt.runE(cmd, packages))
+
+	// one renderer owns the bars of both packages
+	assert.Equal(t, map[string]bool{server.URL + "/foo": true, server.URL + "/bar": true}, bars)
+	for _, name := range []string{"foo", "bar"} {
+		data, err := sysos.ReadFile(path.Join(tmpDir, name))
+		assert.Nil(t, err)
+		assert.Equal(t, "binary of /"+name, string(data))
+	}
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	sysos "os"
+	"path/filepath"
+
+	"github.com/linuxsuren/http-downloader/pkg/common"
+	"github.com/linuxsuren/http-downloader/pkg/log"
+	"github.com/linuxsuren/http-downloader/pkg/net"
+)
+
+// downloadMetalink downloads all the files of the Metalink document into the output directory.
+// Each file is downloaded from all its mirrors, and verified by the pieces and the checksum.
+func (o *downloadOption) downloadMetalink(ctx context.Context, logger *log.LevelLog, metalinkPath, outputDir string) (err error) {
+	var f *sysos.File
+	if f, err = sysos.Open(metalinkPath); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var metalink *net.Metalink
+	if metalink, err = net.ParseMetalink(f); err != nil {
+		return
+	}
+
+	errs := &net.MultiError{}
+	for i := range metalink.Files {
+		if fileErr := o.downloadMetalinkFile(ctx, logger, &metalink.Files[i], outputDir); fileErr != nil {
+			errs.Add(fileErr)
+		}
+	}
+	err = errs.ErrorOrNil()
+	return
+}
+
+func (o *downloadOption) downloadMetalinkFile(ctx context.Context, logger *log.LevelLog, file *net.MetalinkFile,
+	outputDir string) (err error) {
+	output := filepath.Join(outputDir, filepath.FromSlash(file.Name))
+	if common.Exist(output) && !o.Force {
+		logger.Printf("The output file: '%s' was exist, please use flag --force if you want to overwrite it.\n", output)
+		return
+	}
+	if err = sysos.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return
+	}
+
+	var pieces *net.PieceChecksums
+	if pieces, err = file.PieceChecksums(); err != nil {
+		return
+	}
+
+	mirrors := file.Mirrors()
+	for i := range mirrors {
+		mirrors[i] = o.withProxyGitHub(mirrors[i])
+	}
+	logger.Printf("start to download %s from %d mirrors\n", file.Name, len(mirrors))
+
+	options := o.newDownloadOptions(o.getRetryPolicy(logger), o.getCache())
+	options.Mirrors = mirrors[1:]
+	options.PieceChecksums = pieces
+	if _, err = net.NewDownloader(options).Download(ctx, net.Request{URL: mirrors[0], TargetFilePath: output}); err != nil {
+		return
+	}
+
+	if checksum := file.Checksum(); checksum != nil {
+		if err = checksum.Verify(output); err != nil {
+			_ = sysos.RemoveAll(output)
+			return
+		}
+	}
+	logger.Printf("downloaded: %s\n", output)
+	return
+}
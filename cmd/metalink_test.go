@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadMetalink(t *testing.T) {
+	var document string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/download":
+			w.Header().Set("Content-Type", net.MetalinkContentType)
+			_, _ = w.Write([]byte(document))
+		case "/broken/hello":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader([]byte("hello")))
+		}
+	}))
+	defer server.Close()
+
+	document = fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="sub/hello">
+    <size>5</size>
+    <hash type="sha-256">2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824</hash>
+    <pieces length="2" type="sha-1">
+      <hash>c2e9f3d1e5d2a1e2ec3c1f0ee6ae6e5a6e8ea5cc</hash>
+      <hash>9e6d9b2a8c3a1d2e22d2fd1a4e0f1f5f5f0b8e9d</hash>
+      <hash>7a81af3e591ac713f81ea1efe93dcf36157d8376</hash>
+    </pieces>
+    <url priority="2">%[1]s/broken/hello</url>
+    <url priority="1">%[1]s/hello</url>
+  </file>
+</metalink>`, server.URL)
+
+	run := func(args ...string) error {
+		cmd := newGetCmd(context.Background())
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetErr(buf)
+		cmd.SetArgs(append(args, "--thread", "1", "--max-attempts", "0", "--no-cache", "--show-progress=false"))
+		return cmd.Execute()
+	}
+
+	// the pieces are broken
+	dir := t.TempDir()
+	metalinkFile := path.Join(dir, "hello.meta4")
+	assert.Nil(t, os.WriteFile(metalinkFile, []byte(document), 0600))
+	err := run(metalinkFile, "--output-dir", dir)
+	assert.NotNil(t, err)
+	assert.NoFileExists(t, path.Join(dir, "sub", "hello"))
+
+	// the real piece hashes of "hello"
+	document = fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="sub/hello">
+    <size>5</size>
+    <hash type="sha-256">2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824</hash>
+    <pieces length="2" type="sha-1">
+      <hash>30f088ea6673877c2e2c1edbe7513ff90eda9a6f</hash>
+      <hash>110c8a30c16070bf2813480d9492a1a170a7d80a</hash>
+      <hash>7a81af3e591ac713f81ea1efe93dcf36157d8376</hash>
+    </pieces>
+    <url priority="2">%[1]s/broken/hello</url>
+    <url priority="1">%[1]s/hello</url>
+  </file>
+</metalink>`, server.URL)
+	assert.Nil(t, os.WriteFile(metalinkFile, []byte(document), 0600))
+	dir = t.TempDir()
+	assert.Nil(t, run(metalinkFile, "--output-dir", dir))
+	data, err := os.ReadFile(path.Join(dir, "sub", "hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// follow the Metalink document which is served by a URL
+	dir = t.TempDir()
+	assert.Nil(t, run(server.URL+"/download", "--output-dir", dir))
+	data, err = os.ReadFile(path.Join(dir, "sub", "hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+}
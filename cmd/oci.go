@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"net/url"
+	"path"
+
+	"github.com/linuxsuren/http-downloader/pkg/log"
+	"github.com/linuxsuren/http-downloader/pkg/net"
+)
+
+// resolveOCIBlob resolves the layer of an oci:// reference, then returns the URL of the blob. The blob is
+// downloaded by the HTTP downloaders with the token of the registry, and verified by its digest.
+func (o *downloadOption) resolveOCIBlob(ctx context.Context, logger *log.LevelLog, reference string) (blobURL string, err error) {
+	var ref *net.OCIReference
+	if ref, err = net.ParseOCIReference(reference); err != nil {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	resolver := &net.OCIResolver{}
+	resolver.WithRoundTripper(o.RoundTripper).
+		WithoutProxy(o.NoProxy).
+		WithProxy(o.Proxy, o.NoProxyHosts).
+		WithInsecureSkipVerify(o.SkipTLS).
+		WithTLSConfig(o.tlsConfig).
+		WithTimeout(o.Timeout).
+		WithBasicAuth(o.Username, o.Password).
+		WithCredentials(o.credentials).
+		WithRetryPolicy(o.getRetryPolicy(logger)).
+		WithPlainHTTP(o.PlainHTTP).
+		WithPlatform(o.OS, o.Arch).
+		WithLayer(o.OCIMediaType, o.OCIFile)
+
+	var blob *net.OCIBlob
+	if blob, err = resolver.Resolve(ctx, ref); err != nil {
+		return
+	}
+	logger.Printf("resolved %s to the layer %s\n", ref, blob.Digest)
+
+	if blob.Header != nil {
+		var target *url.URL
+		if target, err = url.Parse(blob.URL); err != nil {
+			return
+		}
+		// the token is only sent to the registry, it goes before the credentials of the hosts
+		credential := &net.Credential{Host: target.Host, Type: net.CredentialHeader, Header: blob.Header}
+		o.credentials = net.CredentialChain{&net.CredentialStore{Credentials: []*net.Credential{credential}}, o.credentials}
+		// the basic auth was exchanged for the token, it should not replace the token of the blob requests
+		o.Username, o.Password = "", ""
+	}
+	if o.Checksum == "" && o.ChecksumURL == "" {
+		o.Checksum = blob.Digest
+	}
+	if o.Output == "" {
+		if o.Output = blob.Filename(); o.Output == "" {
+			o.Output = path.Base(ref.Repository)
+		}
+	}
+	blobURL = blob.URL
+	return
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/installer"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOCIArtifact(t *testing.T) {
+	content := strings.Repeat("responseBody", 100)
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+	wrongDigest := "sha256:c31b829ca8935a8054312faaf42a5392756e65abfa94b91d41c306409542ef98"
+	manifest := fmt.Sprintf(`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.manifest.v1+json", "layers": [
+{"mediaType": "application/vnd.foo.binary", "digest": "%s", "size": %d, "annotations": {"org.opencontainers.image.title": "tool"}}]}`,
+		digest, len(content))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/org/tool/manifests/v1":
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(manifest))
+		case "/v2/org/tool/blobs/" + digest, "/v2/org/broken/blobs/" + wrongDigest:
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+		case "/v2/org/broken/manifests/v1":
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(strings.ReplaceAll(manifest, digest, wrongDigest)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	dir := t.TempDir()
+	opt := &downloadOption{
+		wait:      &sync.WaitGroup{},
+		fetcher:   &installer.FakeFetcher{},
+		NoProxy:   true,
+		OutputDir: dir,
+		Thread:    4,
+		Mod:       -1,
+	}
+	fakeCmd := &cobra.Command{}
+	fakeCmd.SetOut(new(bytes.Buffer))
+	assert.Nil(t, opt.preRunE(fakeCmd, []string{"oci://" + registry + "/org/tool:v1"}))
+	assert.Equal(t, server.URL+"/v2/org/tool/blobs/"+digest, opt.URL)
+	assert.Equal(t, "tool", opt.Output)
+	assert.Equal(t, digest, opt.Checksum)
+
+	opt.Output = path.Join(dir, opt.Output)
+	assert.Nil(t, opt.runE(fakeCmd, nil))
+	data, err := os.ReadFile(opt.Output)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+
+	// the blob does not match the digest of the manifest
+	opt.Output, opt.Checksum = path.Join(dir, "broken"), ""
+	assert.Nil(t, opt.preRunE(fakeCmd, []string{"oci://" + registry + "/org/broken:v1"}))
+	err = opt.runE(fakeCmd, nil)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "checksum")
+	}
+	assert.NoFileExists(t, opt.Output)
+
+	opt.Output, opt.Checksum = "", ""
+	assert.NotNil(t, opt.preRunE(fakeCmd, []string{"oci://" + registry + "/org/unknown:v1"}))
+	assert.NotNil(t, opt.preRunE(fakeCmd, []string{"oci://" + registry}))
+}
+
+func TestGetOCIArtifactWithToken(t *testing.T) {
+	content := strings.Repeat("responseBody", 100)
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+	manifest := fmt.Sprintf(`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.manifest.v1+json", "layers": [
+{"mediaType": "application/vnd.foo.binary", "digest": "%s", "size": %d}]}`, digest, len(content))
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			_, _ = w.Write([]byte(`{"token": "token"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/org/tool/manifests/v1":
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(manifest))
+		case "/v2/org/tool/blobs/" + digest:
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	var mirrorAuthorized int32
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			atomic.AddInt32(&mirrorAuthorized, 1)
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer mirror.Close()
+
+	dir := t.TempDir()
+	opt := &downloadOption{
+		wait:      &sync.WaitGroup{},
+		fetcher:   &installer.FakeFetcher{},
+		NoProxy:   true,
+		OutputDir: dir,
+		Thread:    4,
+		Mod:       -1,
+	}
+	fakeCmd := &cobra.Command{}
+	fakeCmd.SetOut(new(bytes.Buffer))
+	assert.Nil(t, opt.preRunE(fakeCmd, []string{"oci://" + strings.TrimPrefix(server.URL, "http://") + "/org/tool:v1", mirror.URL + "/tool"}))
+	// the token is only sent to the registry
+	assert.Empty(t, opt.header["Authorization"])
+
+	opt.Output = path.Join(dir, "tool")
+	assert.Nil(t, opt.runE(fakeCmd, nil))
+	data, err := os.ReadFile(opt.Output)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&mirrorAuthorized))
+}
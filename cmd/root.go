@@ -6,8 +6,10 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/linuxsuren/http-downloader/pkg/log"
+	"github.com/linuxsuren/http-downloader/pkg/net"
 	"github.com/mitchellh/go-homedir"
 
 	"github.com/AlecAivazis/survey/v2/terminal"
@@ -45,7 +47,7 @@ func NewRoot(cxt context.Context) (cmd *cobra.Command) {
 
 	cxt = context.WithValue(cxt, log.LoggerContextKey, log.GetLogger())
 	cmd.AddCommand(
-		newGetCmd(cxt), newInstallCmd(cxt), newFetchCmd(cxt), newSearchCmd(cxt), newSetupCommand(v, stdio),
+		newGetCmd(cxt), newInstallCmd(cxt), newFetchCmd(cxt), newSearchCmd(cxt), newSetupCommand(v, stdio), newCacheCmd(),
 		extver.NewVersionCmd("linuxsuren", "http-downloader", "hd", nil))
 
 	for _, c := range cmd.Commands() {
@@ -87,6 +89,25 @@ func loadConfig(v *viper.Viper) (err error) {
 	v.SetDefault("fetch", false)
 	v.SetDefault("goget", false)
 	v.SetDefault("no-proxy", false)
+	v.SetDefault("proxy", "")
+	v.SetDefault("no-proxy-hosts", "")
+	v.SetDefault("max-attempts", 10)
+	v.SetDefault("retry-interval", time.Second)
+	v.SetDefault("retry-max-interval", 30*time.Second)
+	v.SetDefault("retry-status-codes", net.DefaultRetryStatusCodes)
+	v.SetDefault("limit-rate", "")
+	v.SetDefault("cache", "")
+	v.SetDefault("no-cache", false)
+	v.SetDefault("user-agent", "")
+	v.SetDefault("progress", net.ProgressAuto)
+	v.SetDefault("cacert", "")
+	v.SetDefault("capath", "")
+	v.SetDefault("cert", "")
+	v.SetDefault("key", "")
+	v.SetDefault("s3-endpoint", "")
+	v.SetDefault("content-disposition", "auto")
+	v.SetDefault("redirect-filename", false)
+	v.SetDefault("proxy-github-ttl", net.DefaultGitHubProxyTTL)
 
 	thread := runtime.NumCPU()
 	if thread > 4 {
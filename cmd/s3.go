@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"path"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+)
+
+// resolveS3Object returns the HTTP URL of an s3:// object. The requests of the URL are signed by the
+// credential from the environment variables or the AWS shared files, so they don't need to be pre-signed.
+func (o *downloadOption) resolveS3Object(text string) (objectURL string, err error) {
+	var object *net.S3Object
+	if object, err = net.ParseS3URL(text); err != nil {
+		return
+	}
+
+	var config *net.S3Config
+	if config, err = net.LoadS3Config("", net.DefaultAWSCredentialsFile(), net.DefaultAWSConfigFile()); err != nil {
+		return
+	}
+	if o.S3Endpoint != "" {
+		config.Endpoint = o.S3Endpoint
+	}
+	if objectURL, err = config.ObjectURL(object); err != nil {
+		return
+	}
+
+	if credential := config.Credential(objectURL); credential != nil {
+		// it goes before the credentials of the hosts
+		o.credentials = net.CredentialChain{&net.CredentialStore{Credentials: []*net.Credential{credential}}, o.credentials}
+	}
+	if o.Output == "" {
+		o.Output = path.Base(object.Key)
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/installer"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetS3Object(t *testing.T) {
+	content := strings.Repeat("responseBody", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/releases/v1/tool.tar.gz" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio-key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", path.Join(dir, "credentials"))
+	t.Setenv("AWS_CONFIG_FILE", path.Join(dir, "config"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "minio-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "minio-secret")
+
+	opt := &downloadOption{
+		wait:       &sync.WaitGroup{},
+		fetcher:    &installer.FakeFetcher{},
+		NoProxy:    true,
+		Thread:     4,
+		Mod:        -1,
+		S3Endpoint: server.URL,
+	}
+	fakeCmd := &cobra.Command{}
+	fakeCmd.SetOut(new(bytes.Buffer))
+	assert.Nil(t, opt.preRunE(fakeCmd, []string{"s3://releases/v1/tool.tar.gz"}))
+	assert.Equal(t, server.URL+"/releases/v1/tool.tar.gz", opt.URL)
+	assert.Equal(t, "tool.tar.gz", opt.Output)
+
+	opt.Output = path.Join(dir, opt.Output)
+	assert.Nil(t, opt.runE(fakeCmd, nil))
+	data, err := os.ReadFile(opt.Output)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+
+	opt.Output = ""
+	assert.NotNil(t, opt.preRunE(fakeCmd, []string{"s3://releases"}))
+}
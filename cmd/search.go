@@ -2,11 +2,13 @@ package cmd
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 
 	"github.com/linuxsuren/http-downloader/pkg/installer"
 	"github.com/linuxsuren/http-downloader/pkg/log"
+	"github.com/linuxsuren/http-downloader/pkg/net"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -42,12 +44,24 @@ func (s *searchOption) addFlags(flags *pflag.FlagSet) {
 	flags.StringVarP(&s.Provider, "provider", "", viper.GetString("provider"), "The file provider")
 	flags.StringVarP(&s.ProxyGitHub, "proxy-github", "", viper.GetString("proxy-github"),
 		`The proxy address of github.com, the proxy address will be the prefix of the final address.
+The auto one selects the fastest server of proxy.yaml, and falls back to the next one or the direct connection if it failed.
 Submit the new proxy server in https://github.com/LinuxSuRen/hd-home`)
 }
 
 func (s *searchOption) runE(c *cobra.Command, args []string) (err error) {
 	logger := log.GetLoggerFromContextOrDefault(c)
 
+	var credentials net.CredentialResolver
+	if credentials, err = loadCredentials(); err != nil {
+		return
+	}
+	s.fetcher.SetCredentials(credentials)
+
+	var tlsConfig *tls.Config
+	if tlsConfig, err = loadTLSConfig(); err != nil {
+		return
+	}
+	s.fetcher.SetTLSConfig(tlsConfig)
 	err = search(args[0], s.Fetch, s.fetcher, c.OutOrStdout(), logger)
 	return
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/AlecAivazis/survey/v2/terminal"
 	"github.com/linuxsuren/http-downloader/pkg/installer"
 	"github.com/linuxsuren/http-downloader/pkg/log"
+	"github.com/linuxsuren/http-downloader/pkg/net"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -40,7 +41,7 @@ type setupOption struct {
 
 func (o *setupOption) runE(cmd *cobra.Command, args []string) (err error) {
 	logger := log.GetLoggerFromContextOrDefault(cmd)
-	proxyServers := []string{""}
+	proxyServers := []string{"", net.GitHubProxyAuto}
 	proxyServers = append(proxyServers, installer.GetProxyServers()...)
 
 	if o.proxy == "" {
@@ -3,13 +3,22 @@ package main
 import (
 	"context"
 	"os"
+	"os/signal"
 
 	"github.com/linuxsuren/http-downloader/cmd"
 )
 
 func main() {
-	ctx := context.Background()
-	if err := cmd.NewRoot(ctx).ExecuteContext(ctx); err != nil {
+	// the downloads are canceled by the first interrupt, the second one kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := cmd.NewRoot(ctx).ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -2,19 +2,27 @@ package installer
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/go-git/go-git/v5/plumbing/object"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/linuxsuren/http-downloader/pkg/common"
+	"github.com/linuxsuren/http-downloader/pkg/net"
 	"github.com/mitchellh/go-homedir"
 )
 
@@ -37,13 +45,33 @@ type Fetcher interface {
 	FetchLatestRepo(provider string, branch string,
 		progress io.Writer) (err error)
 	SetContext(ctx context.Context)
+	SetCredentials(credentials net.CredentialResolver)
+	SetTLSConfig(config *tls.Config)
 }
 
 // DefaultFetcher is the default fetcher which fetches the config files from a git repository
 type DefaultFetcher struct {
-	ctx context.Context
+	ctx         context.Context
+	credentials net.CredentialResolver
+	transport   http.RoundTripper
 }
 
+// transportKey is the context key of the transport of a fetcher
+type transportKey struct{}
+
+// contextTransport sends the request with the transport from its context, or the default one
+type contextTransport struct{}
+
+// RoundTrip implements http.RoundTripper
+func (contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport, ok := req.Context().Value(transportKey{}).(http.RoundTripper); ok {
+		return transport.RoundTrip(req)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+var installContextTransport sync.Once
+
 // GetConfigDir returns the directory of the config
 func (f *DefaultFetcher) GetConfigDir() (configDir string, err error) {
 	var userHome string
@@ -64,6 +92,59 @@ func (f *DefaultFetcher) SetContext(ctx context.Context) {
 	f.ctx = ctx
 }
 
+// SetCredentials sets the credentials of the git repository
+func (f *DefaultFetcher) SetCredentials(credentials net.CredentialResolver) {
+	f.credentials = credentials
+}
+
+// SetTLSConfig sets the custom CA certificates and the client certificate of the git repository.
+// go-git only takes the client certificate from the https client which is shared by all the repositories,
+// so it installs a global https client once. That client takes the transport from the context of the
+// request, the git operations out of this fetcher keep using the default transport.
+func (f *DefaultFetcher) SetTLSConfig(config *tls.Config) {
+	f.transport = nil
+	if config != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config
+		f.transport = transport
+		installContextTransport.Do(func() {
+			client.InstallProtocol("https", githttp.NewClient(&http.Client{Transport: contextTransport{}}))
+		})
+	}
+}
+
+// getContext returns the context of the git operations, it carries the transport of this fetcher
+func (f *DefaultFetcher) getContext() (ctx context.Context) {
+	if ctx = f.ctx; ctx == nil {
+		ctx = context.Background()
+	}
+	if f.transport != nil {
+		ctx = context.WithValue(ctx, transportKey{}, f.transport)
+	}
+	return
+}
+
+// getAuth returns the auth of the git repository, the header credential is not supported by git
+func (f *DefaultFetcher) getAuth(repoAddr string) (auth transport.AuthMethod) {
+	if f.credentials == nil {
+		return
+	}
+
+	repoURL, err := url.Parse(repoAddr)
+	if err != nil {
+		return
+	}
+	if credential := f.credentials.Resolve(repoURL); credential != nil {
+		switch credential.Type {
+		case net.CredentialBasic:
+			auth = &githttp.BasicAuth{Username: credential.Username, Password: credential.Password}
+		case net.CredentialBearer:
+			auth = &githttp.TokenAuth{Token: credential.Token}
+		}
+	}
+	return
+}
+
 // FetchLatestRepo fetches the hd-home as the config
 func (f *DefaultFetcher) FetchLatestRepo(provider string, branch string,
 	progress io.Writer) (err error) {
@@ -129,8 +210,9 @@ func (f *DefaultFetcher) FetchLatestRepo(provider string, branch string,
 					return
 				}
 
-				if err = repo.FetchContext(f.ctx, &git.FetchOptions{
+				if err = repo.FetchContext(f.getContext(), &git.FetchOptions{
 					RemoteName: remoteName,
+					Auth:       f.getAuth(repoAddr),
 					Progress:   progress,
 					Force:      true,
 					Depth:      1,
@@ -163,9 +245,10 @@ func (f *DefaultFetcher) FetchLatestRepo(provider string, branch string,
 					return
 				}
 
-				if err = wd.PullContext(f.ctx, &git.PullOptions{
+				if err = wd.PullContext(f.getContext(), &git.PullOptions{
 					RemoteName:    remoteName,
 					ReferenceName: plumbing.NewBranchReferenceName(branch),
+					Auth:          f.getAuth(repoAddr),
 					Progress:      progress,
 					Force:         true,
 				}); err != nil && err != git.NoErrAlreadyUpToDate {
@@ -194,9 +277,10 @@ func (f *DefaultFetcher) FetchLatestRepo(provider string, branch string,
 	} else {
 		_, _ = fmt.Fprintf(progress, "no local config exist, try to clone it\n")
 
-		if _, err = git.PlainCloneContext(f.ctx, configDir, false, &git.CloneOptions{
+		if _, err = git.PlainCloneContext(f.getContext(), configDir, false, &git.CloneOptions{
 			RemoteName:   remoteName,
 			URL:          repoAddr,
+			Auth:         f.getAuth(repoAddr),
 			Progress:     progress,
 			SingleBranch: true,
 		}); err != nil {
@@ -253,3 +337,9 @@ func (f *FakeFetcher) FetchLatestRepo(provider string, branch string,
 
 // SetContext is a fake method
 func (f *FakeFetcher) SetContext(ctx context.Context) {}
+
+// SetCredentials is a fake method
+func (f *FakeFetcher) SetCredentials(credentials net.CredentialResolver) {}
+
+// SetTLSConfig is a fake method
+func (f *FakeFetcher) SetTLSConfig(config *tls.Config) {}
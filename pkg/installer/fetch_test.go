@@ -2,10 +2,15 @@ package installer
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os/user"
 	"path/filepath"
 	"testing"
 
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/linuxsuren/http-downloader/pkg/net"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,3 +38,43 @@ func TestGetConfigDir(t *testing.T) {
 	assert.Equal(t, "", dir)
 	assert.Nil(t, err)
 }
+
+func TestGetAuth(t *testing.T) {
+	fetcher := &DefaultFetcher{}
+	assert.Nil(t, fetcher.getAuth(ConfigGitHub))
+
+	fetcher.SetCredentials(&net.CredentialStore{Credentials: []*net.Credential{
+		{Host: "github.com", Type: net.CredentialBearer, Token: "token"},
+		{Host: "gitee.com", Type: net.CredentialBasic, Username: "user", Password: "pass"},
+		{Host: "gitlab.com", Type: net.CredentialHeader, Header: map[string]string{"PRIVATE-TOKEN": "token"}},
+	}})
+	assert.Equal(t, &githttp.TokenAuth{Token: "token"}, fetcher.getAuth(ConfigGitHub))
+	assert.Equal(t, &githttp.BasicAuth{Username: "user", Password: "pass"}, fetcher.getAuth("https://gitee.com/LinuxSuRen/hd-home"))
+	assert.Nil(t, fetcher.getAuth("https://gitlab.com/LinuxSuRen/hd-home"))
+	assert.Nil(t, fetcher.getAuth("https://bitbucket.org/LinuxSuRen/hd-home"))
+}
+
+func TestSetTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	fetcher := &DefaultFetcher{}
+	fetcher.SetTLSConfig(server.Client().Transport.(*http.Transport).TLSClientConfig)
+	assert.NotEqual(t, githttp.DefaultClient, client.Protocols["https"])
+
+	// only the requests of the fetcher trust the server
+	req, err := http.NewRequestWithContext(fetcher.getContext(), http.MethodGet, server.URL, nil)
+	assert.Nil(t, err)
+	resp, err := contextTransport{}.RoundTrip(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_ = resp.Body.Close()
+
+	req, err = http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	assert.Nil(t, err)
+	_, err = contextTransport{}.RoundTrip(req)
+	assert.NotNil(t, err)
+
+	fetcher.SetTLSConfig(nil)
+	assert.Equal(t, context.Background(), fetcher.getContext())
+}
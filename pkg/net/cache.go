@@ -0,0 +1,350 @@
+package net
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/common"
+	"github.com/mitchellh/go-homedir"
+)
+
+// Cache stores the downloaded files by their content hash. The entries are keyed by the URL, and
+// record the validators (ETag and Last-Modified) which are used to send the conditional requests.
+// The layout of the directory:
+//
+//	blobs/sha256/<hex>      the content of the files
+//	entries/<hash of URL>   the metadata of each URL
+//	tmp/                    the files which are being written
+type Cache struct {
+	Dir string
+}
+
+// CacheEntry is the metadata of a cached URL
+type CacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Size         int64     `json:"size"`
+	Digest       string    `json:"digest"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastUsedAt   time.Time `json:"lastUsedAt"`
+}
+
+// staleCacheTmpAge is the age of a temporary file which is treated as an abandoned one
+const staleCacheTmpAge = 24 * time.Hour
+
+// NewCache creates a cache with the directory
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// DefaultCacheDir returns $XDG_CACHE_HOME/hd, or ~/.cache/hd if the environment variable is empty
+func DefaultCacheDir() string {
+	if dir := common.GetEnvironment("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "hd")
+	}
+
+	userHome, err := homedir.Dir()
+	if err != nil {
+		userHome = os.TempDir()
+	}
+	return filepath.Join(userHome, ".cache", "hd")
+}
+
+// Get returns the entry of the URL, returns nil if it does not exist or the content is missing
+func (c *Cache) Get(targetURL string) (entry *CacheEntry) {
+	if c == nil {
+		return
+	}
+
+	data, err := os.ReadFile(c.entryPath(targetURL))
+	if err != nil {
+		return
+	}
+
+	entry = &CacheEntry{}
+	if err = json.Unmarshal(data, entry); err != nil || entry.URL != targetURL {
+		return nil
+	}
+	if stat, err := os.Stat(c.blobPath(entry.Digest)); err != nil || stat.Size() != entry.Size {
+		return nil
+	}
+	return
+}
+
+// Open opens the content of the entry, and marks it as used
+func (c *Cache) Open(entry *CacheEntry) (f *os.File, err error) {
+	if f, err = os.Open(c.blobPath(entry.Digest)); err == nil {
+		entry.LastUsedAt = time.Now()
+		_ = c.saveEntry(entry)
+	}
+	return
+}
+
+// Matches checks if the entry has the same validators with the remote resource
+func (e *CacheEntry) Matches(etag, lastModified string, size int64) bool {
+	if size >= 0 && e.Size != size {
+		return false
+	}
+	if e.ETag != "" || etag != "" {
+		return e.ETag == etag
+	}
+	return e.LastModified != "" && e.LastModified == lastModified
+}
+
+// NewWriter returns a writer which stores the data into the cache once it's committed
+func (c *Cache) NewWriter(targetURL, etag, lastModified string) (writer *CacheWriter, err error) {
+	tmpDir := filepath.Join(c.Dir, "tmp")
+	if err = os.MkdirAll(tmpDir, 0755); err != nil {
+		return
+	}
+
+	var f *os.File
+	if f, err = os.CreateTemp(tmpDir, "blob"); err == nil {
+		writer = &CacheWriter{
+			cache: c,
+			file:  f,
+			hash:  sha256.New(),
+			entry: &CacheEntry{
+				URL:          targetURL,
+				ETag:         etag,
+				LastModified: lastModified,
+			},
+		}
+	}
+	return
+}
+
+// Put stores the file into the cache
+func (c *Cache) Put(targetURL, etag, lastModified, filePath string) (entry *CacheEntry, err error) {
+	var f *os.File
+	if f, err = os.Open(filePath); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var writer *CacheWriter
+	if writer, err = c.NewWriter(targetURL, etag, lastModified); err != nil {
+		return
+	}
+	if _, err = io.Copy(writer, f); err != nil {
+		writer.Abort()
+		return
+	}
+	entry, err = writer.Commit()
+	return
+}
+
+// List returns all the entries which are sorted by the last used time, the recent one goes first
+func (c *Cache) List() (entries []*CacheEntry, err error) {
+	var files []os.DirEntry
+	if files, err = os.ReadDir(filepath.Join(c.Dir, "entries")); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+
+	for _, file := range files {
+		data, readErr := os.ReadFile(filepath.Join(c.Dir, "entries", file.Name()))
+		if readErr != nil {
+			continue
+		}
+
+		entry := &CacheEntry{}
+		if json.Unmarshal(data, entry) == nil && entry.URL != "" {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsedAt.After(entries[j].LastUsedAt)
+	})
+	return
+}
+
+// Prune removes the entries which were not used in the max age, then removes the least recently
+// used entries until the total size is not bigger than the max size. Zero means no limit.
+func (c *Cache) Prune(maxSize int64, maxAge time.Duration) (removed []*CacheEntry, err error) {
+	var entries []*CacheEntry
+	if entries, err = c.List(); err != nil {
+		return
+	}
+
+	var kept []*CacheEntry
+	for _, entry := range entries {
+		if maxAge > 0 && time.Since(entry.LastUsedAt) > maxAge {
+			removed = append(removed, entry)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+
+	if maxSize > 0 {
+		// the entries might share the same content
+		sizes := map[string]int64{}
+		var total int64
+		for _, entry := range kept {
+			if _, ok := sizes[entry.Digest]; !ok {
+				total += entry.Size
+			}
+			sizes[entry.Digest]++
+		}
+
+		for total > maxSize && len(kept) > 0 {
+			entry := kept[len(kept)-1]
+			kept = kept[:len(kept)-1]
+			removed = append(removed, entry)
+			if sizes[entry.Digest]--; sizes[entry.Digest] == 0 {
+				total -= entry.Size
+			}
+		}
+	}
+
+	for _, entry := range removed {
+		if err = os.Remove(c.entryPath(entry.URL)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+	}
+	err = c.removeUnusedBlobs(kept)
+	return
+}
+
+// Clean removes all the cached files
+func (c *Cache) Clean() error {
+	return os.RemoveAll(c.Dir)
+}
+
+// removeUnusedBlobs removes the content which does not belong to any entry, and the stale temporary files
+func (c *Cache) removeUnusedBlobs(entries []*CacheEntry) (err error) {
+	used := map[string]bool{}
+	for _, entry := range entries {
+		used[filepath.Base(c.blobPath(entry.Digest))] = true
+	}
+
+	blobDir := filepath.Join(c.Dir, "blobs", "sha256")
+	var files []os.DirEntry
+	if files, err = os.ReadDir(blobDir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	for _, file := range files {
+		if !used[file.Name()] {
+			if err = os.Remove(filepath.Join(blobDir, file.Name())); err != nil {
+				return
+			}
+		}
+	}
+
+	// the temporary files might be written by other processes
+	tmpDir := filepath.Join(c.Dir, "tmp")
+	if files, err = os.ReadDir(tmpDir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	for _, file := range files {
+		if info, infoErr := file.Info(); infoErr == nil && time.Since(info.ModTime()) > staleCacheTmpAge {
+			_ = os.Remove(filepath.Join(tmpDir, file.Name()))
+		}
+	}
+	return
+}
+
+func (c *Cache) entryPath(targetURL string) string {
+	sum := sha256.Sum256([]byte(targetURL))
+	return filepath.Join(c.Dir, "entries", hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *Cache) blobPath(digest string) string {
+	return filepath.Join(c.Dir, "blobs", "sha256", filepath.Base(strings.TrimPrefix(digest, "sha256:")))
+}
+
+func (c *Cache) saveEntry(entry *CacheEntry) (err error) {
+	entryPath := c.entryPath(entry.URL)
+	if err = os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return
+	}
+
+	var data []byte
+	if data, err = json.Marshal(entry); err == nil {
+		tmpPath := entryPath + ".tmp"
+		if err = os.WriteFile(tmpPath, data, 0644); err == nil {
+			err = os.Rename(tmpPath, entryPath)
+		}
+	}
+	return
+}
+
+// CacheWriter writes the data into a temporary file of the cache
+type CacheWriter struct {
+	cache *Cache
+	file  *os.File
+	hash  hash.Hash
+	entry *CacheEntry
+	err   error
+}
+
+// Write writes the data, and calculates the hash. It never returns an error, so that
+// a broken cache does not fail the download. The error is returned by Commit instead.
+func (w *CacheWriter) Write(p []byte) (n int, err error) {
+	if w.err == nil {
+		if n, w.err = w.file.Write(p); n > 0 {
+			_, _ = w.hash.Write(p[:n])
+			w.entry.Size += int64(n)
+		}
+	}
+	return len(p), nil
+}
+
+// Commit moves the data into the blobs, then saves the entry
+func (w *CacheWriter) Commit() (entry *CacheEntry, err error) {
+	if err = w.err; err == nil {
+		err = w.file.Close()
+	}
+	if err != nil {
+		w.Abort()
+		return
+	}
+
+	entry = w.entry
+	entry.Digest = "sha256:" + hex.EncodeToString(w.hash.Sum(nil))
+	entry.CreatedAt = time.Now()
+	entry.LastUsedAt = entry.CreatedAt
+
+	blobPath := w.cache.blobPath(entry.Digest)
+	if err = os.MkdirAll(filepath.Dir(blobPath), 0755); err == nil {
+		// the same content might be cached already
+		err = os.Rename(w.file.Name(), blobPath)
+	}
+	if err == nil {
+		err = w.cache.saveEntry(entry)
+	}
+
+	if err != nil {
+		w.Abort()
+		entry = nil
+		err = fmt.Errorf("failed to save the cache of %s, error: %v", w.entry.URL, err)
+	}
+	return
+}
+
+// Abort removes the temporary file
+func (w *CacheWriter) Abort() {
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
@@ -0,0 +1,137 @@
+package net_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultCacheDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", "/tmp/cache")
+	assert.Equal(t, "/tmp/cache/hd", net.DefaultCacheDir())
+
+	t.Setenv("XDG_CACHE_HOME", "")
+	assert.True(t, strings.HasSuffix(net.DefaultCacheDir(), path.Join(".cache", "hd")))
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := net.NewCache(path.Join(dir, "cache"))
+
+	entries, err := cache.List()
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+	assert.Nil(t, cache.Get("https://foo.com/a"))
+
+	file := path.Join(dir, "hello")
+	assert.Nil(t, os.WriteFile(file, []byte("hello"), 0600))
+	entry, err := cache.Put("https://foo.com/a", `"v1"`, "", file)
+	assert.Nil(t, err)
+	assert.Equal(t, "sha256:"+helloSha256, entry.Digest)
+	assert.Equal(t, int64(5), entry.Size)
+	assert.True(t, entry.Matches(`"v1"`, "", 5))
+	assert.False(t, entry.Matches(`"v2"`, "", 5))
+	assert.False(t, entry.Matches(`"v1"`, "", 6))
+
+	// the same content is shared by different URLs
+	_, err = cache.Put("https://mirror.foo.com/a", "", "Mon, 02 Jan 2006 15:04:05 GMT", file)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(file, []byte("hello world"), 0600))
+	_, err = cache.Put("https://foo.com/b", `"v1"`, "", file)
+	assert.Nil(t, err)
+
+	entry = cache.Get("https://mirror.foo.com/a")
+	if assert.NotNil(t, entry) {
+		assert.True(t, entry.Matches("", "Mon, 02 Jan 2006 15:04:05 GMT", -1))
+		f, err := cache.Open(entry)
+		assert.Nil(t, err)
+		buf := new(bytes.Buffer)
+		_, _ = buf.ReadFrom(f)
+		_ = f.Close()
+		assert.Equal(t, "hello", buf.String())
+	}
+
+	entries, err = cache.List()
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(entries)) {
+		// the recent used one goes first
+		assert.Equal(t, "https://mirror.foo.com/a", entries[0].URL)
+	}
+
+	// the total size is 16 bytes, the removed entry shares the content with the kept one
+	removed, err := cache.Prune(10, 0)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(removed)) {
+		assert.Equal(t, "https://foo.com/a", removed[0].URL)
+		assert.Equal(t, "https://foo.com/b", removed[1].URL)
+	}
+	assert.NotNil(t, cache.Get("https://mirror.foo.com/a"))
+	blobs, err := os.ReadDir(path.Join(dir, "cache", "blobs", "sha256"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(blobs))
+
+	removed, err = cache.Prune(0, time.Nanosecond)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(removed))
+	entries, err = cache.List()
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+	blobs, err = os.ReadDir(path.Join(dir, "cache", "blobs", "sha256"))
+	assert.Nil(t, err)
+	assert.Empty(t, blobs)
+
+	assert.Nil(t, cache.Clean())
+	assert.NoDirExists(t, path.Join(dir, "cache"))
+}
+
+func TestDownloadWithCache(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	var fullRequests, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+		} else if r.Header.Get("Range") == "" || r.Header.Get("Range") == "bytes=0-" {
+			atomic.AddInt32(&fullRequests, 1)
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cache := net.NewCache(path.Join(dir, "cache"))
+	for i := 0; i < 2; i++ {
+		buf := new(bytes.Buffer)
+		downloader := &net.HTTPDownloader{URL: server.URL, Cache: cache}
+		assert.Nil(t, downloader.DownloadAsStream(buf))
+		assert.Equal(t, content, buf.String())
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fullRequests))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+
+	// the range request does not use the cache
+	downloader := &net.ContinueDownloader{}
+	buf := new(bytes.Buffer)
+	assert.Nil(t, downloader.WithCache(cache).DownloadWithContinueAsStream(server.URL, buf, -1, 10, 19, false))
+	assert.Equal(t, content[10:20], buf.String())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+
+	// the multi-thread downloader takes the cached file if the validators match
+	targetFile := path.Join(dir, "target")
+	multiThreadDownloader := &net.MultiThreadDownloader{}
+	multiThreadDownloader.WithShowProgress(false).WithCache(cache)
+	assert.Nil(t, multiThreadDownloader.Download(server.URL, targetFile, 2))
+	data, err := os.ReadFile(targetFile)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fullRequests))
+}
@@ -0,0 +1,215 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Checksum represents the expected digest of a file
+type Checksum struct {
+	// Algorithm could be sha256, sha512, sha1 or md5
+	Algorithm string
+	// Value is the hex encoded digest
+	Value string
+}
+
+// String returns the checksum in the format of <algorithm>:<hex>
+func (c *Checksum) String() string {
+	return fmt.Sprintf("%s:%s", c.Algorithm, c.Value)
+}
+
+// ChecksumError represents the mismatch between the expected and actual checksum
+type ChecksumError struct {
+	File     string
+	Expected Checksum
+	Actual   string
+}
+
+// Error print the error message
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch of '%s', expected %s, actual: %s", e.File, e.Expected.String(), e.Actual)
+}
+
+// hash lengths of the hex encoded digest, it helps to guess the algorithm
+var checksumHexLength = map[int]string{
+	sha512.Size * 2: "sha512",
+	sha256.Size * 2: "sha256",
+	sha1.Size * 2:   "sha1",
+	md5.Size * 2:    "md5",
+}
+
+// ParseChecksum parses the text like sha256:<hex>. The algorithm will be guessed
+// by the length of the digest if there's no prefix.
+func ParseChecksum(text string) (checksum *Checksum, err error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		err = fmt.Errorf("checksum cannot be empty")
+		return
+	}
+
+	checksum = &Checksum{}
+	if index := strings.Index(text, ":"); index != -1 {
+		checksum.Algorithm = normalizeHashAlgorithm(text[:index])
+		checksum.Value = strings.ToLower(text[index+1:])
+	} else {
+		checksum.Value = strings.ToLower(text)
+		checksum.Algorithm = checksumHexLength[len(checksum.Value)]
+	}
+
+	if _, err = hex.DecodeString(checksum.Value); err != nil {
+		err = fmt.Errorf("invalid checksum '%s', error: %v", text, err)
+	} else if _, err = checksum.NewHash(); err == nil && len(checksum.Value) != hashHexLength(checksum.Algorithm) {
+		err = fmt.Errorf("invalid length of %s checksum: '%s'", checksum.Algorithm, checksum.Value)
+	}
+	if err != nil {
+		checksum = nil
+	}
+	return
+}
+
+func normalizeHashAlgorithm(algorithm string) string {
+	algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+	return strings.ReplaceAll(algorithm, "-", "")
+}
+
+func hashHexLength(algorithm string) int {
+	for length, item := range checksumHexLength {
+		if item == algorithm {
+			return length
+		}
+	}
+	return 0
+}
+
+// NewHash returns a hash instance according to the algorithm
+func (c *Checksum) NewHash() (h hash.Hash, err error) {
+	switch c.Algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	case "sha1":
+		h = sha1.New()
+	case "md5":
+		h = md5.New()
+	default:
+		err = fmt.Errorf("not support checksum algorithm: '%s'", c.Algorithm)
+	}
+	return
+}
+
+// VerifyReader reads all the data from the reader, then compares the digest
+func (c *Checksum) VerifyReader(reader io.Reader, name string) (err error) {
+	var h hash.Hash
+	if h, err = c.NewHash(); err != nil {
+		return
+	}
+
+	if _, err = io.Copy(h, reader); err == nil {
+		err = c.VerifyHash(h, name)
+	}
+	return
+}
+
+// VerifyHash compares the digest of the hash which has taken all the data, it's useful
+// when the data is hashed while it's being written
+func (c *Checksum) VerifyHash(h hash.Hash, name string) (err error) {
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != c.Value {
+		err = &ChecksumError{
+			File:     name,
+			Expected: *c,
+			Actual:   actual,
+		}
+	}
+	return
+}
+
+// Verify checks if the file matches the checksum
+func (c *Checksum) Verify(filePath string) (err error) {
+	var f *os.File
+	if f, err = os.Open(filePath); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	err = c.VerifyReader(f, filePath)
+	return
+}
+
+// FindChecksum finds the checksum of the target file from the content of a checksum file.
+// It supports the output format of sha256sum (and similar commands), the BSD style, and
+// a single digest without the filename. The algorithm could be given when it cannot be guessed.
+func FindChecksum(content []byte, filename, algorithm string) (checksum *Checksum, err error) {
+	filename = path.Base(filename)
+	var candidates []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var digest, name, lineAlgorithm string
+		// BSD style: SHA256 (filename) = <hex>
+		if left, right, ok := strings.Cut(line, ") = "); ok {
+			if alg, file, ok := strings.Cut(left, " ("); ok {
+				lineAlgorithm, name, digest = alg, file, right
+			}
+		}
+
+		if digest == "" {
+			fields := strings.Fields(line)
+			digest = fields[0]
+			if len(fields) > 1 {
+				name = strings.TrimPrefix(fields[1], "*")
+			}
+		}
+
+		if name == "" {
+			candidates = append(candidates, digest)
+		} else if path.Base(name) == filename {
+			return parseChecksumWithAlgorithm(digest, lineAlgorithm, algorithm)
+		}
+	}
+
+	if len(candidates) == 1 {
+		checksum, err = parseChecksumWithAlgorithm(candidates[0], "", algorithm)
+	} else {
+		err = fmt.Errorf("cannot find the checksum of '%s'", filename)
+	}
+	return
+}
+
+func parseChecksumWithAlgorithm(digest string, algorithms ...string) (*Checksum, error) {
+	for _, algorithm := range algorithms {
+		if algorithm != "" {
+			return ParseChecksum(fmt.Sprintf("%s:%s", algorithm, digest))
+		}
+	}
+	return ParseChecksum(digest)
+}
+
+// GuessChecksumAlgorithm guesses the checksum algorithm by the suffix of the checksum file
+func GuessChecksumAlgorithm(checksumURL string) (algorithm string) {
+	ext := normalizeHashAlgorithm(strings.TrimPrefix(path.Ext(checksumURL), "."))
+	for _, item := range checksumHexLength {
+		if ext == item || ext == item+"sum" {
+			algorithm = item
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,139 @@
+package net_test
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	helloSha256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	helloMd5    = "5d41402abc4b2a76b9719d911017c592"
+)
+
+func TestParseChecksum(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		expect *net.Checksum
+		hasErr bool
+	}{{
+		name:   "with algorithm prefix",
+		text:   "sha256:" + helloSha256,
+		expect: &net.Checksum{Algorithm: "sha256", Value: helloSha256},
+	}, {
+		name:   "algorithm in upper case",
+		text:   "SHA-256:" + helloSha256,
+		expect: &net.Checksum{Algorithm: "sha256", Value: helloSha256},
+	}, {
+		name:   "guess the algorithm",
+		text:   helloMd5,
+		expect: &net.Checksum{Algorithm: "md5", Value: helloMd5},
+	}, {
+		name:   "empty",
+		hasErr: true,
+	}, {
+		name:   "not hex",
+		text:   "sha256:xyz",
+		hasErr: true,
+	}, {
+		name:   "unknown algorithm",
+		text:   "sha3:" + helloSha256,
+		hasErr: true,
+	}, {
+		name:   "length does not match the algorithm",
+		text:   "sha256:" + helloMd5,
+		hasErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checksum, err := net.ParseChecksum(tt.text)
+			assert.Equal(t, tt.hasErr, err != nil, err)
+			assert.Equal(t, tt.expect, checksum)
+		})
+	}
+}
+
+func TestChecksumVerify(t *testing.T) {
+	dir := t.TempDir()
+	file := path.Join(dir, "hello")
+	assert.Nil(t, os.WriteFile(file, []byte("hello"), 0600))
+
+	checksum, err := net.ParseChecksum("sha256:" + helloSha256)
+	assert.Nil(t, err)
+	assert.Nil(t, checksum.Verify(file))
+
+	checksum, err = net.ParseChecksum("md5:" + helloMd5)
+	assert.Nil(t, err)
+	assert.Nil(t, checksum.VerifyReader(bytes.NewBufferString("hello"), "hello"))
+
+	err = checksum.VerifyReader(bytes.NewBufferString("hello world"), "hello")
+	if assert.NotNil(t, err) {
+		checksumErr, ok := err.(*net.ChecksumError)
+		assert.True(t, ok)
+		assert.Equal(t, "hello", checksumErr.File)
+		assert.Contains(t, err.Error(), helloMd5)
+	}
+
+	assert.NotNil(t, checksum.Verify(path.Join(dir, "not-exist")))
+}
+
+func TestFindChecksum(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		filename  string
+		algorithm string
+		expect    *net.Checksum
+		hasErr    bool
+	}{{
+		name:     "sha256sum format",
+		content:  helloMd5 + "  other.tar.gz\n" + helloSha256 + "  hd-linux-amd64.tar.gz\n",
+		filename: "hd-linux-amd64.tar.gz",
+		expect:   &net.Checksum{Algorithm: "sha256", Value: helloSha256},
+	}, {
+		name:     "binary mode",
+		content:  helloSha256 + " *dist/hd-linux-amd64.tar.gz\n",
+		filename: "/tmp/hd-linux-amd64.tar.gz",
+		expect:   &net.Checksum{Algorithm: "sha256", Value: helloSha256},
+	}, {
+		name:     "BSD style",
+		content:  "MD5 (hd.tar.gz) = " + helloMd5,
+		filename: "hd.tar.gz",
+		expect:   &net.Checksum{Algorithm: "md5", Value: helloMd5},
+	}, {
+		name:     "single digest",
+		content:  "# comment\n" + helloSha256 + "\n",
+		filename: "hd.tar.gz",
+		expect:   &net.Checksum{Algorithm: "sha256", Value: helloSha256},
+	}, {
+		name:      "with the given algorithm",
+		content:   helloMd5,
+		filename:  "hd.tar.gz",
+		algorithm: "md5",
+		expect:    &net.Checksum{Algorithm: "md5", Value: helloMd5},
+	}, {
+		name:     "not found",
+		content:  helloSha256 + "  other.tar.gz\n",
+		filename: "hd.tar.gz",
+		hasErr:   true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checksum, err := net.FindChecksum([]byte(tt.content), tt.filename, tt.algorithm)
+			assert.Equal(t, tt.hasErr, err != nil, err)
+			assert.Equal(t, tt.expect, checksum)
+		})
+	}
+}
+
+func TestGuessChecksumAlgorithm(t *testing.T) {
+	assert.Equal(t, "sha256", net.GuessChecksumAlgorithm("https://foo.com/hd.tar.gz.sha256"))
+	assert.Equal(t, "sha512", net.GuessChecksumAlgorithm("https://foo.com/hd.tar.gz.sha512sum"))
+	assert.Equal(t, "md5", net.GuessChecksumAlgorithm("https://foo.com/hd.tar.gz.md5"))
+	assert.Equal(t, "", net.GuessChecksumAlgorithm("https://foo.com/checksums.txt"))
+}
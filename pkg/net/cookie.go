@@ -0,0 +1,104 @@
+package net
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpOnlyPrefix is the prefix of the domain of a HttpOnly cookie in the Netscape cookie file
+const httpOnlyPrefix = "#HttpOnly_"
+
+// LoadCookieJar loads the cookies from a Netscape format file which is exported by browsers or curl.
+// The cookies of the responses are kept in the jar as well.
+func LoadCookieJar(filePath string) (jar http.CookieJar, err error) {
+	var f *os.File
+	if f, err = os.Open(filePath); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if jar, err = cookiejar.New(nil); err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		var targetURL *url.URL
+		var cookie *http.Cookie
+		if targetURL, cookie, err = parseNetscapeCookie(scanner.Text()); err != nil {
+			err = fmt.Errorf("invalid cookie at line %d of '%s', %v", lineNum, filePath, err)
+			return
+		} else if cookie != nil {
+			jar.SetCookies(targetURL, []*http.Cookie{cookie})
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+// parseNetscapeCookie parses a line of the Netscape cookie file, the format is:
+//
+//	domain	include subdomains	path	secure	expiry	name	value
+//
+// it returns nil if the line is a comment or the cookie was expired
+func parseNetscapeCookie(line string) (targetURL *url.URL, cookie *http.Cookie, err error) {
+	line = strings.TrimSpace(line)
+	httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+	if httpOnly {
+		line = strings.TrimPrefix(line, httpOnlyPrefix)
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	fields := strings.Split(line, "\t")
+	if len(fields) == 6 {
+		// the value is empty
+		fields = append(fields, "")
+	}
+	if len(fields) != 7 {
+		err = fmt.Errorf("expected 7 fields separated by tabs, got %d", len(fields))
+		return
+	}
+
+	var expiry int64
+	if expiry, err = strconv.ParseInt(fields[4], 10, 64); err != nil {
+		err = fmt.Errorf("invalid expiry '%s'", fields[4])
+		return
+	}
+	if expiry > 0 && time.Unix(expiry, 0).Before(time.Now()) {
+		return
+	}
+
+	host := strings.TrimPrefix(fields[0], ".")
+	secure := strings.EqualFold(fields[3], "TRUE")
+	cookie = &http.Cookie{
+		Name:     fields[5],
+		Value:    fields[6],
+		Path:     fields[2],
+		Secure:   secure,
+		HttpOnly: httpOnly,
+	}
+	if strings.EqualFold(fields[1], "TRUE") {
+		cookie.Domain = host
+	}
+	if expiry > 0 {
+		cookie.Expires = time.Unix(expiry, 0)
+	}
+
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+	targetURL = &url.URL{Scheme: scheme, Host: host, Path: fields[2]}
+	return
+}
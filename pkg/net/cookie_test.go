@@ -0,0 +1,107 @@
+package net_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadCookieJar(t *testing.T) {
+	dir := t.TempDir()
+	cookieFile := path.Join(dir, "cookies.txt")
+	expiry := time.Now().Add(time.Hour).Unix()
+	assert.Nil(t, os.WriteFile(cookieFile, []byte(fmt.Sprintf(`# Netscape HTTP Cookie File
+
+.foo.com	TRUE	/	FALSE	0	session	abc
+#HttpOnly_bar.com	FALSE	/download	TRUE	%d	token	def
+bar.com	FALSE	/	FALSE	1	expired	ghi
+bar.com	FALSE	/	FALSE	0	empty
+`, expiry)), 0600))
+
+	jar, err := net.LoadCookieJar(cookieFile)
+	assert.Nil(t, err)
+
+	cookies := func(targetURL string) (result []string) {
+		urlObj, _ := url.Parse(targetURL)
+		for _, cookie := range jar.Cookies(urlObj) {
+			result = append(result, cookie.String())
+		}
+		return
+	}
+	assert.Equal(t, []string{"session=abc"}, cookies("http://www.foo.com/a"))
+	assert.Equal(t, []string{"token=def", "empty="}, cookies("https://bar.com/download/a"))
+	assert.Equal(t, []string{"empty="}, cookies("http://bar.com/download/a"))
+	assert.Empty(t, cookies("http://sub.bar.com/download/a"))
+
+	assert.Nil(t, os.WriteFile(cookieFile, []byte("foo.com\tTRUE\t/\tFALSE\tinvalid\tname\tvalue"), 0600))
+	_, err = net.LoadCookieJar(cookieFile)
+	assert.NotNil(t, err)
+	assert.Nil(t, os.WriteFile(cookieFile, []byte("foo.com TRUE / FALSE 0 name value"), 0600))
+	_, err = net.LoadCookieJar(cookieFile)
+	assert.NotNil(t, err)
+	_, err = net.LoadCookieJar(path.Join(dir, "missing"))
+	assert.NotNil(t, err)
+}
+
+func TestDownloadWithCookiesAndHeaders(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	var rejected int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "hd-test" || r.Header.Get("X-Token") != "abc" {
+			atomic.AddInt32(&rejected, 1)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "def" {
+			atomic.AddInt32(&rejected, 1)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	cookieFile := path.Join(t.TempDir(), "cookies.txt")
+	assert.Nil(t, os.WriteFile(cookieFile, []byte(serverURL.Hostname()+"\tFALSE\t/\tFALSE\t0\tsession\tdef\n"), 0600))
+	jar, err := net.LoadCookieJar(cookieFile)
+	assert.Nil(t, err)
+	header := map[string]string{"User-Agent": "hd-test", "X-Token": "abc"}
+
+	total, rangeSupport, err := net.DetectSizeWithHeader(server.URL, path.Join(t.TempDir(), "detect"), false, false,
+		nil, "", "", header, jar, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), total)
+	assert.True(t, rangeSupport)
+
+	buf := new(bytes.Buffer)
+	downloader := &net.ContinueDownloader{}
+	downloader.WithHeader(header).WithCookieJar(jar).WithRetryPolicy(net.DefaultRetryPolicy().WithoutRetry())
+	assert.Nil(t, downloader.DownloadWithContinueAsStream(server.URL, buf, -1, 10, 19, false))
+	assert.Equal(t, content[10:20], buf.String())
+
+	targetFile := path.Join(t.TempDir(), "target")
+	multiThreadDownloader := &net.MultiThreadDownloader{}
+	multiThreadDownloader.WithShowProgress(false).WithHeader(header).WithCookieJar(jar).WithMaxAttempts(0)
+	assert.Nil(t, multiThreadDownloader.Download(server.URL, targetFile, 1))
+	data, err := os.ReadFile(targetFile)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&rejected))
+
+	// the request is rejected without the cookie
+	assert.NotNil(t, (&net.ContinueDownloader{}).WithHeader(header).WithRetryPolicy(net.DefaultRetryPolicy().WithoutRetry()).
+		DownloadWithContinueAsStream(server.URL, buf, -1, 0, 0, false))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&rejected))
+}
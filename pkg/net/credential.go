@@ -0,0 +1,424 @@
+package net
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/common"
+	"github.com/mitchellh/go-homedir"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// CredentialBasic is the type of the HTTP basic auth
+	CredentialBasic = "basic"
+	// CredentialBearer is the type of the bearer token
+	CredentialBearer = "bearer"
+	// CredentialHeader is the type of the custom headers, for instance: PRIVATE-TOKEN of GitLab
+	CredentialHeader = "header"
+	// CredentialAWSSigV4 is the type of the AWS Signature Version 4, the username is the access key ID,
+	// the password is the secret access key, and the token is the optional session token
+	CredentialAWSSigV4 = "aws-sigv4"
+)
+
+// Credential is the credential of a host. The host could be a hostname, hostname with port,
+// or a wildcard like *.foo.com. An empty host matches all the hosts. The header is sent with the
+// other types of credential as well.
+type Credential struct {
+	Host     string            `yaml:"host"`
+	Type     string            `yaml:"type,omitempty"`
+	Username string            `yaml:"username,omitempty"`
+	Password string            `yaml:"password,omitempty"`
+	Token    string            `yaml:"token,omitempty"`
+	Header   map[string]string `yaml:"header,omitempty"`
+	// Region and Service are the scope of the AWS Signature Version 4, the default ones are us-east-1 and s3
+	Region  string `yaml:"region,omitempty"`
+	Service string `yaml:"service,omitempty"`
+}
+
+// CredentialResolver finds the credential of the target URL
+type CredentialResolver interface {
+	Resolve(targetURL *url.URL) *Credential
+}
+
+// CredentialChain finds the credential by the resolvers in order, the first found one is returned
+type CredentialChain []CredentialResolver
+
+// Resolve returns the credential of the first resolver which has it
+func (c CredentialChain) Resolve(targetURL *url.URL) *Credential {
+	for _, resolver := range c {
+		if resolver == nil {
+			continue
+		}
+		if credential := resolver.Resolve(targetURL); credential != nil {
+			return credential
+		}
+	}
+	return nil
+}
+
+// WithHostCredential puts the credential of the username and password before the resolver, it's only used
+// by the host of the target URL. The password is the bearer token if there's no username. The resolver is
+// returned directly if both of them are empty.
+func WithHostCredential(resolver CredentialResolver, targetURL, username, password string) CredentialResolver {
+	if username == "" && password == "" {
+		return resolver
+	}
+	// the URL without a host, for instance: a relative one, takes the credential of all the hosts
+	var host string
+	if u, err := url.Parse(targetURL); err == nil {
+		host = u.Host
+	}
+
+	credential := &Credential{Host: host, Type: CredentialBasic, Username: username, Password: password}
+	if username == "" {
+		credential = &Credential{Host: host, Type: CredentialBearer, Token: password}
+	}
+	return CredentialChain{&CredentialStore{Credentials: []*Credential{credential}}, resolver}
+}
+
+// WithHostHeader sends the header to the host of the target URL together with the credential of the
+// resolver, for instance: the cookies. The credential is not used if the header has the Authorization.
+func WithHostHeader(resolver CredentialResolver, targetURL string, header map[string]string) CredentialResolver {
+	if len(header) == 0 {
+		return resolver
+	}
+	// the URL without a host, for instance: a relative one, takes the header of all the hosts
+	var host string
+	if u, err := url.Parse(targetURL); err == nil {
+		host = u.Host
+	}
+	return &hostHeaderResolver{resolver: resolver, host: host, header: header}
+}
+
+type hostHeaderResolver struct {
+	resolver CredentialResolver
+	host     string
+	header   map[string]string
+}
+
+// Resolve returns the credential of the resolver, it carries the header if it's the host of the target URL
+func (r *hostHeaderResolver) Resolve(targetURL *url.URL) *Credential {
+	var credential *Credential
+	if r.resolver != nil {
+		credential = r.resolver.Resolve(targetURL)
+	}
+	if (&Credential{Host: r.host}).matches(targetURL) == 0 {
+		return credential
+	}
+
+	authorized := false
+	for k := range r.header {
+		authorized = authorized || http.CanonicalHeaderKey(k) == "Authorization"
+	}
+	if credential == nil || authorized {
+		return &Credential{Host: r.host, Type: CredentialHeader, Header: r.header}
+	}
+
+	merged := *credential
+	merged.Header = make(map[string]string, len(credential.Header)+len(r.header))
+	for k, v := range credential.Header {
+		merged.Header[k] = v
+	}
+	for k, v := range r.header {
+		merged.Header[k] = v
+	}
+	return &merged
+}
+
+// CredentialStore holds the credentials, the first one goes first if there are many matched ones
+type CredentialStore struct {
+	Credentials []*Credential
+}
+
+// credentialFile is the format of credentials.yaml
+type credentialFile struct {
+	Credentials []*Credential `yaml:"credentials"`
+}
+
+// Apply sets the credential to the request
+func (c *Credential) Apply(req *http.Request) {
+	for k, v := range c.Header {
+		// keep the cookies of the cookie jar
+		if existing := req.Header.Get(k); existing != "" && http.CanonicalHeaderKey(k) == "Cookie" {
+			v = existing + "; " + v
+		}
+		req.Header.Set(k, v)
+	}
+
+	switch c.Type {
+	case CredentialBasic:
+		req.SetBasicAuth(c.Username, c.Password)
+	case CredentialBearer:
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case CredentialAWSSigV4:
+		signAWSv4(req, c, time.Now())
+	}
+}
+
+// validate guesses the type if it's empty, and checks the required fields
+func (c *Credential) validate() (err error) {
+	if c.Type == "" {
+		switch {
+		case len(c.Header) > 0:
+			c.Type = CredentialHeader
+		case c.Token != "":
+			c.Type = CredentialBearer
+		default:
+			c.Type = CredentialBasic
+		}
+	}
+
+	switch c.Type {
+	case CredentialBasic:
+		if c.Username == "" && c.Password == "" {
+			err = fmt.Errorf("username or password is required by the basic credential of '%s'", c.Host)
+		}
+	case CredentialBearer:
+		if c.Token == "" {
+			err = fmt.Errorf("token is required by the bearer credential of '%s'", c.Host)
+		}
+	case CredentialHeader:
+		if len(c.Header) == 0 {
+			err = fmt.Errorf("header is required by the header credential of '%s'", c.Host)
+		}
+	case CredentialAWSSigV4:
+		if c.Username == "" || c.Password == "" {
+			err = fmt.Errorf("username and password are required by the aws-sigv4 credential of '%s'", c.Host)
+		}
+	default:
+		err = fmt.Errorf("unknown credential type '%s' of '%s', it should be basic, bearer, header or aws-sigv4",
+			c.Type, c.Host)
+	}
+	return
+}
+
+// matches returns the score of the host matching, zero means not matched.
+// The host with port is better than the hostname, and the hostname is better than the wildcard.
+func (c *Credential) matches(targetURL *url.URL) int {
+	host := strings.ToLower(c.Host)
+	switch {
+	case host == "":
+		return 1
+	case strings.HasPrefix(host, "*."):
+		if strings.HasSuffix(strings.ToLower(targetURL.Hostname()), host[1:]) {
+			return 2
+		}
+	case strings.Contains(host, ":"):
+		if host == strings.ToLower(targetURL.Host) {
+			return 4
+		}
+	case host == strings.ToLower(targetURL.Hostname()):
+		return 3
+	}
+	return 0
+}
+
+// Resolve returns the best matched credential, returns nil if there's no one
+func (s *CredentialStore) Resolve(targetURL *url.URL) (credential *Credential) {
+	if s == nil || targetURL == nil {
+		return
+	}
+
+	var best int
+	for _, item := range s.Credentials {
+		if score := item.matches(targetURL); score > best {
+			best = score
+			credential = item
+		}
+	}
+	return
+}
+
+// DefaultCredentialFile returns the path of the credential file which is ~/.config/hd/credentials.yaml
+func DefaultCredentialFile() string {
+	userHome, err := homedir.Dir()
+	if err != nil {
+		userHome = os.TempDir()
+	}
+	return filepath.Join(userHome, ".config", "hd", "credentials.yaml")
+}
+
+// DefaultNetrcFile returns the path of the netrc file which could be changed by the environment variable NETRC
+func DefaultNetrcFile() string {
+	if netrc := common.GetEnvironment("NETRC"); netrc != "" {
+		return netrc
+	}
+
+	userHome, err := homedir.Dir()
+	if err != nil {
+		userHome = os.TempDir()
+	}
+	return filepath.Join(userHome, ".netrc")
+}
+
+// LoadCredentialStore loads the credentials from the credential file and the netrc file, the missing files
+// are ignored. The credentials of the credential file take precedence over the netrc file.
+func LoadCredentialStore(credentialFilePath, netrcFilePath string) (store *CredentialStore, err error) {
+	store = &CredentialStore{}
+	var credentials []*Credential
+	if credentials, err = LoadCredentialFile(credentialFilePath); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	store.Credentials = append(store.Credentials, credentials...)
+
+	if credentials, err = LoadNetrc(netrcFilePath); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	store.Credentials = append(store.Credentials, credentials...)
+	err = nil
+	return
+}
+
+// LoadCredentialFile loads the credentials from a YAML file, for instance:
+//
+//	credentials:
+//	- host: foo.com
+//	  username: user
+//	  password: pass
+//	- host: "*.bar.com"
+//	  token: token
+//	- host: gitlab.com
+//	  header:
+//	    PRIVATE-TOKEN: token
+//	- host: minio.foo.com:9000
+//	  type: aws-sigv4
+//	  username: access-key-id
+//	  password: secret-access-key
+func LoadCredentialFile(filePath string) (credentials []*Credential, err error) {
+	var data []byte
+	if data, err = os.ReadFile(filePath); err != nil {
+		return
+	}
+
+	file := &credentialFile{}
+	if err = yaml.Unmarshal(data, file); err != nil {
+		err = fmt.Errorf("failed to parse the credential file '%s', error: %v", filePath, err)
+		return
+	}
+
+	for _, credential := range file.Credentials {
+		if credential == nil {
+			continue
+		}
+		if err = credential.validate(); err != nil {
+			err = fmt.Errorf("invalid credential file '%s', %v", filePath, err)
+			return
+		}
+		credentials = append(credentials, credential)
+	}
+	return
+}
+
+// LoadNetrc loads the credentials from a netrc file. The default entry goes last, it matches all the hosts.
+func LoadNetrc(filePath string) (credentials []*Credential, err error) {
+	var f *os.File
+	if f, err = os.Open(filePath); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for inMacro := false; scanner.Scan(); {
+		line := strings.TrimSpace(scanner.Text())
+		if inMacro {
+			// a macro ends with an empty line
+			inMacro = line != ""
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i, field := range fields {
+			if field == "macdef" {
+				fields = fields[:i]
+				inMacro = true
+				break
+			}
+		}
+		tokens = append(tokens, fields...)
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+
+	var entries []*Credential
+	var current, defaultCredential *Credential
+	for i := 0; i < len(tokens); i++ {
+		var value string
+		if i+1 < len(tokens) {
+			value = tokens[i+1]
+		}
+
+		switch tokens[i] {
+		case "machine":
+			current = &Credential{Host: value, Type: CredentialBasic}
+			entries = append(entries, current)
+			i++
+		case "default":
+			current = &Credential{Type: CredentialBasic}
+			defaultCredential = current
+		case "login", "password", "account":
+			if current == nil {
+				err = fmt.Errorf("invalid netrc file '%s', '%s' should be after machine or default", filePath, tokens[i])
+				return
+			}
+			if tokens[i] == "login" {
+				current.Username = value
+			} else if tokens[i] == "password" {
+				current.Password = value
+			}
+			i++
+		}
+	}
+
+	if defaultCredential != nil {
+		entries = append(entries, defaultCredential)
+	}
+	for _, entry := range entries {
+		if entry.Username != "" || entry.Password != "" {
+			credentials = append(credentials, entry)
+		}
+	}
+	return
+}
+
+// NewCredentialTransport returns a RoundTripper which sets the credential of each request according to
+// its host, including the redirected ones. The request which has the Authorization header is not changed.
+func NewCredentialTransport(base http.RoundTripper, resolver CredentialResolver) http.RoundTripper {
+	if resolver == nil {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &credentialTransport{base: base, resolver: resolver}
+}
+
+type credentialTransport struct {
+	base     http.RoundTripper
+	resolver CredentialResolver
+}
+
+// RoundTrip sets the credential, then sends the request by the base RoundTripper
+func (t *credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") == "" {
+		if credential := t.resolver.Resolve(req.URL); credential != nil {
+			// the RoundTripper should not modify the request
+			req = req.Clone(req.Context())
+			credential.Apply(req)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,203 @@
+package net_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadNetrc(t *testing.T) {
+	netrcFile := path.Join(t.TempDir(), ".netrc")
+	assert.Nil(t, os.WriteFile(netrcFile, []byte(`# comment
+machine foo.com login user password pass
+machine bar.com
+  login bar
+  account ignored
+  password secret
+macdef init
+cd /pub
+machine ignored.com login ignored
+
+machine empty.com
+default login anonymous password guest
+`), 0600))
+
+	credentials, err := net.LoadNetrc(netrcFile)
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.Credential{
+		{Host: "foo.com", Type: net.CredentialBasic, Username: "user", Password: "pass"},
+		{Host: "bar.com", Type: net.CredentialBasic, Username: "bar", Password: "secret"},
+		{Type: net.CredentialBasic, Username: "anonymous", Password: "guest"},
+	}, credentials)
+
+	assert.Nil(t, os.WriteFile(netrcFile, []byte("login user"), 0600))
+	_, err = net.LoadNetrc(netrcFile)
+	assert.NotNil(t, err)
+}
+
+func TestLoadCredentialFile(t *testing.T) {
+	credentialFile := path.Join(t.TempDir(), "credentials.yaml")
+	assert.Nil(t, os.WriteFile(credentialFile, []byte(`credentials:
+- host: foo.com
+  username: user
+  password: pass
+- host: "*.bar.com"
+  token: token
+- host: gitlab.com:8443
+  header:
+    PRIVATE-TOKEN: abc
+- host: minio.foo.com:9000
+  type: aws-sigv4
+  username: key
+  password: secret
+`), 0600))
+
+	credentials, err := net.LoadCredentialFile(credentialFile)
+	assert.Nil(t, err)
+	if assert.Equal(t, 4, len(credentials)) {
+		assert.Equal(t, net.CredentialBasic, credentials[0].Type)
+		assert.Equal(t, net.CredentialBearer, credentials[1].Type)
+		assert.Equal(t, net.CredentialHeader, credentials[2].Type)
+		assert.Equal(t, net.CredentialAWSSigV4, credentials[3].Type)
+	}
+
+	invalidFiles := []string{
+		"invalid",
+		"credentials:\n- host: foo.com",
+		"credentials:\n- host: foo.com\n  type: bearer",
+		"credentials:\n- host: foo.com\n  type: header",
+		"credentials:\n- host: foo.com\n  type: aws-sigv4\n  username: key",
+		"credentials:\n- host: foo.com\n  type: unknown\n  token: abc",
+	}
+	for _, content := range invalidFiles {
+		assert.Nil(t, os.WriteFile(credentialFile, []byte(content), 0600))
+		_, err = net.LoadCredentialFile(credentialFile)
+		assert.NotNil(t, err, content)
+	}
+}
+
+func TestCredentialStore(t *testing.T) {
+	dir := t.TempDir()
+	credentialFile := path.Join(dir, "credentials.yaml")
+	netrcFile := path.Join(dir, ".netrc")
+
+	// the missing files are ignored
+	store, err := net.LoadCredentialStore(credentialFile, netrcFile)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Resolve(&url.URL{Host: "foo.com"}))
+
+	assert.Nil(t, os.WriteFile(credentialFile, []byte(`credentials:
+- host: foo.com
+  token: from-yaml
+- host: "*.foo.com"
+  token: wildcard
+- host: foo.com:8443
+  token: with-port
+`), 0600))
+	assert.Nil(t, os.WriteFile(netrcFile, []byte(`machine foo.com login user password from-netrc
+machine bar.com login user password bar
+default login anonymous password guest`), 0600))
+	store, err = net.LoadCredentialStore(credentialFile, netrcFile)
+	assert.Nil(t, err)
+
+	resolve := func(host string) string {
+		credential := store.Resolve(&url.URL{Scheme: "https", Host: host})
+		if credential.Token != "" {
+			return credential.Token
+		}
+		return credential.Password
+	}
+	assert.Equal(t, "from-yaml", resolve("foo.com"))
+	assert.Equal(t, "with-port", resolve("foo.com:8443"))
+	assert.Equal(t, "wildcard", resolve("sub.foo.com"))
+	assert.Equal(t, "bar", resolve("bar.com"))
+	assert.Equal(t, "guest", resolve("other.com"))
+
+	var nilStore *net.CredentialStore
+	assert.Nil(t, nilStore.Resolve(&url.URL{Host: "foo.com"}))
+
+	// the chain goes through the resolvers in order
+	chain := net.CredentialChain{
+		&net.CredentialStore{Credentials: []*net.Credential{{Host: "bar.com", Token: "from-chain"}}}, nil, store}
+	assert.Equal(t, "from-chain", chain.Resolve(&url.URL{Host: "bar.com"}).Token)
+	assert.Equal(t, "from-yaml", chain.Resolve(&url.URL{Host: "foo.com"}).Token)
+	assert.Nil(t, net.CredentialChain{nilStore}.Resolve(&url.URL{Host: "foo.com"}))
+
+	assert.Nil(t, os.WriteFile(credentialFile, []byte("invalid"), 0600))
+	_, err = net.LoadCredentialStore(credentialFile, netrcFile)
+	assert.NotNil(t, err)
+}
+
+func TestDownloadWithCredentials(t *testing.T) {
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "mirror-token" || r.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer mirror.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// redirect to another host which takes its own credential
+		http.Redirect(w, r, mirror.URL, http.StatusFound)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	mirrorURL, _ := url.Parse(mirror.URL)
+	store := &net.CredentialStore{Credentials: []*net.Credential{
+		{Host: serverURL.Host, Type: net.CredentialBasic, Username: "user", Password: "pass"},
+		{Host: mirrorURL.Host, Type: net.CredentialHeader, Header: map[string]string{"PRIVATE-TOKEN": "mirror-token"}},
+	}}
+
+	buf := new(bytes.Buffer)
+	downloader := &net.HTTPDownloader{URL: server.URL, Credentials: store}
+	assert.Nil(t, downloader.DownloadAsStream(buf))
+	assert.Equal(t, "hello", buf.String())
+
+	// the explicit auth takes precedence over the credentials
+	downloader = &net.HTTPDownloader{URL: server.URL, Credentials: store, UserName: "user", Password: "wrong",
+		RetryPolicy: net.DefaultRetryPolicy().WithoutRetry()}
+	assert.NotNil(t, downloader.DownloadAsStream(buf))
+}
+
+func TestWithHostHeader(t *testing.T) {
+	store := &net.CredentialStore{Credentials: []*net.Credential{
+		{Host: "foo.com", Type: net.CredentialBasic, Username: "user", Password: "pass"},
+	}}
+	assert.Equal(t, store, net.WithHostHeader(store, "https://foo.com/bar", nil))
+
+	// the header goes with the credential of the host
+	resolver := net.WithHostHeader(store, "https://foo.com/bar", map[string]string{"Cookie": "session=abc"})
+	credential := resolver.Resolve(&url.URL{Scheme: "https", Host: "foo.com"})
+	if assert.NotNil(t, credential) {
+		req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+		req.Header.Set("Cookie", "lang=en")
+		credential.Apply(req)
+		username, password, _ := req.BasicAuth()
+		assert.Equal(t, "user", username)
+		assert.Equal(t, "pass", password)
+		assert.Equal(t, "lang=en; session=abc", req.Header.Get("Cookie"))
+	}
+	assert.Nil(t, store.Credentials[0].Header)
+
+	// the header is not sent to the other hosts
+	resolver = net.WithHostHeader(nil, "https://foo.com/bar", map[string]string{"Cookie": "session=abc"})
+	assert.Nil(t, resolver.Resolve(&url.URL{Scheme: "https", Host: "mirror.foo.com"}))
+
+	// the Authorization of the header takes precedence over the credential
+	resolver = net.WithHostHeader(store, "https://foo.com/bar", map[string]string{"Authorization": "Bearer token"})
+	assert.Equal(t, &net.Credential{Host: "foo.com", Type: net.CredentialHeader,
+		Header: map[string]string{"Authorization": "Bearer token"}}, resolver.Resolve(&url.URL{Scheme: "https", Host: "foo.com"}))
+}
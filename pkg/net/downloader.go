@@ -0,0 +1,269 @@
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Downloader downloads the resource of the request, see NewDownloader
+type Downloader interface {
+	Download(ctx context.Context, request Request) (Result, error)
+}
+
+// Options is the shared options of the downloaders, all of them are optional.
+// The registered scheme handlers, for instance: file:// and ftp://, only take the retry policy, the rate limiter
+// and the progress. They ignore the settings of the HTTP requests like the credentials, headers, proxy and TLS,
+// and return an error if Thread, Mirrors, PieceChecksums, Cache or KeepParts is set.
+type Options struct {
+	// Username and Password are the basic auth of the host of the request URL, the password is the bearer
+	// token if there's no username. They're not sent to the mirrors or the other hosts.
+	Username string
+	Password string
+	// Credentials provides the credential of each host, Username and Password go first for the host of the URL
+	Credentials CredentialResolver
+
+	// NoProxy disables the proxy, the proxy comes from the environment variables if Proxy is empty
+	NoProxy bool
+	Proxy   string
+	// NoProxyHosts is a comma-separated list of the hosts which bypass the proxy, see NoProxyMatcher
+	NoProxyHosts string
+
+	InsecureSkipVerify bool
+	// TLSConfig has the custom CA certificates and the client certificate, see NewTLSConfig
+	TLSConfig *tls.Config
+	// RoundTripper sends the requests, the proxy and TLS options are ignored if it's set
+	RoundTripper http.RoundTripper
+	Timeout      time.Duration
+
+	// Header is the custom HTTP headers of all the requests
+	Header map[string]string
+	// CookieJar provides the cookies of the requests, and keeps the cookies of the responses
+	CookieJar http.CookieJar
+
+	// RetryPolicy decides how to retry the requests, the default policy is used if it's nil
+	RetryPolicy *RetryPolicy
+	// RateLimiter limits the bandwidth, it could be shared with other downloaders
+	RateLimiter *RateLimiter
+	// Cache stores the whole file, and sends the conditional request if it was cached
+	Cache *Cache
+
+	// Thread is the number of the concurrent range requests. The resource is downloaded by a single request
+	// if it's less than 2, and there are no mirrors or piece checksums.
+	Thread int
+	// Mirrors serve the same file, the chunks are downloaded from all of them according to the throughput
+	Mirrors []string
+	// KeepParts writes each chunk into a part file as well
+	KeepParts bool
+	// PieceChecksums verifies the pieces, the broken pieces will be downloaded again
+	PieceChecksums *PieceChecksums
+	// StreamBufferSize is the max size of the memory which holds the chunks of a stream
+	StreamBufferSize int64
+	// RedirectFilename suggests the last segment of the redirected URL if there's no Content-Disposition header
+	RedirectFilename bool
+
+	// ShowProgress renders the progress bar if there's no Observer
+	ShowProgress bool
+	// Observer receives the progress events
+	Observer ProgressObserver
+}
+
+// Request is the resource to download, the data is written into the writer if it's set, otherwise,
+// it's written into the target file
+type Request struct {
+	URL            string
+	TargetFilePath string
+	Writer         io.Writer
+	// Offset continues the download from the offset if it's positive, the data before it in the target
+	// file is kept. It's ignored by the multi-thread download, which resumes from its state file.
+	Offset int64
+}
+
+// Result is the information of the downloaded resource
+type Result struct {
+	// SuggestedFilename comes from the response, it's empty if it's the same as the target file
+	SuggestedFilename string
+	ContentType       string
+}
+
+// NewDownloader returns a downloader with the options. The URL is downloaded by its registered scheme
+// handler, by multiple threads if it's required by the options, otherwise, by a single HTTP request.
+func NewDownloader(options Options) Downloader {
+	return &defaultDownloader{options: options}
+}
+
+// defaultDownloader dispatches the requests to the downloaders of this package
+type defaultDownloader struct {
+	options Options
+}
+
+// Download downloads the resource of the request, it returns ErrCanceled once the context is done
+func (d *defaultDownloader) Download(ctx context.Context, request Request) (result Result, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if request.URL == "" {
+		err = errors.New("the URL of the request is required")
+		return
+	}
+	if request.Writer == nil && request.TargetFilePath == "" {
+		err = errors.New("either the writer or the target file of the request is required")
+		return
+	}
+
+	options := d.options
+	switch {
+	case GetSchemeHandler(request.URL) != nil:
+		if err = options.checkSchemeHandler(request.URL); err != nil {
+			return
+		}
+		downloader := &SchemeDownloader{
+			Context:     ctx,
+			Observer:    options.getObserver(),
+			RetryPolicy: options.RetryPolicy,
+			RateLimiter: options.RateLimiter,
+		}
+		if request.Writer != nil {
+			err = downloader.DownloadAsStream(request.URL, request.Writer, request.Offset)
+		} else {
+			err = downloader.DownloadFile(request.URL, request.TargetFilePath, request.Offset)
+		}
+	case options.Thread > 1 || len(options.Mirrors) > 0 || options.PieceChecksums != nil:
+		downloader := (&MultiThreadDownloader{}).WithOptions(options)
+		if request.Writer != nil {
+			err = downloader.DownloadWithContext(ctx, request.URL, request.Writer, options.Thread)
+		} else {
+			err = downloader.DownloadFileWithContext(ctx, request.URL, request.TargetFilePath, options.Thread)
+		}
+		result = Result{SuggestedFilename: downloader.GetSuggestedFilename(), ContentType: downloader.GetContentType()}
+	default:
+		result, err = d.downloadHTTP(ctx, request)
+	}
+	return
+}
+
+// downloadHTTP downloads the resource by a single request, the target file is kept before the offset
+func (d *defaultDownloader) downloadHTTP(ctx context.Context, request Request) (result Result, err error) {
+	downloader := d.options.newHTTPDownloader(ctx, request.URL, request.TargetFilePath)
+	var rangeErr error
+	if request.Offset > 0 {
+		downloader.Header["Range"] = fmt.Sprintf("bytes=%d-", request.Offset)
+		downloader.PreStart = func(resp *http.Response) bool {
+			if resp.StatusCode != http.StatusPartialContent {
+				rangeErr = fmt.Errorf("cannot continue at %d, %s does not support the range", request.Offset, request.URL)
+			}
+			return rangeErr == nil
+		}
+	}
+
+	switch {
+	case request.Writer != nil:
+		err = downloader.DownloadAsStream(request.Writer)
+	case request.Offset > 0:
+		var f *os.File
+		if f, err = openFileAt(request.TargetFilePath, request.Offset); err != nil {
+			return
+		}
+		err = downloader.DownloadAsStream(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	default:
+		err = downloader.DownloadFile()
+	}
+	if err == nil {
+		err = rangeErr
+	}
+	if err != nil {
+		err = fmt.Errorf("cannot download from %s, error: %w", request.URL, err)
+	}
+	result = Result{SuggestedFilename: downloader.GetSuggestedFilename(), ContentType: downloader.GetContentType()}
+	return
+}
+
+// checkSchemeHandler returns an error if there's an option which the scheme handlers do not support
+func (o *Options) checkSchemeHandler(targetURL string) (err error) {
+	var option string
+	switch {
+	case o.Thread > 1:
+		option = "Thread"
+	case len(o.Mirrors) > 0:
+		option = "Mirrors"
+	case o.PieceChecksums != nil:
+		option = "PieceChecksums"
+	case o.Cache != nil:
+		option = "Cache"
+	case o.KeepParts:
+		option = "KeepParts"
+	}
+	if option != "" {
+		err = fmt.Errorf("the option %s is not supported by the scheme of %s", option, targetURL)
+	}
+	return
+}
+
+// getObserver returns the observer, or the default one if it's going to show the progress
+func (o *Options) getObserver() ProgressObserver {
+	if o.Observer == nil && o.ShowProgress {
+		return defaultProgressObserver()
+	}
+	return o.Observer
+}
+
+// newHTTPDownloader returns the downloader of a single request, the headers are copied
+func (o *Options) newHTTPDownloader(ctx context.Context, targetURL, targetFilePath string) *HTTPDownloader {
+	return &HTTPDownloader{
+		URL:                targetURL,
+		TargetFilePath:     targetFilePath,
+		Context:            ctx,
+		ShowProgress:       o.ShowProgress,
+		Observer:           o.Observer,
+		UserName:           o.Username,
+		Password:           o.Password,
+		Credentials:        o.Credentials,
+		NoProxy:            o.NoProxy,
+		Proxy:              o.Proxy,
+		NoProxyHosts:       o.NoProxyHosts,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		TLSConfig:          o.TLSConfig,
+		RoundTripper:       o.RoundTripper,
+		Timeout:            o.Timeout,
+		Header:             cloneHeader(o.Header),
+		CookieJar:          o.CookieJar,
+		RetryPolicy:        o.RetryPolicy,
+		RateLimiter:        o.RateLimiter,
+		Cache:              o.Cache,
+		RedirectFilename:   o.RedirectFilename,
+	}
+}
+
+// openFileAt opens the file to write from the offset, the data after the offset is dropped.
+// The file is truncated if the offset is not positive.
+func openFileAt(targetFilePath string, offset int64) (f *os.File, err error) {
+	if err = os.MkdirAll(filepath.Dir(targetFilePath), 0755); err != nil {
+		return
+	}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_CREATE | os.O_WRONLY
+	}
+	if f, err = os.OpenFile(targetFilePath, flag, 0644); err != nil || offset <= 0 {
+		return
+	}
+
+	if err = f.Truncate(offset); err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		f = nil
+	}
+	return
+}
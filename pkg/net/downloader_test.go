@@ -0,0 +1,149 @@
+package net_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="hd.txt"`)
+		w.Header().Set(net.ContentType, "text/plain")
+		if strings.HasSuffix(r.URL.Path, "/norange") {
+			_, _ = w.Write([]byte(fakeContent))
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(fakeContent))
+	}))
+	defer server.Close()
+	options := net.Options{Header: map[string]string{"X-Token": "token"}}
+
+	t.Run("single request into a file", func(t *testing.T) {
+		targetFile := path.Join(t.TempDir(), "target")
+		result, err := net.NewDownloader(options).Download(context.Background(), net.Request{
+			URL:            server.URL + "/target",
+			TargetFilePath: targetFile,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, net.Result{SuggestedFilename: "hd.txt", ContentType: "text/plain"}, result)
+		data, err := os.ReadFile(targetFile)
+		assert.Nil(t, err)
+		assert.Equal(t, fakeContent, string(data))
+	})
+
+	t.Run("continue from the offset", func(t *testing.T) {
+		targetFile := path.Join(t.TempDir(), "target")
+		assert.Nil(t, os.WriteFile(targetFile, []byte(fakeContent[:10]+"xxxxx"), 0644))
+		_, err := net.NewDownloader(options).Download(context.Background(), net.Request{
+			URL:            server.URL + "/target",
+			TargetFilePath: targetFile,
+			Offset:         10,
+		})
+		assert.Nil(t, err)
+		data, err := os.ReadFile(targetFile)
+		assert.Nil(t, err)
+		assert.Equal(t, fakeContent, string(data))
+
+		// the data is not appended if the server does not support the range
+		_, err = net.NewDownloader(options).Download(context.Background(), net.Request{
+			URL:            server.URL + "/norange",
+			TargetFilePath: targetFile,
+			Offset:         10,
+		})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("multiple threads into a stream", func(t *testing.T) {
+		threadOptions := options
+		threadOptions.Thread = 3
+		buf := new(bytes.Buffer)
+		result, err := net.NewDownloader(threadOptions).Download(context.Background(), net.Request{
+			URL:    server.URL + "/target",
+			Writer: buf,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, fakeContent, buf.String())
+		assert.Equal(t, "hd.txt", result.SuggestedFilename)
+	})
+
+	t.Run("fallback to a single request with the same options", func(t *testing.T) {
+		threadOptions := options
+		threadOptions.Thread = 3
+		targetFile := path.Join(t.TempDir(), "target")
+		result, err := net.NewDownloader(threadOptions).Download(context.Background(), net.Request{
+			URL:            server.URL + "/norange",
+			TargetFilePath: targetFile,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "text/plain", result.ContentType)
+		data, err := os.ReadFile(targetFile)
+		assert.Nil(t, err)
+		assert.Equal(t, fakeContent, string(data))
+	})
+
+	t.Run("registered scheme", func(t *testing.T) {
+		source := path.Join(t.TempDir(), "source")
+		assert.Nil(t, os.WriteFile(source, []byte(fakeContent), 0644))
+		buf := new(bytes.Buffer)
+		_, err := net.NewDownloader(options).Download(context.Background(), net.Request{
+			URL:    (&url.URL{Scheme: "file", Path: filepath.ToSlash(source)}).String(),
+			Writer: buf,
+			Offset: 10,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, fakeContent[10:], buf.String())
+	})
+
+	t.Run("unsupported options of the registered scheme", func(t *testing.T) {
+		source := path.Join(t.TempDir(), "source")
+		assert.Nil(t, os.WriteFile(source, []byte(fakeContent), 0644))
+		mirrorOptions := options
+		mirrorOptions.Mirrors = []string{server.URL + "/target"}
+		targetFile := path.Join(t.TempDir(), "target")
+		_, err := net.NewDownloader(mirrorOptions).Download(context.Background(), net.Request{
+			URL:            (&url.URL{Scheme: "file", Path: filepath.ToSlash(source)}).String(),
+			TargetFilePath: targetFile,
+		})
+		assert.ErrorContains(t, err, "the option Mirrors is not supported by the scheme of file://")
+		assert.NoFileExists(t, targetFile)
+
+		threadOptions := options
+		threadOptions.Thread = 3
+		_, err = net.NewDownloader(threadOptions).Download(context.Background(), net.Request{
+			URL:    (&url.URL{Scheme: "file", Path: filepath.ToSlash(source)}).String(),
+			Writer: new(bytes.Buffer),
+		})
+		assert.ErrorContains(t, err, "the option Thread is not supported")
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		_, err := net.NewDownloader(options).Download(context.Background(), net.Request{TargetFilePath: "target"})
+		assert.NotNil(t, err)
+		_, err = net.NewDownloader(options).Download(context.Background(), net.Request{URL: server.URL})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("the options are missing", func(t *testing.T) {
+		_, err := net.NewDownloader(net.Options{}).Download(context.Background(), net.Request{
+			URL:    server.URL + "/target",
+			Writer: new(bytes.Buffer),
+		})
+		assert.NotNil(t, err)
+	})
+}
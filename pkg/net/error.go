@@ -1,6 +1,12 @@
 package net
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
 
 // DownloadError represents the error of HTTP download
 type DownloadError struct {
@@ -12,3 +18,96 @@ type DownloadError struct {
 func (e *DownloadError) Error() string {
 	return fmt.Sprintf("%s: status code: %d", e.Message, e.StatusCode)
 }
+
+// ErrCanceled means the download was canceled by the context, it could be checked by errors.Is.
+// The error of the context is wrapped as well, so errors.Is(err, context.DeadlineExceeded) works.
+var ErrCanceled = errors.New("download canceled")
+
+// canceledError is ErrCanceled with the error of the context
+type canceledError struct {
+	cause error
+}
+
+// Error print the error message
+func (e *canceledError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrCanceled, e.cause)
+}
+
+// Is returns true if the target is ErrCanceled
+func (e *canceledError) Is(target error) bool {
+	return target == ErrCanceled
+}
+
+// Unwrap returns the error of the context
+func (e *canceledError) Unwrap() error {
+	return e.cause
+}
+
+// checkCanceled returns ErrCanceled if the context is done, otherwise it returns the original error.
+// The nil error is returned as it is, the finished download is not canceled.
+func checkCanceled(ctx context.Context, err error) error {
+	if err == nil || ctx == nil || ctx.Err() == nil || errors.Is(err, ErrCanceled) {
+		return err
+	}
+	return &canceledError{cause: ctx.Err()}
+}
+
+// MultiError aggregates multiple errors, it's safe to add errors concurrently
+type MultiError struct {
+	Errors []error
+	lock   sync.Mutex
+}
+
+// Add appends a non-nil error
+func (e *MultiError) Add(err error) {
+	if err == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.Errors = append(e.Errors, err)
+}
+
+// ErrorOrNil returns nil if there's no error
+func (e *MultiError) ErrorOrNil() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error print all the error messages
+func (e *MultiError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Unwrap returns all the errors
+func (e *MultiError) Unwrap() []error {
+	return e.Errors
+}
+
+// Is reports whether any of the errors matches the target, errors.Is of Go 1.19 does not take Unwrap() []error
+func (e *MultiError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error which matches the target, errors.As of Go 1.19 does not take Unwrap() []error
+func (e *MultiError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
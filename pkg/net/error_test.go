@@ -1,9 +1,13 @@
 package net_test
 
 import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
 	"github.com/linuxsuren/http-downloader/pkg/net"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 func TestError(t *testing.T) {
@@ -14,3 +18,27 @@ func TestError(t *testing.T) {
 	assert.Contains(t, err.Error(), "message")
 	assert.Contains(t, err.Error(), "200")
 }
+
+func TestMultiError(t *testing.T) {
+	multiErr := &net.MultiError{}
+	assert.Nil(t, multiErr.ErrorOrNil())
+
+	multiErr.Add(nil)
+	multiErr.Add(errors.New("first"))
+	multiErr.Add(context.Canceled)
+	multiErr.Add(&net.DownloadError{Message: "chunk", StatusCode: 404})
+	err := multiErr.ErrorOrNil()
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "3 errors occurred")
+		assert.Contains(t, err.Error(), "first")
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.False(t, errors.Is(err, context.DeadlineExceeded))
+
+		var downloadErr *net.DownloadError
+		if assert.True(t, errors.As(err, &downloadErr)) {
+			assert.Equal(t, 404, downloadErr.StatusCode)
+		}
+		var pathErr *os.PathError
+		assert.False(t, errors.As(err, &pathErr))
+	}
+}
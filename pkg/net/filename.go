@@ -0,0 +1,140 @@
+package net
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseContentDisposition returns the filename of the Content-Disposition header, see RFC 6266.
+// The filename* parameter, which is encoded by RFC 8187, takes precedence over the filename one.
+// The directories of the filename are dropped, so it's safe to be joined with the output directory.
+// It returns an empty string if there's no valid filename.
+func ParseContentDisposition(value string) (filename string) {
+	var extended string
+	for _, param := range splitHeaderParams(value) {
+		name, paramValue, ok := strings.Cut(param, "=")
+		if !ok {
+			// the disposition type, for instance: attachment
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		paramValue = strings.TrimSpace(paramValue)
+
+		switch name {
+		case "filename":
+			if filename == "" {
+				filename = unquoteHeaderValue(paramValue)
+			}
+		case "filename*":
+			if extended == "" {
+				extended = decodeExtendedValue(paramValue)
+			}
+		}
+	}
+	if extended != "" {
+		filename = extended
+	}
+	return sanitizeFilename(filename)
+}
+
+// splitHeaderParams splits the header value by the semicolons which are not in the quoted strings
+func splitHeaderParams(value string) (params []string) {
+	var quoted, escaped bool
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ';' && !quoted:
+			params = append(params, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(params, value[start:])
+}
+
+// unquoteHeaderValue returns the value of a token or a quoted string
+func unquoteHeaderValue(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+
+	var builder strings.Builder
+	value = value[1 : len(value)-1]
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		builder.WriteByte(value[i])
+	}
+	return builder.String()
+}
+
+// decodeExtendedValue decodes the value like UTF-8'en'%e2%82%ac%20rates.txt, see RFC 8187.
+// Only UTF-8 and ISO-8859-1 are supported, it returns an empty string if it's invalid.
+func decodeExtendedValue(value string) string {
+	parts := strings.SplitN(value, "'", 3)
+	if len(parts) != 3 {
+		return ""
+	}
+
+	decoded, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(parts[0]) {
+	case "utf-8":
+		if !utf8.ValidString(decoded) {
+			return ""
+		}
+		return decoded
+	case "iso-8859-1":
+		runes := make([]rune, len(decoded))
+		for i := 0; i < len(decoded); i++ {
+			runes[i] = rune(decoded[i])
+		}
+		return string(runes)
+	}
+	return ""
+}
+
+// sanitizeFilename drops the directories and the control characters, it returns an empty string
+// if nothing left or it's a special name like ..
+func sanitizeFilename(filename string) string {
+	filename = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, filename)
+	// the backslash is the separator of Windows
+	filename = strings.ReplaceAll(filename, `\`, "/")
+	filename = strings.TrimSpace(path.Base(path.Clean("/" + filename)))
+	if filename == "/" || filename == "." || filename == ".." {
+		return ""
+	}
+	return filename
+}
+
+// suggestFilename returns the filename from the Content-Disposition header of the response. If there's
+// no such header and redirect is true, it's the last segment of the final URL when the request was redirected
+// to another path. It returns an empty string if the filename is the same as the target file.
+func suggestFilename(resp *http.Response, requestURL, targetFilePath string, redirect bool) (filename string) {
+	if filename = ParseContentDisposition(resp.Header.Get("Content-Disposition")); filename == "" && redirect && resp.Request != nil {
+		if original, err := url.Parse(requestURL); err == nil && original.Path != resp.Request.URL.Path {
+			filename = sanitizeFilename(resp.Request.URL.Path)
+		}
+	}
+	if filename == filepath.Base(targetFilePath) {
+		filename = ""
+	}
+	return
+}
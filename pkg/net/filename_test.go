@@ -0,0 +1,128 @@
+package net_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseContentDisposition(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		expect string
+	}{{
+		name:   "quoted",
+		value:  `attachment; filename="foo.tar.gz"`,
+		expect: "foo.tar.gz",
+	}, {
+		name:   "token without the type",
+		value:  `filename=foo.tar.gz`,
+		expect: "foo.tar.gz",
+	}, {
+		name:   "extra parameters",
+		value:  `attachment; filename="foo.tar.gz"; size=1024; creation-date="Wed, 12 Feb 1997 16:29:51 -0500"`,
+		expect: "foo.tar.gz",
+	}, {
+		name:   "semicolon and escaped quote in the quoted string",
+		value:  `attachment; filename="foo;\"bar\".tar.gz"`,
+		expect: `foo;"bar".tar.gz`,
+	}, {
+		name:   "extended value takes precedence",
+		value:  `attachment; filename="EURO rates.txt"; filename*=UTF-8''%e2%82%ac%20rates.txt`,
+		expect: "€ rates.txt",
+	}, {
+		name:   "extended value goes first",
+		value:  `attachment; FILENAME*=utf-8'en'%e2%82%ac.txt; filename="EURO.txt"`,
+		expect: "€.txt",
+	}, {
+		name:   "ISO-8859-1",
+		value:  `attachment; filename*=iso-8859-1''caf%E9.txt`,
+		expect: "café.txt",
+	}, {
+		name:   "invalid extended value falls back",
+		value:  `attachment; filename*=UTF-8''%ff.txt; filename="fallback.txt"`,
+		expect: "fallback.txt",
+	}, {
+		name:   "unsupported charset",
+		value:  `attachment; filename*=GBK''foo.txt`,
+		expect: "",
+	}, {
+		name:   "path traversal",
+		value:  `attachment; filename="../../etc/passwd"`,
+		expect: "passwd",
+	}, {
+		name:   "Windows path",
+		value:  `attachment; filename="C:\\Windows\\foo.exe"`,
+		expect: "foo.exe",
+	}, {
+		name:   "special names",
+		value:  `attachment; filename=".."`,
+		expect: "",
+	}, {
+		name:   "control characters",
+		value:  "attachment; filename=\"foo\x00\r\n.txt\"",
+		expect: "foo.txt",
+	}, {
+		name:   "no filename",
+		value:  `inline`,
+		expect: "",
+	}, {
+		name:   "empty",
+		expect: "",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, net.ParseContentDisposition(tt.value))
+		})
+	}
+}
+
+func TestSuggestedFilenameOfRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/download":
+			http.Redirect(w, r, "/files/foo-1.0.0.tar.gz?token=abc", http.StatusFound)
+		default:
+			if strings.HasSuffix(r.URL.Path, ".tar.gz") && r.URL.Query().Get("named") != "" {
+				w.Header().Set("Content-Disposition", `attachment; filename="named.tar.gz"`)
+			}
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader("content"))
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	tests := []struct {
+		path     string
+		output   string
+		redirect bool
+		expect   string
+	}{
+		{path: "/download", output: "download", redirect: true, expect: "foo-1.0.0.tar.gz"},
+		{path: "/download", output: "foo-1.0.0.tar.gz", redirect: true, expect: ""},
+		// the redirected URL is not taken by default
+		{path: "/download", output: "download", expect: ""},
+		{path: "/files/foo-1.0.0.tar.gz", output: "foo.tar.gz", redirect: true, expect: ""},
+		{path: "/files/foo-1.0.0.tar.gz?named=true", output: "foo.tar.gz", expect: "named.tar.gz"},
+	}
+	for _, tt := range tests {
+		downloader := &net.HTTPDownloader{URL: server.URL + tt.path, TargetFilePath: path.Join(dir, tt.output),
+			NoProxy: true, RedirectFilename: tt.redirect}
+		assert.Nil(t, downloader.DownloadFile(), tt.path)
+		assert.Equal(t, tt.expect, downloader.GetSuggestedFilename(), tt.path)
+		_ = os.Remove(downloader.TargetFilePath)
+	}
+
+	// the multi-thread downloader takes the filename while detecting the file
+	downloader := (&net.MultiThreadDownloader{}).WithOptions(net.Options{NoProxy: true, RedirectFilename: true})
+	assert.Nil(t, downloader.Download(server.URL+"/download", path.Join(dir, "download"), 2))
+	assert.Equal(t, "foo-1.0.0.tar.gz", downloader.GetSuggestedFilename())
+}
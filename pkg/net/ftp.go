@@ -0,0 +1,251 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FTPHandler downloads the files of the ftp:// URLs in the passive mode. The user and password
+// come from the URL, otherwise it logs in as anonymous. The download is resumed by the REST command.
+type FTPHandler struct {
+	// Timeout is the timeout of connecting the server
+	Timeout time.Duration
+}
+
+// FTPError is the negative reply of the FTP server
+type FTPError struct {
+	Code    int
+	Message string
+}
+
+// Error returns the reply
+func (e *FTPError) Error() string {
+	return fmt.Sprintf("ftp: %d %s", e.Code, e.Message)
+}
+
+// Temporary returns true if it's a transient negative reply, it's worth to retry
+func (e *FTPError) Temporary() bool {
+	return e.Code >= 400 && e.Code < 500
+}
+
+// Probe returns the size of the file, and checks if the server supports the REST command
+func (h *FTPHandler) Probe(ctx context.Context, resource *url.URL) (size int64, rangeSupport bool, err error) {
+	var conn *ftpConn
+	if conn, err = dialFTP(ctx, resource, h.Timeout); err != nil {
+		return
+	}
+	defer conn.quit()
+
+	size = -1
+	var msg string
+	if _, msg, err = conn.cmd(213, "SIZE %s", ftpPath(resource)); err == nil {
+		size, _ = strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	} else {
+		var ftpErr *FTPError
+		if !errors.As(err, &ftpErr) || ftpErr.Code == 550 {
+			// the file does not exist
+			return
+		}
+		// the server does not support the SIZE command
+		err = nil
+	}
+
+	_, _, restErr := conn.cmd(350, "REST 0")
+	rangeSupport = restErr == nil
+	return
+}
+
+// Open starts to retrieve the file from the offset
+func (h *FTPHandler) Open(ctx context.Context, resource *url.URL, offset int64) (reader io.ReadCloser, err error) {
+	var conn *ftpConn
+	if conn, err = dialFTP(ctx, resource, h.Timeout); err != nil {
+		return
+	}
+
+	var data net.Conn
+	if data, err = conn.passive(ctx, h.Timeout); err == nil {
+		if offset > 0 {
+			_, _, err = conn.cmd(350, "REST %d", offset)
+		}
+		if err == nil {
+			// 125 means the data connection is already open, 150 means it's about to open
+			_, _, err = conn.cmd(1, "RETR %s", ftpPath(resource))
+		}
+		if err != nil {
+			_ = data.Close()
+		}
+	}
+	if err != nil {
+		conn.quit()
+		return
+	}
+
+	ftpReader := &ftpReader{conn: conn, data: data, done: make(chan struct{})}
+	go func() {
+		// interrupt the transfer once the context is done
+		select {
+		case <-ctx.Done():
+			_ = data.Close()
+			_ = conn.conn.Close()
+		case <-ftpReader.done:
+		}
+	}()
+	reader = ftpReader
+	return
+}
+
+// ftpReader reads the data connection, and checks the reply of the transfer at the end
+type ftpReader struct {
+	conn      *ftpConn
+	data      net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Read reads the data, it returns the negative reply instead of io.EOF if the transfer failed
+func (r *ftpReader) Read(p []byte) (n int, err error) {
+	if n, err = r.data.Read(p); err == io.EOF {
+		if _, _, replyErr := r.conn.read(2); replyErr != nil {
+			err = replyErr
+		}
+	}
+	return
+}
+
+// Close closes the data connection and the control connection
+func (r *ftpReader) Close() (err error) {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		err = r.data.Close()
+		r.conn.quit()
+	})
+	return
+}
+
+// ftpConn is the control connection
+type ftpConn struct {
+	conn net.Conn
+	text *textproto.Conn
+}
+
+// dialFTP connects the server, then logs in and switches to the binary mode
+func dialFTP(ctx context.Context, resource *url.URL, timeout time.Duration) (c *ftpConn, err error) {
+	address := resource.Host
+	if resource.Port() == "" {
+		address = net.JoinHostPort(resource.Hostname(), "21")
+	}
+
+	var conn net.Conn
+	if conn, err = (&net.Dialer{Timeout: timeout}).DialContext(ctx, "tcp", address); err != nil {
+		return
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c = &ftpConn{conn: conn, text: textproto.NewConn(conn)}
+
+	user, password := "anonymous", "anonymous@"
+	if resource.User != nil {
+		user = resource.User.Username()
+		password, _ = resource.User.Password()
+	}
+
+	var code int
+	if _, _, err = c.read(220); err == nil {
+		// 230 means there's no need to send the password
+		if code, _, err = c.cmd(0, "USER %s", user); err == nil && code == 331 {
+			_, _, err = c.cmd(230, "PASS %s", password)
+		} else if err == nil && code != 230 {
+			err = &FTPError{Code: code, Message: "failed to log in as " + user}
+		}
+	}
+	if err == nil {
+		_, _, err = c.cmd(200, "TYPE I")
+	}
+
+	if err != nil {
+		_ = conn.Close()
+		c = nil
+	}
+	return
+}
+
+// cmd sends the command, then reads the reply which should match the expected code,
+// see also textproto.Reader.ReadResponse
+func (c *ftpConn) cmd(expectCode int, format string, args ...interface{}) (code int, msg string, err error) {
+	if _, err = c.text.Cmd(format, args...); err == nil {
+		code, msg, err = c.read(expectCode)
+	}
+	return
+}
+
+// read reads the reply, the negative reply is returned as an FTPError
+func (c *ftpConn) read(expectCode int) (code int, msg string, err error) {
+	code, msg, err = c.text.ReadResponse(expectCode)
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		err = &FTPError{Code: protoErr.Code, Message: protoErr.Msg}
+	}
+	return
+}
+
+// passive opens the data connection, it tries EPSV before PASV. The host of the PASV reply is
+// ignored since it might be a private address behind the NAT.
+func (c *ftpConn) passive(ctx context.Context, timeout time.Duration) (data net.Conn, err error) {
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+
+	var msg, port string
+	if _, msg, err = c.cmd(229, "EPSV"); err == nil {
+		// 229 Entering Extended Passive Mode (|||6446|)
+		start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if start < 0 || end < start+4 {
+			err = fmt.Errorf("invalid EPSV reply: %s", msg)
+			return
+		}
+		port = msg[start+4 : end]
+	} else if _, msg, err = c.cmd(227, "PASV"); err == nil {
+		// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+		start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+		var fields []string
+		if start >= 0 && end > start {
+			fields = strings.Split(msg[start+1:end], ",")
+		}
+		if len(fields) != 6 {
+			err = fmt.Errorf("invalid PASV reply: %s", msg)
+			return
+		}
+		high, highErr := strconv.Atoi(strings.TrimSpace(fields[4]))
+		low, lowErr := strconv.Atoi(strings.TrimSpace(fields[5]))
+		if highErr != nil || lowErr != nil {
+			err = fmt.Errorf("invalid PASV reply: %s", msg)
+			return
+		}
+		port = strconv.Itoa(high*256 + low)
+	} else {
+		return
+	}
+
+	data, err = (&net.Dialer{Timeout: timeout}).DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	return
+}
+
+// quit says goodbye to the server, then closes the control connection
+func (c *ftpConn) quit() {
+	_ = c.conn.SetDeadline(time.Now().Add(time.Second))
+	_, _, _ = c.cmd(221, "QUIT")
+	_ = c.conn.Close()
+}
+
+// ftpPath returns the path of the file which is relative to the login directory, see RFC 1738
+func ftpPath(resource *url.URL) string {
+	return strings.TrimPrefix(resource.Path, "/")
+}
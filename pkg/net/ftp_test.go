@@ -0,0 +1,186 @@
+package net_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hdnet "github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFTPServer is a minimal FTP server which serves a single file in the passive mode
+type fakeFTPServer struct {
+	listener net.Listener
+	content  string
+	password string
+	// brokenAt cuts off the first transfer after the count of bytes if it's positive
+	brokenAt int
+
+	lock     sync.Mutex
+	commands []string
+}
+
+func newFakeFTPServer(t *testing.T, content string) *fakeFTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := &fakeFTPServer{listener: listener, content: content, password: "secret"}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	return server
+}
+
+func (s *fakeFTPServer) serve(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	reply := func(format string, args ...interface{}) {
+		_, _ = fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	var data net.Listener
+	var offset int
+	reply("220 fake server")
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		s.lock.Lock()
+		s.commands = append(s.commands, line)
+		s.lock.Unlock()
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch cmd {
+		case "USER":
+			reply("331 password please")
+		case "PASS":
+			if arg == s.password {
+				reply("230 logged in")
+			} else {
+				reply("530 login incorrect")
+			}
+		case "TYPE":
+			reply("200 binary mode")
+		case "SIZE":
+			if arg == "pub/foo.txt" {
+				reply("213 %d", len(s.content))
+			} else {
+				reply("550 no such file")
+			}
+		case "REST":
+			offset, _ = strconv.Atoi(arg)
+			reply("350 restarting at %d", offset)
+		case "EPSV":
+			data, _ = net.Listen("tcp", "127.0.0.1:0")
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "RETR":
+			reply("150 opening data connection")
+			dataConn, err := data.Accept()
+			_ = data.Close()
+			if err != nil {
+				return
+			}
+			content := s.content[offset:]
+			s.lock.Lock()
+			brokenAt := s.brokenAt
+			s.brokenAt = 0
+			s.lock.Unlock()
+			if brokenAt > 0 {
+				_, _ = dataConn.Write([]byte(content[:brokenAt]))
+				_ = dataConn.Close()
+				reply("426 connection closed, transfer aborted")
+				continue
+			}
+			_, _ = dataConn.Write([]byte(content))
+			_ = dataConn.Close()
+			reply("226 transfer complete")
+			offset = 0
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeFTPServer) received(command string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, item := range s.commands {
+		if item == command {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fakeFTPServer) url(user string) string {
+	return fmt.Sprintf("ftp://%s@%s/pub/foo.txt", user, s.listener.Addr().String())
+}
+
+func TestFTPHandler(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	policy := hdnet.DefaultRetryPolicy()
+	policy.InitialInterval = time.Millisecond
+
+	t.Run("normal", func(t *testing.T) {
+		server := newFakeFTPServer(t, content)
+		buf := &bytes.Buffer{}
+		downloader := &hdnet.SchemeDownloader{RetryPolicy: policy}
+		assert.Nil(t, downloader.DownloadAsStream(server.url("rick:secret"), buf, -1))
+		assert.Equal(t, content, buf.String())
+		assert.True(t, server.received("RETR pub/foo.txt"))
+	})
+
+	t.Run("continue at an offset", func(t *testing.T) {
+		server := newFakeFTPServer(t, content)
+		buf := &bytes.Buffer{}
+		downloader := &hdnet.SchemeDownloader{RetryPolicy: policy}
+		assert.Nil(t, downloader.DownloadAsStream(server.url("rick:secret"), buf, 100))
+		assert.Equal(t, content[100:], buf.String())
+		assert.True(t, server.received("REST 100"))
+	})
+
+	t.Run("resume the broken transfer", func(t *testing.T) {
+		server := newFakeFTPServer(t, content)
+		server.brokenAt = 300
+		buf := &bytes.Buffer{}
+		downloader := &hdnet.SchemeDownloader{RetryPolicy: policy}
+		assert.Nil(t, downloader.DownloadAsStream(server.url("rick:secret"), buf, -1))
+		assert.Equal(t, content, buf.String())
+		assert.True(t, server.received("REST 300"))
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		server := newFakeFTPServer(t, content)
+		downloader := &hdnet.SchemeDownloader{RetryPolicy: policy}
+		err := downloader.DownloadAsStream(server.url("rick:wrong"), &bytes.Buffer{}, -1)
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "530")
+		}
+	})
+
+	t.Run("file not found", func(t *testing.T) {
+		server := newFakeFTPServer(t, content)
+		downloader := &hdnet.SchemeDownloader{RetryPolicy: policy}
+		err := downloader.DownloadAsStream(strings.Replace(server.url("rick:secret"), "foo", "bar", 1), &bytes.Buffer{}, -1)
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "550")
+		}
+	})
+}
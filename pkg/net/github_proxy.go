@@ -0,0 +1,310 @@
+package net
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GitHubProxyAuto selects the GitHub proxy by probing the proxy servers
+	GitHubProxyAuto = "auto"
+	// DefaultGitHubProxyProbeURL is a small file of GitHub which is downloaded via each proxy server
+	DefaultGitHubProxyProbeURL = "https://raw.githubusercontent.com/LinuxSuRen/hd-home/master/README.md"
+	// DefaultGitHubProxyTTL is the default expiration of the ranking of the proxy servers
+	DefaultGitHubProxyTTL = 6 * time.Hour
+	// defaultGitHubProxyProbeTimeout is the max duration of probing a proxy server
+	defaultGitHubProxyProbeTimeout = 10 * time.Second
+)
+
+// IsGitHubURL returns true if the URL could be downloaded via the GitHub proxy servers
+func IsGitHubURL(targetURL string) bool {
+	return strings.HasPrefix(targetURL, "https://github.com/") ||
+		strings.HasPrefix(targetURL, "https://raw.githubusercontent.com/")
+}
+
+// IsUnexpectedWebPage returns true if the content type is HTML but the URL is not a web page. The proxy
+// servers usually return a web page instead of an error status.
+func IsUnexpectedWebPage(contentType, targetURL string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "text/html" {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(strings.SplitN(targetURL, "?", 2)[0]))
+	return ext != ".html" && ext != ".htm"
+}
+
+// WithGitHubProxy returns the URL of GitHub via the proxy server, the proxy address will be the prefix of
+// the final address. The URL is not changed if the proxy is empty or it's not a GitHub URL.
+func WithGitHubProxy(targetURL, proxy string) string {
+	if proxy != "" {
+		targetURL = strings.Replace(targetURL, "https://github.com", fmt.Sprintf("https://%s/github.com", proxy), 1)
+		targetURL = strings.Replace(targetURL, "https://raw.githubusercontent.com",
+			fmt.Sprintf("https://%s/https://raw.githubusercontent.com", proxy), 1)
+	}
+	return targetURL
+}
+
+// GitHubProxyStat is the probe result of a proxy server
+type GitHubProxyStat struct {
+	Server string `json:"server"`
+	// Latency is the duration before getting the response header
+	Latency time.Duration `json:"latency"`
+	// Throughput is the bytes per second of the response body
+	Throughput float64 `json:"throughput"`
+}
+
+// cost estimates the duration of downloading 64 KiB via the proxy server, so both the latency and the
+// throughput are taken into account. The size is small because the throughput of a small probe file
+// is not accurate.
+func (s *GitHubProxyStat) cost() time.Duration {
+	if s.Throughput <= 0 {
+		return s.Latency + time.Hour
+	}
+	return s.Latency + time.Duration(float64(time.Second)*(64<<10)/s.Throughput)
+}
+
+// githubProxyRanking is the cached ranking, it's invalid if the servers or the probe URL are changed
+type githubProxyRanking struct {
+	Servers  []string          `json:"servers"`
+	ProbeURL string            `json:"probeURL"`
+	Stats    []GitHubProxyStat `json:"stats"`
+	ProbedAt time.Time         `json:"probedAt"`
+}
+
+// GitHubProxySelector ranks the GitHub proxy servers by probing them concurrently. The probe downloads
+// the same file via each server and the direct connection, the servers which fail or return the content
+// different from the majority are dropped. The ranking is cached into a file until it expires.
+type GitHubProxySelector struct {
+	Servers []string
+	// ProbeURL is the file of GitHub to probe, DefaultGitHubProxyProbeURL is used if it's empty
+	ProbeURL string
+	// CacheFile keeps the ranking, it's not cached if it's empty
+	CacheFile string
+	// TTL is the expiration of the cached ranking, DefaultGitHubProxyTTL is used if it's zero
+	TTL time.Duration
+	// Timeout is the max duration of probing a server
+	Timeout time.Duration
+	// Options is used by the probe requests, the retry, cache and progress are ignored
+	Options Options
+	// OnDrop is called when a server is dropped because it failed or returned the wrong content
+	OnDrop func(server string, err error)
+
+	lock sync.Mutex
+}
+
+// DefaultGitHubProxyCacheFile returns the path of the cached ranking which is in the cache directory
+func DefaultGitHubProxyCacheFile() string {
+	return filepath.Join(DefaultCacheDir(), "github-proxy.json")
+}
+
+// Candidates returns the ranked servers, and the empty one at last which means the direct connection
+func (s *GitHubProxySelector) Candidates(ctx context.Context) (servers []string) {
+	for _, stat := range s.Rank(ctx) {
+		servers = append(servers, stat.Server)
+	}
+	return append(servers, "")
+}
+
+// Rank returns the servers which passed the probe, the fastest one goes first. The cached ranking is
+// used if it's not expired.
+func (s *GitHubProxySelector) Rank(ctx context.Context) (stats []GitHubProxyStat) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ranking := s.loadRanking(); ranking != nil {
+		return ranking.Stats
+	}
+	stats = s.probeAll(ctx)
+	if ctx == nil || ctx.Err() == nil {
+		s.saveRanking(stats)
+	}
+	return
+}
+
+// Demote moves the server to the end of the cached ranking, it should be called once the server failed
+// to download a file. It's probed again after the ranking expired.
+func (s *GitHubProxySelector) Demote(server string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ranking := s.loadRanking()
+	if ranking == nil {
+		return
+	}
+	for i, stat := range ranking.Stats {
+		if stat.Server == server {
+			ranking.Stats = append(append(ranking.Stats[:i:i], ranking.Stats[i+1:]...), stat)
+			s.writeRanking(ranking)
+			return
+		}
+	}
+}
+
+// probeAll probes all the servers and the direct connection concurrently
+func (s *GitHubProxySelector) probeAll(ctx context.Context) (stats []GitHubProxyStat) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	servers := append([]string{""}, s.Servers...)
+	results := make([]githubProxyProbe, len(servers))
+	wg := sync.WaitGroup{}
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = s.probe(ctx, servers[i])
+		}(i)
+	}
+	wg.Wait()
+
+	// the content of the majority is the right one, the direct connection wins the tie
+	votes := map[string]int{}
+	var expected string
+	for _, result := range results {
+		if result.err == nil {
+			votes[result.digest]++
+			if votes[result.digest] > votes[expected] {
+				expected = result.digest
+			}
+		}
+	}
+	if results[0].err == nil && votes[results[0].digest] == votes[expected] {
+		expected = results[0].digest
+	}
+
+	for _, result := range results[1:] {
+		if result.err == nil && result.digest != expected {
+			result.err = errors.New("its content is different from the others")
+		}
+		if result.err == nil {
+			stats = append(stats, result.stat)
+		} else if s.OnDrop != nil {
+			s.OnDrop(result.stat.Server, result.err)
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].cost() < stats[j].cost()
+	})
+	return
+}
+
+// githubProxyProbe is the result of probing a server
+type githubProxyProbe struct {
+	stat   GitHubProxyStat
+	digest string
+	err    error
+}
+
+// probe downloads the probe file via the server, the empty server means the direct connection
+func (s *GitHubProxySelector) probe(ctx context.Context, server string) (result githubProxyProbe) {
+	result.stat.Server = server
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultGitHubProxyProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	probeURL := s.ProbeURL
+	if probeURL == "" {
+		probeURL = DefaultGitHubProxyProbeURL
+	}
+	options := s.Options
+	options.RetryPolicy = DefaultRetryPolicy().WithoutRetry()
+	options.Cache, options.Observer, options.ShowProgress = nil, nil, false
+	downloader := options.newHTTPDownloader(ctx, WithGitHubProxy(probeURL, server), "")
+
+	var contentType string
+	begin := time.Now()
+	downloader.PreStart = func(resp *http.Response) bool {
+		result.stat.Latency = time.Since(begin)
+		contentType = resp.Header.Get(ContentType)
+		return true
+	}
+	writer := &digestWriter{hash: sha256.New()}
+	if result.err = downloader.DownloadAsStream(writer); result.err != nil {
+		return
+	}
+
+	if IsUnexpectedWebPage(contentType, probeURL) {
+		result.err = fmt.Errorf("got a web page instead of the file")
+		return
+	}
+	elapsed := time.Since(begin) - result.stat.Latency
+	if elapsed <= 0 {
+		// the clock is not precise enough on some platforms
+		elapsed = time.Microsecond
+	}
+	result.stat.Throughput = float64(writer.size) / elapsed.Seconds()
+	result.digest = hex.EncodeToString(writer.hash.Sum(nil))
+	return
+}
+
+// digestWriter counts and hashes the written data
+type digestWriter struct {
+	hash hash.Hash
+	size int64
+}
+
+// Write writes the data into the hash
+func (w *digestWriter) Write(p []byte) (n int, err error) {
+	w.size += int64(len(p))
+	return w.hash.Write(p)
+}
+
+// loadRanking returns the cached ranking, it's nil if it's expired or invalid
+func (s *GitHubProxySelector) loadRanking() (ranking *githubProxyRanking) {
+	if s.CacheFile == "" {
+		return
+	}
+	data, err := os.ReadFile(s.CacheFile)
+	if err != nil {
+		return
+	}
+
+	ranking = &githubProxyRanking{}
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = DefaultGitHubProxyTTL
+	}
+	if err = json.Unmarshal(data, ranking); err != nil || ranking.ProbeURL != s.ProbeURL ||
+		strings.Join(ranking.Servers, ",") != strings.Join(s.Servers, ",") || time.Now().Sub(ranking.ProbedAt) > ttl {
+		ranking = nil
+	}
+	return
+}
+
+// saveRanking caches the ranking, the error is ignored because it only makes the next probe earlier
+func (s *GitHubProxySelector) saveRanking(stats []GitHubProxyStat) {
+	if s.CacheFile == "" {
+		return
+	}
+	s.writeRanking(&githubProxyRanking{
+		Servers:  s.Servers,
+		ProbeURL: s.ProbeURL,
+		Stats:    stats,
+		ProbedAt: time.Now(),
+	})
+}
+
+func (s *GitHubProxySelector) writeRanking(ranking *githubProxyRanking) {
+	if data, err := json.Marshal(ranking); err == nil {
+		if err = os.MkdirAll(filepath.Dir(s.CacheFile), 0755); err == nil {
+			_ = os.WriteFile(s.CacheFile, data, 0644)
+		}
+	}
+}
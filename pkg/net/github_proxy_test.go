@@ -0,0 +1,132 @@
+package net_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithGitHubProxy(t *testing.T) {
+	assert.Equal(t, "https://github.com/a/b", net.WithGitHubProxy("https://github.com/a/b", ""))
+	assert.Equal(t, "https://foo.com/github.com/a/b", net.WithGitHubProxy("https://github.com/a/b", "foo.com"))
+	assert.Equal(t, "https://foo.com/https://raw.githubusercontent.com/a/b",
+		net.WithGitHubProxy("https://raw.githubusercontent.com/a/b", "foo.com"))
+	assert.Equal(t, "https://bar.com/a/b", net.WithGitHubProxy("https://bar.com/a/b", "foo.com"))
+
+	assert.True(t, net.IsGitHubURL("https://github.com/a/b"))
+	assert.False(t, net.IsGitHubURL("https://gitee.com/a/b"))
+	assert.True(t, net.IsUnexpectedWebPage("text/html; charset=utf-8", "https://github.com/a/b.tar.gz"))
+	assert.False(t, net.IsUnexpectedWebPage("text/html", "https://github.com/a/index.html?raw=true"))
+	assert.False(t, net.IsUnexpectedWebPage("application/octet-stream", "https://github.com/a/b.tar.gz"))
+}
+
+// newGitHubProxyRoundTripper serves the probe file by the host of the request, it counts the requests
+func newGitHubProxyRoundTripper(count *int32) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(count, 1)
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		recorder := httptest.NewRecorder()
+		switch req.URL.Host {
+		case "raw.githubusercontent.com", "fast.proxy":
+			_, _ = recorder.WriteString(fakeContent)
+		case "slow.proxy":
+			time.Sleep(300 * time.Millisecond)
+			_, _ = recorder.WriteString(fakeContent)
+		case "bad.proxy":
+			_, _ = recorder.WriteString("tampered")
+		case "html.proxy":
+			recorder.Header().Set(net.ContentType, "text/html")
+			_, _ = recorder.WriteString("<html></html>")
+		default:
+			recorder.WriteHeader(http.StatusBadGateway)
+		}
+		resp := recorder.Result()
+		resp.Request = req
+		return resp, nil
+	})
+}
+
+func TestGitHubProxySelector(t *testing.T) {
+	servers := []string{"slow.proxy", "bad.proxy", "fast.proxy", "html.proxy", "down.proxy"}
+	newSelector := func(cacheFile string, count *int32) *net.GitHubProxySelector {
+		return &net.GitHubProxySelector{
+			Servers:   servers,
+			CacheFile: cacheFile,
+			Options:   net.Options{RoundTripper: newGitHubProxyRoundTripper(count)},
+		}
+	}
+
+	t.Run("rank and drop the servers", func(t *testing.T) {
+		var count int32
+		selector := newSelector("", &count)
+		var dropped []string
+		selector.OnDrop = func(server string, err error) {
+			assert.NotNil(t, err)
+			dropped = append(dropped, server)
+		}
+		assert.Equal(t, []string{"fast.proxy", "slow.proxy", ""}, selector.Candidates(context.Background()))
+		assert.ElementsMatch(t, []string{"bad.proxy", "html.proxy", "down.proxy"}, dropped)
+		assert.Equal(t, int32(len(servers)+1), count)
+	})
+
+	t.Run("the majority wins if the direct connection failed", func(t *testing.T) {
+		var count int32
+		roundTripper := newGitHubProxyRoundTripper(&count)
+		selector := newSelector("", &count)
+		selector.Options.RoundTripper = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Host == "raw.githubusercontent.com" {
+				return nil, context.DeadlineExceeded
+			}
+			return roundTripper.RoundTrip(req)
+		})
+		assert.Equal(t, []string{"fast.proxy", "slow.proxy", ""}, selector.Candidates(context.Background()))
+	})
+
+	t.Run("cache the ranking", func(t *testing.T) {
+		cacheFile := path.Join(t.TempDir(), "github-proxy.json")
+		var count int32
+		assert.Equal(t, []string{"fast.proxy", "slow.proxy", ""}, newSelector(cacheFile, &count).Candidates(context.Background()))
+
+		// the cached ranking is used without probing
+		count = 0
+		selector := newSelector(cacheFile, &count)
+		assert.Equal(t, []string{"fast.proxy", "slow.proxy", ""}, selector.Candidates(context.Background()))
+		assert.Zero(t, count)
+
+		// the failed server goes to the end
+		selector.Demote("fast.proxy")
+		assert.Equal(t, []string{"slow.proxy", "fast.proxy", ""}, newSelector(cacheFile, &count).Candidates(context.Background()))
+		assert.Zero(t, count)
+
+		// probe again once it's expired
+		selector = newSelector(cacheFile, &count)
+		selector.TTL = time.Nanosecond
+		assert.Equal(t, []string{"fast.proxy", "slow.proxy", ""}, selector.Candidates(context.Background()))
+		assert.NotZero(t, count)
+
+		// probe again if the servers are changed
+		count = 0
+		selector = newSelector(cacheFile, &count)
+		selector.Servers = []string{"fast.proxy"}
+		assert.Equal(t, []string{"fast.proxy", ""}, selector.Candidates(context.Background()))
+		assert.Equal(t, int32(2), count)
+	})
+
+	t.Run("the ranking is not cached if it's canceled", func(t *testing.T) {
+		cacheFile := path.Join(t.TempDir(), "github-proxy.json")
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var count int32
+		assert.Equal(t, []string{""}, newSelector(cacheFile, &count).Candidates(ctx))
+		assert.NoFileExists(t, cacheFile)
+	})
+}
@@ -3,19 +3,14 @@ package net
 import (
 	"context"
 	"crypto/tls"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"path"
 	"strconv"
-	"strings"
 	"time"
-
-	"github.com/linuxsuren/http-downloader/pkg/common"
 )
 
 const (
@@ -31,14 +26,20 @@ type HTTPDownloader struct {
 	URL                string
 	ShowProgress       bool
 	InsecureSkipVerify bool
-	Context            context.Context
+	// TLSConfig has the custom CA certificates and the client certificate, see NewTLSConfig
+	TLSConfig *tls.Config
+	Context   context.Context
 
+	// UserName and Password are only sent to the host of the URL, the password is the bearer token if
+	// there's no username
 	UserName string
 	Password string
 
 	NoProxy   bool
 	Proxy     string
 	ProxyAuth string
+	// NoProxyHosts is a comma-separated list of the hosts which bypass the proxy, see NoProxyMatcher
+	NoProxyHosts string
 
 	Header map[string]string
 
@@ -48,62 +49,72 @@ type HTTPDownloader struct {
 	Thread  int
 	Title   string
 	Timeout time.Duration
-	// MaxAttempts int
+	// Observer receives the progress events, the progress bar is rendered if it's nil and ShowProgress is true
+	Observer ProgressObserver
+	// Chunk is the number of the chunk in the progress events, zero means the whole file
+	Chunk int
+	// RetryPolicy decides how to retry the request, the default policy is used if it's nil
+	RetryPolicy *RetryPolicy
+	// RateLimiter limits the bandwidth, it could be shared with other downloaders
+	RateLimiter *RateLimiter
+	// Cache stores the whole file, and sends the conditional request if it was cached
+	Cache *Cache
+	// CookieJar provides the cookies of the requests, and keeps the cookies of the responses
+	CookieJar http.CookieJar
+	// Credentials provides the credential of each host, UserName and Password go first for the host of the URL
+	Credentials CredentialResolver
+	// RedirectFilename suggests the last segment of the redirected URL if there's no Content-Disposition header
+	RedirectFilename bool
 
 	Debug             bool
 	RoundTripper      http.RoundTripper
-	progressIndicator *ProgressIndicator
 	suggestedFilename string
+	contentType       string
 }
 
-// SetProxy set the proxy for a http
-func SetProxy(proxy, proxyAuth string, tr *http.Transport) (err error) {
-	if proxy == "" {
-		return
-	}
-
-	var proxyURL *url.URL
-	if proxyURL, err = url.Parse(proxy); err != nil {
-		return
-	}
-
-	tr.Proxy = http.ProxyURL(proxyURL)
-
-	if proxyAuth != "" {
-		basicAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(proxyAuth))
-		tr.ProxyConnectHeader = http.Header{}
-		tr.ProxyConnectHeader.Add("Proxy-Authorization", basicAuth)
+// getTLSConfig returns a copy of the TLS config with the InsecureSkipVerify
+func (h *HTTPDownloader) getTLSConfig() (config *tls.Config) {
+	if h.TLSConfig != nil {
+		config = h.TLSConfig.Clone()
+	} else {
+		config = &tls.Config{}
 	}
+	config.InsecureSkipVerify = config.InsecureSkipVerify || h.InsecureSkipVerify
 	return
 }
 
-func (h *HTTPDownloader) fetchProxyFromEnv(scheme string) {
-	allProxy := common.GetEnvironment("ALL_PROXY", "all_proxy")
-	if allProxy != "" {
-		h.Proxy = allProxy
-	} else {
-		switch scheme {
-		case "http":
-			httpProxy := common.GetEnvironment("HTTP_PROXY", "http_proxy")
-			if httpProxy != "" {
-				h.Proxy = httpProxy
-			}
-		case "https":
-			httpsProxy := common.GetEnvironment("HTTPS_PROXY", "https_proxy")
-			if httpsProxy != "" {
-				h.Proxy = httpsProxy
-			}
-		}
+// getObserver returns the observer, or the default one if it's going to show the progress
+func (h *HTTPDownloader) getObserver() ProgressObserver {
+	if h.Observer == nil && h.ShowProgress {
+		return defaultProgressObserver()
 	}
+	return h.Observer
 }
 
 // DownloadAsStream downloads the file as stream
 func (h *HTTPDownloader) DownloadAsStream(writer io.Writer) (err error) {
-	filepath, downloadURL, showProgress := h.TargetFilePath, h.URL, h.ShowProgress
-	// Get the data
+	return h.download(func() (io.Writer, error) {
+		return writer, nil
+	})
+}
+
+// download sends the request, then writes the response body into the writer
+// which only be created once the response is accepted
+func (h *HTTPDownloader) download(getWriter func() (io.Writer, error)) (err error) {
+	filepath, downloadURL := h.TargetFilePath, h.URL
+	if h.Title == "" {
+		h.Title = "Downloading"
+	}
 	if h.Context == nil {
 		h.Context = context.Background()
 	}
+	reporter := newProgressReporter(h.getObserver(), downloadURL, h.Title, h.Chunk)
+	defer func() {
+		err = checkCanceled(h.Context, err)
+		reporter.finish(err)
+	}()
+
+	// Get the data
 	req, err := http.NewRequestWithContext(h.Context, http.MethodGet, downloadURL, nil)
 	if err != nil {
 		return err
@@ -113,79 +124,120 @@ func (h *HTTPDownloader) DownloadAsStream(writer io.Writer) (err error) {
 		req.Header.Set(k, v)
 	}
 
-	if h.UserName != "" && h.Password != "" {
-		req.SetBasicAuth(h.UserName, h.Password)
-	} else if h.Password != "" {
-		req.Header.Set("Authorization", "Bearer "+h.Password)
-	}
-
-	var tr http.RoundTripper
-	if h.RoundTripper != nil {
-		tr = h.RoundTripper
-	} else {
-		trp := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: h.InsecureSkipVerify},
-			DialContext: (&net.Dialer{
-				Timeout: h.Timeout,
-			}).DialContext,
-		}
-
-		if !h.NoProxy {
-			h.fetchProxyFromEnv(req.URL.Scheme)
-			if err = SetProxy(h.Proxy, h.ProxyAuth, trp); err != nil {
-				return err
+	// only the request of the whole file is able to use the cache
+	cacheable := h.Cache != nil && req.Header.Get("Range") == ""
+	var cacheEntry *CacheEntry
+	if cacheable {
+		if cacheEntry = h.Cache.Get(downloadURL); cacheEntry != nil {
+			if cacheEntry.ETag != "" {
+				req.Header.Set("If-None-Match", cacheEntry.ETag)
 			}
-
-			if h.Proxy != "" {
-				basicAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(h.ProxyAuth))
-				req.Header.Add("Proxy-Authorization", basicAuth)
+			if cacheEntry.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cacheEntry.LastModified)
 			}
 		}
-		tr = trp
 	}
-	client := *NewRetryClient(http.Client{
-		Transport: tr,
-	})
+
+	var client *RetryClient
+	if client, err = h.newClient(req.URL.Scheme); err != nil {
+		return err
+	}
+	client.Policy = reporter.withRetry(client.Policy)
 	var resp *http.Response
 
 	if resp, err = client.Do(req); err != nil {
 		return err
 	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+	var body io.Reader = resp.Body
+	var cacheWriter *CacheWriter
+	if resp.StatusCode == http.StatusNotModified && cacheEntry != nil {
+		var cacheFile *os.File
+		if cacheFile, err = h.Cache.Open(cacheEntry); err != nil {
+			return
+		}
+		defer func() {
+			_ = cacheFile.Close()
+		}()
+		body = cacheFile
+		resp.Header.Set("Content-Length", strconv.FormatInt(cacheEntry.Size, 10))
+	} else if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
 		return &DownloadError{
 			Message:    fmt.Sprintf("failed to download from '%s'", downloadURL),
 			StatusCode: resp.StatusCode,
 		}
 	}
 
-	h.suggestedFilename = ParseSuggestedFilename(resp.Header, filepath)
+	h.suggestedFilename = suggestFilename(resp, downloadURL, filepath, h.RedirectFilename)
+	h.contentType = resp.Header.Get(ContentType)
 
 	// pre-hook before get started to download file
 	if h.PreStart != nil && !h.PreStart(resp) {
 		return nil
 	}
 
-	if h.Title == "" {
-		h.Title = "Downloading"
+	var writer io.Writer
+	if writer, err = getWriter(); err != nil {
+		return
 	}
-	h.progressIndicator = &ProgressIndicator{
-		Title: h.Title,
+	total := int64(-1)
+	if fileLength, parseErr := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); parseErr == nil {
+		total = fileLength
 	}
-	if showProgress {
-		if total, ok := resp.Header["Content-Length"]; ok && len(total) > 0 {
-			fileLength, err := strconv.ParseInt(total[0], 10, 64)
-			if err == nil {
-				h.progressIndicator.Total = float64(fileLength)
-			}
+	reporter.start(total, 0, 0)
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if cacheable && resp.StatusCode == http.StatusOK && (etag != "" || lastModified != "") {
+		if cacheWriter, err = h.Cache.NewWriter(downloadURL, etag, lastModified); err != nil {
+			return
 		}
+		body = io.TeeReader(body, cacheWriter)
 	}
 
-	h.progressIndicator.Writer = writer
-	h.progressIndicator.Init()
-
 	// Write the body to file
-	_, err = io.Copy(h.progressIndicator, resp.Body)
+	if _, err = io.Copy(&progressWriter{writer: writer, reporter: reporter}, NewRateLimitReader(h.Context, body, h.RateLimiter)); cacheWriter != nil {
+		if err == nil {
+			_, _ = cacheWriter.Commit()
+		} else {
+			cacheWriter.Abort()
+		}
+	}
+	return
+}
+
+// newClient returns the client which has the proxy, TLS and credential settings, it retries the
+// requests according to the policy
+func (h *HTTPDownloader) newClient(scheme string) (client *RetryClient, err error) {
+	var tr http.RoundTripper
+	if h.RoundTripper != nil {
+		tr = h.RoundTripper
+	} else {
+		trp := &http.Transport{
+			TLSClientConfig: h.getTLSConfig(),
+			DialContext: (&net.Dialer{
+				Timeout: h.Timeout,
+			}).DialContext,
+		}
+
+		if !h.NoProxy {
+			proxy, noProxyHosts := h.getProxy(scheme)
+			if err = SetProxyWithNoProxy(proxy, h.ProxyAuth, noProxyHosts, trp); err != nil {
+				return
+			}
+		}
+		tr = trp
+	}
+	client = NewRetryClient(http.Client{
+		Transport: NewCredentialTransport(tr, WithHostCredential(h.Credentials, h.URL, h.UserName, h.Password)),
+		Jar:       h.CookieJar,
+	})
+	if client.Policy = h.RetryPolicy; client.Policy == nil {
+		client.Policy = DefaultRetryPolicy()
+		client.Policy.MaxAttempts = client.MaxAttempts
+	}
 	return
 }
 
@@ -196,17 +248,19 @@ func (h *HTTPDownloader) DownloadFile() (err error) {
 		return
 	}
 
-	// Create the file
-	var out io.WriteCloser
-	out, err = os.Create(filepath)
-	if err != nil {
-		return
-	}
+	// create the file only when the response is ready to write
+	var out *os.File
 	defer func() {
-		_ = out.Close()
+		if out != nil {
+			_ = out.Close()
+		}
 	}()
 
-	err = h.DownloadAsStream(out)
+	err = h.download(func() (io.Writer, error) {
+		var createErr error
+		out, createErr = os.Create(filepath)
+		return out, createErr
+	})
 	return err
 }
 
@@ -216,6 +270,11 @@ func (h *HTTPDownloader) GetSuggestedFilename() string {
 	return h.suggestedFilename
 }
 
+// GetContentType returns the content type of the response
+func (h *HTTPDownloader) GetContentType() string {
+	return h.contentType
+}
+
 // SuggestedFilenameAware is the interface for getting suggested filename
 type SuggestedFilenameAware interface {
 	GetSuggestedFilename() string
@@ -231,13 +290,13 @@ func DownloadFileWithMultipleThreadKeepParts(targetURL, targetFilePath string, t
 // ContinueDownloader is a downloader which support continuously download
 type ContinueDownloader struct {
 	downloader *HTTPDownloader
+	// rangeErr means the server ignored the range, it returned the data from the beginning
+	rangeErr error
 
 	UserName, Password string
 	Timeout            time.Duration
 	Context            context.Context
-	roundTripper       http.RoundTripper
-	noProxy            bool
-	insecureSkipVerify bool
+	options            Options
 }
 
 // GetSuggestedFilename returns the suggested filename
@@ -245,21 +304,46 @@ func (c *ContinueDownloader) GetSuggestedFilename() string {
 	return c.downloader.GetSuggestedFilename()
 }
 
+// GetContentType returns the content type of the response
+func (c *ContinueDownloader) GetContentType() string {
+	return c.downloader.GetContentType()
+}
+
+// WithOptions sets all the options, the threads and mirrors of the options are not used
+func (c *ContinueDownloader) WithOptions(options Options) *ContinueDownloader {
+	c.options = options
+	c.UserName, c.Password, c.Timeout = options.Username, options.Password, options.Timeout
+	return c
+}
+
 // WithRoundTripper set WithRoundTripper
 func (c *ContinueDownloader) WithRoundTripper(roundTripper http.RoundTripper) *ContinueDownloader {
-	c.roundTripper = roundTripper
+	c.options.RoundTripper = roundTripper
 	return c
 }
 
 // WithoutProxy indicate no HTTP proxy use
 func (c *ContinueDownloader) WithoutProxy(noProxy bool) *ContinueDownloader {
-	c.noProxy = noProxy
+	c.options.NoProxy = noProxy
+	return c
+}
+
+// WithProxy sets the proxy, and the comma-separated hosts which bypass the proxy
+func (c *ContinueDownloader) WithProxy(proxy, noProxyHosts string) *ContinueDownloader {
+	c.options.Proxy = proxy
+	c.options.NoProxyHosts = noProxyHosts
 	return c
 }
 
 // WithInsecureSkipVerify set if skip the insecure verify
 func (c *ContinueDownloader) WithInsecureSkipVerify(insecureSkipVerify bool) *ContinueDownloader {
-	c.insecureSkipVerify = insecureSkipVerify
+	c.options.InsecureSkipVerify = insecureSkipVerify
+	return c
+}
+
+// WithTLSConfig sets the TLS config which has the custom CA certificates and the client certificate
+func (c *ContinueDownloader) WithTLSConfig(config *tls.Config) *ContinueDownloader {
+	c.options.TLSConfig = config
 	return c
 }
 
@@ -282,69 +366,104 @@ func (c *ContinueDownloader) WithBasicAuth(username, password string) *ContinueD
 	return c
 }
 
-// DownloadWithContinueAsStream downloads the files continuously
-func (c *ContinueDownloader) DownloadWithContinueAsStream(targetURL string, output io.Writer, index, continueAt, end int64, showProgress bool) (err error) {
-	c.downloader = &HTTPDownloader{
-		URL:                targetURL,
-		ShowProgress:       showProgress,
-		NoProxy:            c.noProxy,
-		RoundTripper:       c.roundTripper,
-		InsecureSkipVerify: c.insecureSkipVerify,
-		UserName:           c.UserName,
-		Password:           c.Password,
-		Context:            c.Context,
-		Timeout:            c.Timeout,
-	}
+// WithRetryPolicy sets the retry policy
+func (c *ContinueDownloader) WithRetryPolicy(policy *RetryPolicy) *ContinueDownloader {
+	c.options.RetryPolicy = policy
+	return c
+}
+
+// WithRateLimiter sets the rate limiter
+func (c *ContinueDownloader) WithRateLimiter(limiter *RateLimiter) *ContinueDownloader {
+	c.options.RateLimiter = limiter
+	return c
+}
+
+// WithCache sets the cache
+func (c *ContinueDownloader) WithCache(cache *Cache) *ContinueDownloader {
+	c.options.Cache = cache
+	return c
+}
+
+// WithHeader sets the custom HTTP headers
+func (c *ContinueDownloader) WithHeader(header map[string]string) *ContinueDownloader {
+	c.options.Header = header
+	return c
+}
+
+// WithCookieJar sets the cookie jar
+func (c *ContinueDownloader) WithCookieJar(jar http.CookieJar) *ContinueDownloader {
+	c.options.CookieJar = jar
+	return c
+}
+
+// WithCredentials sets the credentials of the hosts
+func (c *ContinueDownloader) WithCredentials(credentials CredentialResolver) *ContinueDownloader {
+	c.options.Credentials = credentials
+	return c
+}
+
+// WithObserver sets the observer of the progress events
+func (c *ContinueDownloader) WithObserver(observer ProgressObserver) *ContinueDownloader {
+	c.options.Observer = observer
+	return c
+}
+
+// newDownloader returns the downloader of the range, the exported fields take precedence over the options
+func (c *ContinueDownloader) newDownloader(targetURL, output string, index, continueAt, end int64,
+	showProgress bool) *HTTPDownloader {
+	options := c.options
+	options.Username, options.Password, options.Timeout = c.UserName, c.Password, c.Timeout
+	options.ShowProgress = showProgress
+
+	downloader := options.newHTTPDownloader(c.Context, targetURL, output)
 	if index >= 0 {
-		c.downloader.Title = fmt.Sprintf("Downloading part %d", index)
+		downloader.Title = fmt.Sprintf("Downloading part %d", index)
+		downloader.Chunk = int(index) + 1
 	}
-
 	if continueAt >= 0 {
-		c.downloader.Header = make(map[string]string, 1)
-
 		if end > continueAt {
-			c.downloader.Header["Range"] = fmt.Sprintf("bytes=%d-%d", continueAt, end)
+			downloader.Header["Range"] = fmt.Sprintf("bytes=%d-%d", continueAt, end)
 		} else {
-			c.downloader.Header["Range"] = fmt.Sprintf("bytes=%d-", continueAt)
+			downloader.Header["Range"] = fmt.Sprintf("bytes=%d-", continueAt)
 		}
 	}
 
-	if err = c.downloader.DownloadAsStream(output); err != nil {
-		err = fmt.Errorf("cannot download from %s, error: %v", targetURL, err)
+	c.rangeErr = nil
+	if continueAt > 0 || end > 0 {
+		// the data must not be written at the offset if it starts from the beginning
+		downloader.PreStart = func(resp *http.Response) bool {
+			if resp.StatusCode != http.StatusPartialContent {
+				c.rangeErr = &DownloadError{
+					Message:    fmt.Sprintf("'%s' does not support the range request", targetURL),
+					StatusCode: resp.StatusCode,
+				}
+			}
+			return c.rangeErr == nil
+		}
 	}
-	return
+	return downloader
 }
 
-// DownloadWithContinue downloads the files continuously
-func (c *ContinueDownloader) DownloadWithContinue(targetURL, output string, index, continueAt, end int64, showProgress bool) (err error) {
-	c.downloader = &HTTPDownloader{
-		TargetFilePath:     output,
-		URL:                targetURL,
-		ShowProgress:       showProgress,
-		NoProxy:            c.noProxy,
-		RoundTripper:       c.roundTripper,
-		InsecureSkipVerify: c.insecureSkipVerify,
-		UserName:           c.UserName,
-		Password:           c.Password,
-		Context:            c.Context,
-		Timeout:            c.Timeout,
+// DownloadWithContinueAsStream downloads the files continuously
+func (c *ContinueDownloader) DownloadWithContinueAsStream(targetURL string, output io.Writer, index, continueAt, end int64, showProgress bool) (err error) {
+	c.downloader = c.newDownloader(targetURL, "", index, continueAt, end, showProgress)
+	if err = c.downloader.DownloadAsStream(output); err == nil {
+		err = c.rangeErr
 	}
-	if index >= 0 {
-		c.downloader.Title = fmt.Sprintf("Downloading part %d", index)
+	if err != nil {
+		err = fmt.Errorf("cannot download from %s, error: %w", targetURL, err)
 	}
+	return
+}
 
-	if continueAt >= 0 {
-		c.downloader.Header = make(map[string]string, 1)
-
-		if end > continueAt {
-			c.downloader.Header["Range"] = fmt.Sprintf("bytes=%d-%d", continueAt, end)
-		} else {
-			c.downloader.Header["Range"] = fmt.Sprintf("bytes=%d-", continueAt)
-		}
+// DownloadWithContinue downloads the files continuously
+func (c *ContinueDownloader) DownloadWithContinue(targetURL, output string, index, continueAt, end int64, showProgress bool) (err error) {
+	c.downloader = c.newDownloader(targetURL, output, index, continueAt, end, showProgress)
+	if err = c.downloader.DownloadFile(); err == nil {
+		err = c.rangeErr
 	}
-
-	if err = c.downloader.DownloadFile(); err != nil {
-		err = fmt.Errorf("cannot download from %s, error: %v", targetURL, err)
+	if err != nil {
+		err = fmt.Errorf("cannot download from %s, error: %w", targetURL, err)
 	}
 	return
 }
@@ -352,46 +471,50 @@ func (c *ContinueDownloader) DownloadWithContinue(targetURL, output string, inde
 // DetectSizeWithRoundTripperAndAuthStream returns the size of target resource
 func DetectSizeWithRoundTripperAndAuthStream(targetURL string, output io.Writer, showProgress, noProxy, insecureSkipVerify bool,
 	roundTripper http.RoundTripper, username, password string, timeout time.Duration) (total int64, rangeSupport bool, err error) {
-	downloader := HTTPDownloader{
-		URL:                targetURL,
-		ShowProgress:       showProgress,
-		RoundTripper:       roundTripper,
-		NoProxy:            false, // below HTTP request does not need proxy
-		InsecureSkipVerify: insecureSkipVerify,
-		UserName:           username,
-		Password:           password,
-		Timeout:            timeout,
-	}
-
-	var detectOffset int64
-	var lenErr error
-
-	detectOffset = 2
-	downloader.Header = make(map[string]string, 1)
-	downloader.Header["Range"] = fmt.Sprintf("bytes=%d-", detectOffset)
-
-	downloader.PreStart = func(resp *http.Response) bool {
-		rangeSupport = resp.StatusCode == http.StatusPartialContent
-		contentLen := resp.Header.Get("Content-Length")
-		if total, lenErr = strconv.ParseInt(contentLen, 10, 0); lenErr == nil {
-			total += detectOffset
-		} else {
-			rangeSupport = false
-		}
-		//  always return false because we just want to get the header from response
-		return false
-	}
+	downloader := newDetectDownloader(context.Background(), targetURL, "", showProgress, insecureSkipVerify, roundTripper,
+		username, password, timeout)
 
-	if err = downloader.DownloadAsStream(output); err != nil || lenErr != nil {
-		err = fmt.Errorf("cannot download from %s, response error: %v, content length error: %v", targetURL, err, lenErr)
-	}
+	var info resourceInfo
+	info, err = detectResource(targetURL, downloader, func() error {
+		return downloader.DownloadAsStream(output)
+	})
+	total, rangeSupport = info.total, info.rangeSupport
 	return
 }
 
 // DetectSizeWithRoundTripperAndAuth returns the size of target resource
 func DetectSizeWithRoundTripperAndAuth(targetURL, output string, showProgress, noProxy, insecureSkipVerify bool,
 	roundTripper http.RoundTripper, username, password string, timeout time.Duration) (total int64, rangeSupport bool, err error) {
-	downloader := HTTPDownloader{
+	return DetectSizeWithHeader(targetURL, output, showProgress, insecureSkipVerify, roundTripper, username, password,
+		nil, nil, timeout)
+}
+
+// DetectSizeWithHeader returns the size of target resource, the custom headers and cookies are sent with the request
+func DetectSizeWithHeader(targetURL, output string, showProgress, insecureSkipVerify bool, roundTripper http.RoundTripper,
+	username, password string, header map[string]string, jar http.CookieJar, timeout time.Duration) (total int64, rangeSupport bool, err error) {
+	return DetectSizeWithContext(context.Background(), targetURL, output, showProgress, insecureSkipVerify, roundTripper,
+		username, password, header, jar, timeout)
+}
+
+// DetectSizeWithContext is the same as DetectSizeWithHeader, it returns ErrCanceled if the context is done
+func DetectSizeWithContext(ctx context.Context, targetURL, output string, showProgress, insecureSkipVerify bool,
+	roundTripper http.RoundTripper, username, password string, header map[string]string, jar http.CookieJar,
+	timeout time.Duration) (total int64, rangeSupport bool, err error) {
+	downloader := newDetectDownloader(ctx, targetURL, output, showProgress, insecureSkipVerify, roundTripper,
+		username, password, timeout)
+	downloader.Header = cloneHeader(header)
+	downloader.CookieJar = jar
+
+	var info resourceInfo
+	info, err = detectResource(targetURL, downloader, downloader.DownloadFile)
+	total, rangeSupport = info.total, info.rangeSupport
+	return
+}
+
+func newDetectDownloader(ctx context.Context, targetURL, output string, showProgress, insecureSkipVerify bool,
+	roundTripper http.RoundTripper, username, password string, timeout time.Duration) *HTTPDownloader {
+	return &HTTPDownloader{
+		Context:            ctx,
 		TargetFilePath:     output,
 		URL:                targetURL,
 		ShowProgress:       showProgress,
@@ -402,29 +525,48 @@ func DetectSizeWithRoundTripperAndAuth(targetURL, output string, showProgress, n
 		Password:           password,
 		Timeout:            timeout,
 	}
+}
 
+// detectResource sends a range request to find out the size, range support and validators of the resource
+func detectResource(targetURL string, downloader *HTTPDownloader, download func() error) (info resourceInfo, err error) {
 	var detectOffset int64
 	var lenErr error
 
 	detectOffset = 2
-	downloader.Header = make(map[string]string, 1)
+	if downloader.Header == nil {
+		downloader.Header = make(map[string]string, 1)
+	}
 	downloader.Header["Range"] = fmt.Sprintf("bytes=%d-", detectOffset)
 
 	downloader.PreStart = func(resp *http.Response) bool {
-		rangeSupport = resp.StatusCode == http.StatusPartialContent
+		info.rangeSupport = resp.StatusCode == http.StatusPartialContent
+		info.etag = resp.Header.Get("ETag")
+		info.lastModified = resp.Header.Get("Last-Modified")
+		info.contentType = resp.Header.Get(ContentType)
 		contentLen := resp.Header.Get("Content-Length")
-		if total, lenErr = strconv.ParseInt(contentLen, 10, 0); lenErr == nil {
-			total += detectOffset
+		if info.total, lenErr = strconv.ParseInt(contentLen, 10, 0); lenErr == nil {
+			info.total += detectOffset
 		} else {
-			rangeSupport = false
+			info.rangeSupport = false
 		}
 		//  always return false because we just want to get the header from response
 		return false
 	}
 
-	if err = downloader.DownloadFile(); err != nil || lenErr != nil {
+	if err = download(); err != nil || lenErr != nil {
 		err = fmt.Errorf("cannot download from %s, response error: %v, content length error: %v", targetURL, err, lenErr)
 	}
+	err = checkCanceled(downloader.Context, err)
+	info.filename = downloader.GetSuggestedFilename()
+	return
+}
+
+// cloneHeader copies the headers, so that it's safe to add the request specific headers
+func cloneHeader(header map[string]string) (cloned map[string]string) {
+	cloned = make(map[string]string, len(header)+1)
+	for k, v := range header {
+		cloned[k] = v
+	}
 	return
 }
 
@@ -435,17 +577,12 @@ func DetectSizeWithRoundTripper(targetURL, output string, showProgress, noProxy,
 	return DetectSizeWithRoundTripperAndAuth(targetURL, output, showProgress, noProxy, insecureSkipVerify, roundTripper, "", "", timeout)
 }
 
-// ParseSuggestedFilename parse the filename from resp header,More details from  https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Disposition
+// ParseSuggestedFilename parses the filename from the Content-Disposition header, see ParseContentDisposition.
+// It returns an empty string if the filename is the same as the target file.
+// More details from https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Disposition
 func ParseSuggestedFilename(header http.Header, filepath string) (filename string) {
-	if disposition, ok := header["Content-Disposition"]; ok && len(disposition) >= 1 {
-		if index := strings.LastIndex(disposition[0], `filename=`); index != -1 {
-			filename = disposition[0][index+len(`filename=`):]
-			filename = strings.TrimPrefix(filename, `"`)
-			filename = strings.TrimSuffix(filename, `"`)
-			if filename == filepath {
-				filename = ""
-			}
-		}
+	if filename = ParseContentDisposition(header.Get("Content-Disposition")); filename == path.Base(filepath) {
+		filename = ""
 	}
 	return
 }
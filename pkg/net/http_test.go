@@ -2,11 +2,18 @@ package net_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/linuxsuren/http-downloader/mock/mhttp"
 	"github.com/linuxsuren/http-downloader/pkg/net"
@@ -257,42 +264,56 @@ func TestDetectSize(t *testing.T) {
 	assert.True(t, rangeSupport)
 }
 
+func TestContinueDownloaderRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/norange") {
+			_, _ = w.Write([]byte(fakeContent))
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(fakeContent))
+	}))
+	defer server.Close()
+
+	buf := new(bytes.Buffer)
+	downloader := (&net.ContinueDownloader{}).WithRetryPolicy(net.DefaultRetryPolicy().WithoutRetry())
+	assert.Nil(t, downloader.DownloadWithContinueAsStream(server.URL+"/target", buf, 0, 10, 19, false))
+	assert.Equal(t, fakeContent[10:20], buf.String())
+
+	// the data from the beginning must not be written at the offset
+	buf.Reset()
+	err := downloader.DownloadWithContinueAsStream(server.URL+"/norange", buf, 0, 10, 19, false)
+	var downloadErr *net.DownloadError
+	if assert.True(t, errors.As(err, &downloadErr)) {
+		assert.Equal(t, http.StatusOK, downloadErr.StatusCode)
+	}
+	assert.Empty(t, buf.String())
+
+	// it's fine without the range
+	assert.Nil(t, downloader.DownloadWithContinueAsStream(server.URL+"/norange", buf, -1, -1, 0, false))
+	assert.Equal(t, fakeContent, buf.String())
+}
+
 func TestMultiThreadDownloader(t *testing.T) {
 	const url = "https://foo.com"
 	tests := []struct {
 		name           string
 		thread         int
 		expectFilename string
+		expectContent  string
 		prepare        func(*testing.T, *net.MultiThreadDownloader)
 		wantErr        bool
 	}{{
 		name:   "download with 2 threads",
 		thread: 2,
 		prepare: func(t *testing.T, downloader *net.MultiThreadDownloader) {
-			ctrl := gomock.NewController(t)
-			roundTripper := mhttp.NewMockRoundTripper(ctrl)
-
-			// for size detecting
-			mockRequest, _ := http.NewRequest(http.MethodGet, url, nil)
-			mockRequest.Header.Set("Range", "bytes=2-")
-			mockResponse := &http.Response{
-				StatusCode: http.StatusPartialContent,
-				Proto:      "HTTP/1.1",
-				Request:    mockRequest,
-				Header: map[string][]string{
-					"Content-Length": {"100"},
-				},
-				Body: io.NopCloser(bytes.NewBufferString("responseBody")),
-			}
-			roundTripper.EXPECT().RoundTrip(gomock.Any()).Return(mockResponse, nil).AnyTimes()
-
 			downloader.WithoutProxy(true).
 				WithShowProgress(false).
-				WithRoundTripper(roundTripper).
+				WithRoundTripper(newRangeRoundTripper(fakeContent)).
 				WithKeepParts(false).
 				WithInsecureSkipVerify(true)
 		},
-		wantErr: false,
+		expectContent: fakeContent,
+		wantErr:       false,
 	}, {
 		name:   "download with 1 thread",
 		thread: 1,
@@ -399,10 +420,182 @@ func TestMultiThreadDownloader(t *testing.T) {
 				assert.Nil(t, err, "should not have error in case [%d]-[%s]", i, tt.name)
 			}
 			assert.Equal(t, tt.expectFilename, downloader.GetSuggestedFilename())
+			if tt.expectContent != "" {
+				data, readErr := os.ReadFile(f.Name())
+				assert.Nil(t, readErr)
+				assert.Equal(t, tt.expectContent, string(data))
+				assert.NoFileExists(t, f.Name()+net.StateFileSuffix)
+			}
 		})
 	}
 }
 
+func TestMultiThreadDownloaderResume(t *testing.T) {
+	const url = "https://foo.com"
+	targetFile := path.Join(t.TempDir(), "target")
+
+	// the first chunk was finished, the second one was downloaded partially
+	state := fmt.Sprintf(`{"url":%q,"total":%d,"chunks":[{"start":0,"end":49,"completed":50},{"start":50,"end":99,"completed":10}]}`,
+		url, len(fakeContent))
+	assert.Nil(t, os.WriteFile(targetFile+net.StateFileSuffix, []byte(state), 0600))
+	assert.Nil(t, os.WriteFile(targetFile+net.DownloadingFileSuffix, []byte(fakeContent[:60]+strings.Repeat("x", 40)), 0600))
+
+	var ranges []string
+	roundTripper := newRangeRoundTripper(fakeContent)
+	downloader := &net.MultiThreadDownloader{}
+	downloader.WithShowProgress(false).WithRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		return roundTripper.RoundTrip(req)
+	}))
+
+	err := downloader.Download(url, targetFile, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bytes=2-", "bytes=60-99"}, ranges)
+
+	data, err := os.ReadFile(targetFile)
+	assert.Nil(t, err)
+	assert.Equal(t, fakeContent, string(data))
+	assert.NoFileExists(t, targetFile+net.StateFileSuffix)
+	assert.NoFileExists(t, targetFile+net.DownloadingFileSuffix)
+	assert.NoFileExists(t, targetFile+"-1")
+}
+
+func TestMultiThreadDownloaderRemoteChanged(t *testing.T) {
+	const url = "https://foo.com"
+	targetFile := path.Join(t.TempDir(), "target")
+
+	state := fmt.Sprintf(`{"url":%q,"etag":"\"old\"","total":%d,"chunks":[{"start":0,"end":99,"completed":10}]}`,
+		url, len(fakeContent))
+	assert.Nil(t, os.WriteFile(targetFile+net.StateFileSuffix, []byte(state), 0600))
+	assert.Nil(t, os.WriteFile(targetFile+net.DownloadingFileSuffix, []byte(strings.Repeat("x", 100)), 0600))
+
+	downloader := &net.MultiThreadDownloader{}
+	downloader.WithShowProgress(false).WithRoundTripper(newRangeRoundTripper(fakeContent))
+	err := downloader.Download(url, targetFile, 2)
+	assert.Nil(t, err)
+
+	data, err := os.ReadFile(targetFile)
+	assert.Nil(t, err)
+	assert.Equal(t, fakeContent, string(data))
+}
+
+func TestMultiThreadDownloaderKeepParts(t *testing.T) {
+	targetFile := path.Join(t.TempDir(), "target")
+	downloader := &net.MultiThreadDownloader{}
+	downloader.WithShowProgress(false).WithKeepParts(true).WithRoundTripper(newRangeRoundTripper(fakeContent))
+
+	err := downloader.Download("https://foo.com", targetFile, 2)
+	assert.Nil(t, err)
+
+	for i, expect := range []string{fakeContent[:50], fakeContent[50:]} {
+		data, readErr := os.ReadFile(fmt.Sprintf("%s-%d", targetFile, i))
+		assert.Nil(t, readErr)
+		assert.Equal(t, expect, string(data))
+	}
+}
+
+func TestMultiThreadDownloadWithContext(t *testing.T) {
+	downloader := &net.MultiThreadDownloader{}
+	downloader.WithShowProgress(false).WithRoundTripper(newRangeRoundTripper(fakeContent))
+
+	// the writer does not support WriteAt
+	buf := new(bytes.Buffer)
+	err := downloader.DownloadWithContext(context.Background(), "https://foo.com", buf, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, fakeContent, buf.String())
+
+	// write into the file directly
+	f, err := os.Create(path.Join(t.TempDir(), "target"))
+	assert.Nil(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+	err = downloader.DownloadWithContext(context.Background(), "https://foo.com", f, 2)
+	assert.Nil(t, err)
+	data, err := os.ReadFile(f.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, fakeContent, string(data))
+}
+
+func TestMultiThreadDownloaderCanceled(t *testing.T) {
+	started := make(chan struct{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=2-" {
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(fakeContent))
+			return
+		}
+		// send a few bytes of the chunk, then hang until the client goes away
+		start, _, _ := strings.Cut(strings.TrimPrefix(r.Header.Get("Range"), "bytes="), "-")
+		offset, _ := strconv.Atoi(start)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+49, len(fakeContent)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte(fakeContent[offset : offset+10]))
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	t.Run("download into a file", func(t *testing.T) {
+		targetFile := path.Join(t.TempDir(), "target")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-started
+			<-started
+			cancel()
+		}()
+
+		downloader := &net.MultiThreadDownloader{}
+		err := downloader.WithShowProgress(false).DownloadFileWithContext(ctx, server.URL, targetFile, 2)
+		assert.True(t, errors.Is(err, net.ErrCanceled), err)
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.NoFileExists(t, targetFile)
+		// the progress is kept for resuming
+		assert.FileExists(t, targetFile+net.StateFileSuffix)
+	})
+
+	t.Run("download into a stream with deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		downloader := &net.MultiThreadDownloader{}
+		err := downloader.WithShowProgress(false).DownloadWithContext(ctx, server.URL, new(bytes.Buffer), 2)
+		assert.True(t, errors.Is(err, net.ErrCanceled), err)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("detect the size", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, _, err := net.DetectSizeWithContext(ctx, server.URL, path.Join(t.TempDir(), "target"), false, false, nil,
+			"", "", nil, nil, 0)
+		assert.True(t, errors.Is(err, net.ErrCanceled), err)
+	})
+}
+
+// fakeContent is a 100 bytes content for the range requests
+var fakeContent = strings.Repeat("0123456789", 10)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls the function
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newRangeRoundTripper returns a RoundTripper which serves the content with the range requests support
+func newRangeRoundTripper(content string) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		recorder := httptest.NewRecorder()
+		http.ServeContent(recorder, req, "", time.Time{}, strings.NewReader(content))
+		resp := recorder.Result()
+		resp.Request = req
+		return resp, nil
+	})
+}
+
 func Test_getSuggestedFilename(t *testing.T) {
 	type args struct {
 		header   http.Header
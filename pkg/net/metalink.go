@@ -0,0 +1,205 @@
+package net
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// MetalinkContentType is the media type of the Metalink document, see also RFC 5854
+	MetalinkContentType = "application/metalink4+xml"
+)
+
+// Metalink is a Metalink document which describes the mirrors and checksums of the files
+type Metalink struct {
+	XMLName xml.Name       `xml:"urn:ietf:params:xml:ns:metalink metalink"`
+	Files   []MetalinkFile `xml:"file"`
+}
+
+// MetalinkFile is a file of the Metalink document
+type MetalinkFile struct {
+	Name   string          `xml:"name,attr"`
+	Size   int64           `xml:"size"`
+	Hashes []MetalinkHash  `xml:"hash"`
+	Pieces *MetalinkPieces `xml:"pieces"`
+	URLs   []MetalinkURL   `xml:"url"`
+}
+
+// MetalinkHash is the hash of a whole file
+type MetalinkHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// MetalinkPieces is the hashes of the fixed length pieces of a file
+type MetalinkPieces struct {
+	Length int64    `xml:"length,attr"`
+	Type   string   `xml:"type,attr"`
+	Hashes []string `xml:"hash"`
+}
+
+// MetalinkURL is a mirror of a file, the lower priority goes first
+type MetalinkURL struct {
+	Priority int    `xml:"priority,attr"`
+	Location string `xml:"location,attr"`
+	URL      string `xml:",chardata"`
+}
+
+// PieceChecksums is the checksums of the fixed length pieces of a file, the last piece might be shorter
+type PieceChecksums struct {
+	Length    int64
+	Checksums []*Checksum
+}
+
+// IsMetalink checks if the content type or the extension of the name belongs to a Metalink document
+func IsMetalink(contentType, name string) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == MetalinkContentType {
+		return true
+	}
+
+	if urlObj, err := url.Parse(name); err == nil && urlObj.Scheme != "" {
+		name = urlObj.Path
+	}
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".meta4" || ext == ".metalink"
+}
+
+// ParseMetalink parses the Metalink document, and validates the files
+func ParseMetalink(reader io.Reader) (metalink *Metalink, err error) {
+	metalink = &Metalink{}
+	if err = xml.NewDecoder(reader).Decode(metalink); err != nil {
+		err = fmt.Errorf("invalid Metalink document, error: %v", err)
+	} else if len(metalink.Files) == 0 {
+		err = fmt.Errorf("no file found in the Metalink document")
+	}
+	for i := 0; err == nil && i < len(metalink.Files); i++ {
+		err = metalink.Files[i].validate()
+	}
+	if err != nil {
+		metalink = nil
+	}
+	return
+}
+
+func (f *MetalinkFile) validate() (err error) {
+	f.Name = strings.TrimSpace(f.Name)
+	// the name must be a relative path without the parent directory, see also RFC 5854 section 4.1.2.1
+	if f.Name == "" || path.IsAbs(f.Name) || strings.HasPrefix(f.Name, "\\") {
+		return fmt.Errorf("invalid file name '%s' in the Metalink document", f.Name)
+	}
+	for _, item := range strings.FieldsFunc(f.Name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if item == ".." {
+			return fmt.Errorf("invalid file name '%s' in the Metalink document", f.Name)
+		}
+	}
+
+	if len(f.Mirrors()) == 0 {
+		return fmt.Errorf("no HTTP URL found of the file '%s'", f.Name)
+	}
+
+	if f.Pieces != nil {
+		_, err = f.PieceChecksums()
+	}
+	return
+}
+
+// Mirrors returns the HTTP URLs which are sorted by the priority. The URL without
+// priority goes last.
+func (f *MetalinkFile) Mirrors() (mirrors []string) {
+	urls := make([]MetalinkURL, len(f.URLs))
+	copy(urls, f.URLs)
+	sort.SliceStable(urls, func(i, j int) bool {
+		return priorityOf(urls[i]) < priorityOf(urls[j])
+	})
+
+	for _, item := range urls {
+		if address := strings.TrimSpace(item.URL); strings.HasPrefix(address, "http://") ||
+			strings.HasPrefix(address, "https://") {
+			mirrors = append(mirrors, address)
+		}
+	}
+	return
+}
+
+func priorityOf(item MetalinkURL) int {
+	if item.Priority <= 0 {
+		// the lowest priority is 999999
+		return 1000000
+	}
+	return item.Priority
+}
+
+// Checksum returns the strongest supported checksum of the file, returns nil if there's no one
+func (f *MetalinkFile) Checksum() (checksum *Checksum) {
+	for _, algorithm := range []string{"sha512", "sha256", "sha1", "md5"} {
+		for _, item := range f.Hashes {
+			if normalizeHashAlgorithm(item.Type) != algorithm {
+				continue
+			}
+			if checksum, _ = ParseChecksum(fmt.Sprintf("%s:%s", algorithm, strings.TrimSpace(item.Value))); checksum != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// PieceChecksums returns the checksums of the pieces, returns nil if there's no pieces
+func (f *MetalinkFile) PieceChecksums() (pieces *PieceChecksums, err error) {
+	if f.Pieces == nil {
+		return
+	}
+
+	if f.Pieces.Length <= 0 {
+		err = fmt.Errorf("invalid piece length %d of the file '%s'", f.Pieces.Length, f.Name)
+		return
+	}
+	if f.Size > 0 && int64(len(f.Pieces.Hashes)) != (f.Size+f.Pieces.Length-1)/f.Pieces.Length {
+		err = fmt.Errorf("the count of pieces %d does not match the size of the file '%s'", len(f.Pieces.Hashes), f.Name)
+		return
+	}
+
+	pieces = &PieceChecksums{Length: f.Pieces.Length}
+	algorithm := normalizeHashAlgorithm(f.Pieces.Type)
+	for _, value := range f.Pieces.Hashes {
+		var checksum *Checksum
+		if checksum, err = ParseChecksum(fmt.Sprintf("%s:%s", algorithm, strings.TrimSpace(value))); err != nil {
+			pieces = nil
+			err = fmt.Errorf("invalid piece hash of the file '%s', error: %v", f.Name, err)
+			return
+		}
+		pieces.Checksums = append(pieces.Checksums, checksum)
+	}
+	return
+}
+
+// verify returns the indexes of the pieces which do not match the checksums
+func (p *PieceChecksums) verify(reader io.ReaderAt, total int64) (broken []int, err error) {
+	if count := (total + p.Length - 1) / p.Length; int64(len(p.Checksums)) != count {
+		err = fmt.Errorf("expected %d pieces, but the size %d has %d pieces", len(p.Checksums), total, count)
+		return
+	}
+
+	for i, checksum := range p.Checksums {
+		start := int64(i) * p.Length
+		length := p.Length
+		if start+length > total {
+			length = total - start
+		}
+
+		verifyErr := checksum.VerifyReader(io.NewSectionReader(reader, start, length), fmt.Sprintf("piece %d", i))
+		if _, ok := verifyErr.(*ChecksumError); ok {
+			broken = append(broken, i)
+		} else if verifyErr != nil {
+			err = verifyErr
+			return
+		}
+	}
+	return
+}
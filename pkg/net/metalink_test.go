@@ -0,0 +1,148 @@
+package net
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sampleMetalink = `<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="example.ext">
+    <size>14471447</size>
+    <hash type="md5">0d6fc8e88a8aa0d58ce9f5be3d7dd2f2</hash>
+    <hash type="sha-256">f0ad929cd259957e160ea442eb80986b5f01e3dc1b2d4cb1397e2e1d3e0d3bb2</hash>
+    <pieces length="262144" type="sha-1">
+      <hash>d96b9a4b92a899c2099b7b31bddb5ca423bb9b30</hash>
+    </pieces>
+    <url location="de" priority="2">https://ftp.de.example.com/example.ext</url>
+    <url>ftp://ftp.example.com/example.ext</url>
+    <url location="fr">https://ftp.fr.example.com/example.ext</url>
+    <url location="jp" priority="1">https://ftp.jp.example.com/example.ext</url>
+  </file>
+  <file name="dir/example2.ext">
+    <url>http://example.com/example2.ext</url>
+  </file>
+</metalink>`
+
+func TestParseMetalink(t *testing.T) {
+	metalink, err := ParseMetalink(strings.NewReader(sampleMetalink))
+	assert.NotNil(t, err, "the count of pieces does not match the size")
+	assert.Nil(t, metalink)
+
+	metalink, err = ParseMetalink(strings.NewReader(strings.ReplaceAll(sampleMetalink, "14471447", "262144")))
+	assert.Nil(t, err)
+	if assert.NotNil(t, metalink) && assert.Equal(t, 2, len(metalink.Files)) {
+		file := metalink.Files[0]
+		assert.Equal(t, "example.ext", file.Name)
+		assert.Equal(t, []string{
+			"https://ftp.jp.example.com/example.ext",
+			"https://ftp.de.example.com/example.ext",
+			"https://ftp.fr.example.com/example.ext",
+		}, file.Mirrors())
+		assert.Equal(t, &Checksum{
+			Algorithm: "sha256",
+			Value:     "f0ad929cd259957e160ea442eb80986b5f01e3dc1b2d4cb1397e2e1d3e0d3bb2",
+		}, file.Checksum())
+
+		pieces, err := file.PieceChecksums()
+		assert.Nil(t, err)
+		if assert.NotNil(t, pieces) {
+			assert.Equal(t, int64(262144), pieces.Length)
+			assert.Equal(t, "sha1:d96b9a4b92a899c2099b7b31bddb5ca423bb9b30", pieces.Checksums[0].String())
+		}
+
+		file = metalink.Files[1]
+		assert.Equal(t, "dir/example2.ext", file.Name)
+		assert.Nil(t, file.Checksum())
+		pieces, err = file.PieceChecksums()
+		assert.Nil(t, err)
+		assert.Nil(t, pieces)
+	}
+
+	invalidDocs := map[string]string{
+		"not XML":          "invalid",
+		"no namespace":     `<metalink><file name="a"><url>https://foo.com/a</url></file></metalink>`,
+		"no file":          `<metalink xmlns="urn:ietf:params:xml:ns:metalink"></metalink>`,
+		"parent directory": `<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="../a"><url>https://foo.com/a</url></file></metalink>`,
+		"absolute path":    `<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="/a"><url>https://foo.com/a</url></file></metalink>`,
+		"no HTTP URL":      `<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="a"><url>ftp://foo.com/a</url></file></metalink>`,
+		"invalid piece": `<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="a"><url>https://foo.com/a</url>
+<pieces length="1" type="sha-1"><hash>invalid</hash></pieces></file></metalink>`,
+	}
+	for name, doc := range invalidDocs {
+		t.Run(name, func(t *testing.T) {
+			metalink, err := ParseMetalink(strings.NewReader(doc))
+			assert.NotNil(t, err)
+			assert.Nil(t, metalink)
+		})
+	}
+}
+
+func TestIsMetalink(t *testing.T) {
+	assert.True(t, IsMetalink("application/metalink4+xml", ""))
+	assert.True(t, IsMetalink("application/metalink4+xml; charset=utf-8", "https://foo.com/download"))
+	assert.True(t, IsMetalink("", "https://foo.com/a.meta4?foo=bar"))
+	assert.True(t, IsMetalink("application/octet-stream", "a.metalink"))
+	assert.False(t, IsMetalink("application/octet-stream", "https://foo.com/a.tar.gz"))
+	assert.False(t, IsMetalink("", ""))
+}
+
+func TestDownloadWithPieceChecksums(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	pieces := &PieceChecksums{Length: 30}
+	for i := 0; i < len(content); i += 30 {
+		end := i + 30
+		if end > len(content) {
+			end = len(content)
+		}
+		sum := sha256.Sum256([]byte(content[i:end]))
+		pieces.Checksums = append(pieces.Checksums, &Checksum{Algorithm: "sha256", Value: hex.EncodeToString(sum[:])})
+	}
+
+	newServer := func(corruptTimes int32) (*httptest.Server, *int32) {
+		var requests int32
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data := content
+			if r.Header.Get("Range") != "bytes=2-" && atomic.AddInt32(&requests, 1) <= corruptTimes {
+				// the second piece is broken
+				data = content[:40] + "x" + content[41:]
+			}
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(data))
+		})), &requests
+	}
+
+	server, requests := newServer(1)
+	defer server.Close()
+	targetFile := path.Join(t.TempDir(), "target")
+	downloader := &MultiThreadDownloader{}
+	downloader.WithShowProgress(false).WithRetryPolicy(newFastRetryPolicy(2)).WithPieceChecksums(pieces)
+	assert.Nil(t, downloader.Download(server.URL, targetFile, 1))
+	data, err := os.ReadFile(targetFile)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+
+	// it keeps the state to resume if the pieces are still broken
+	brokenServer, _ := newServer(100)
+	defer brokenServer.Close()
+	targetFile = path.Join(t.TempDir(), "target")
+	err = downloader.Download(brokenServer.URL, targetFile, 1)
+	assert.NotNil(t, err)
+	assert.Contains(t, fmt.Sprint(err), "pieces are broken")
+	assert.NoFileExists(t, targetFile)
+	state := loadDownloadState(getStateFilePath(targetFile))
+	if assert.NotNil(t, state) {
+		assert.False(t, state.finished())
+	}
+}
@@ -0,0 +1,110 @@
+package net
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// maxMirrorFailures is the max number of continuous failures before dropping a mirror
+const maxMirrorFailures = 3
+
+var (
+	// errNoMirror indicates all the mirrors were dropped
+	errNoMirror = errors.New("no available mirror")
+	// errMirrorDropped indicates the mirror was dropped after a failure
+	errMirrorDropped = errors.New("mirror dropped")
+)
+
+// mirror is one of the URLs which serve the same file
+type mirror struct {
+	url      string
+	bytes    int64
+	elapsed  time.Duration
+	active   int
+	failures int
+	dropped  bool
+}
+
+// throughput returns the measured bytes per second, returns -1 if it's not measured yet
+func (m *mirror) throughput() float64 {
+	if m.elapsed <= 0 {
+		return -1
+	}
+	return float64(m.bytes) / m.elapsed.Seconds()
+}
+
+// mirrorSet picks the mirror for each chunk according to the measured throughput
+type mirrorSet struct {
+	mirrors []*mirror
+	lock    sync.Mutex
+}
+
+func newMirrorSet(urls ...string) *mirrorSet {
+	set := &mirrorSet{}
+	for _, item := range urls {
+		set.mirrors = append(set.mirrors, &mirror{url: item})
+	}
+	return set
+}
+
+// pick returns the mirror which is expected to be the fastest one with the current load.
+// The mirrors without measurement go first, so that all of them get a chance to be measured.
+func (s *mirrorSet) pick() (selected *mirror) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var selectedScore float64
+	for _, item := range s.mirrors {
+		if item.dropped {
+			continue
+		}
+
+		var score float64
+		if throughput := item.throughput(); throughput < 0 {
+			// not measured yet, prefer the idle one
+			score = float64(int64(1)<<62) / float64(item.active+1)
+		} else {
+			score = throughput / float64(item.active+1)
+		}
+
+		if selected == nil || score > selectedScore {
+			selected, selectedScore = item, score
+		}
+	}
+
+	if selected != nil {
+		selected.active++
+	}
+	return
+}
+
+// release records the result of a request to the mirror, returns true if the mirror was dropped.
+// A mirror will be dropped if it keeps failing, or the error is not retryable, but the last one is always kept.
+func (s *mirrorSet) release(m *mirror, bytes int64, elapsed time.Duration, err error, retryable bool) (dropped bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	m.active--
+	m.bytes += bytes
+	m.elapsed += elapsed
+	if err == nil {
+		m.failures = 0
+		return
+	}
+
+	m.failures++
+	if (m.failures >= maxMirrorFailures || !retryable) && s.alive() > 1 {
+		m.dropped, dropped = true, true
+	}
+	return
+}
+
+func (s *mirrorSet) alive() (count int) {
+	for _, item := range s.mirrors {
+		if !item.dropped {
+			count++
+		}
+	}
+	return
+}
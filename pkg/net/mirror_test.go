@@ -0,0 +1,200 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorSet(t *testing.T) {
+	set := newMirrorSet("a", "b")
+
+	// the mirrors without measurement go first
+	a := set.pick()
+	b := set.pick()
+	assert.Equal(t, "a", a.url)
+	assert.Equal(t, "b", b.url)
+
+	// b is faster than a
+	assert.False(t, set.release(a, 100, time.Second, nil, true))
+	assert.False(t, set.release(b, 250, time.Second, nil, true))
+	assert.Equal(t, "b", set.pick().url)
+	// b has the load now, but it's still faster
+	assert.Equal(t, "b", set.pick().url)
+	// a is faster than b with two active requests
+	assert.Equal(t, "a", set.pick().url)
+
+	// drop the mirror if the error is not retryable
+	assert.True(t, set.release(a, 0, time.Second, errors.New("fake"), false))
+	assert.Equal(t, "b", set.pick().url)
+
+	// the last one is always kept
+	for i := 0; i < maxMirrorFailures; i++ {
+		assert.False(t, set.release(b, 0, time.Second, errors.New("fake"), true))
+	}
+	assert.Equal(t, "b", set.pick().url)
+
+	// drop the mirror which keeps failing
+	set = newMirrorSet("a", "b")
+	for i := 0; i < maxMirrorFailures; i++ {
+		assert.Equal(t, i == maxMirrorFailures-1, set.release(set.mirrors[0], 0, time.Second, errors.New("fake"), true))
+	}
+	assert.Equal(t, 1, set.alive())
+
+	assert.Nil(t, newMirrorSet().pick())
+}
+
+func TestDownloadWithMirrors(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	newServer := func(requests *int32, handler http.HandlerFunc) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") != "bytes=2-" {
+				atomic.AddInt32(requests, 1)
+			}
+			handler(w, r)
+		}))
+	}
+	serveContent := func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}
+
+	var primaryRequests, mirrorRequests, brokenRequests, differentRequests, ignoringRequests int32
+	primary := newServer(&primaryRequests, serveContent)
+	defer primary.Close()
+	mirror := newServer(&mirrorRequests, serveContent)
+	defer mirror.Close()
+	broken := newServer(&brokenRequests, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=2-" {
+			serveContent(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer broken.Close()
+	different := newServer(&differentRequests, func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content[1:]))
+	})
+	defer different.Close()
+	// it passes the probe, but returns the whole file for the chunks
+	ignoring := newServer(&ignoringRequests, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=2-" {
+			serveContent(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	})
+	defer ignoring.Close()
+
+	downloader := &MultiThreadDownloader{}
+	downloader.WithShowProgress(false).
+		WithRetryPolicy(newFastRetryPolicy(2)).
+		WithMirrors(mirror.URL, broken.URL, different.URL, ignoring.URL, "http://localhost:0")
+
+	// a single worker picks the mirrors one by one, so the requests of each mirror are deterministic
+	ctx := context.Background()
+	total := int64(len(content))
+	f, err := os.Create(path.Join(t.TempDir(), "target"))
+	assert.Nil(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+	state := newDownloadState(primary.URL, "", resourceInfo{total: total}, 6)
+	err = downloader.downloadChunks(ctx, downloader.newMirrorSet(ctx, primary.URL, total), f, state, 1)
+	assert.Nil(t, err)
+
+	data, err := os.ReadFile(f.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+
+	assert.Greater(t, atomic.LoadInt32(&primaryRequests), int32(0))
+	assert.Greater(t, atomic.LoadInt32(&mirrorRequests), int32(0))
+	// dropped after the first failure
+	assert.Equal(t, int32(1), atomic.LoadInt32(&brokenRequests))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&ignoringRequests))
+	// dropped by the probe
+	assert.Equal(t, int32(0), atomic.LoadInt32(&differentRequests))
+
+	// the multi-thread download gets the same content
+	targetFile := path.Join(t.TempDir(), "target")
+	assert.Nil(t, downloader.Download(primary.URL, targetFile, 4))
+	data, err = os.ReadFile(targetFile)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestDownloadWithMirrorsCredentials(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	newServer := func(authorized *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "" {
+				atomic.AddInt32(authorized, 1)
+			}
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+		}))
+	}
+
+	var primaryAuthorized, mirrorAuthorized int32
+	primary := newServer(&primaryAuthorized)
+	defer primary.Close()
+	// the mirror is another host, it has a different port
+	mirror := newServer(&mirrorAuthorized)
+	defer mirror.Close()
+
+	targetFile := path.Join(t.TempDir(), "target")
+	downloader := &MultiThreadDownloader{}
+	downloader.WithShowProgress(false).
+		WithBasicAuth("user", "pass").
+		WithMirrors(mirror.URL)
+	err := downloader.Download(primary.URL, targetFile, 4)
+	assert.Nil(t, err)
+
+	data, err := os.ReadFile(targetFile)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+	assert.Greater(t, atomic.LoadInt32(&primaryAuthorized), int32(0))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&mirrorAuthorized))
+}
+
+func TestDownloadWithMirrorsProgress(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	newServer := func() *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+		}))
+	}
+	primary := newServer()
+	defer primary.Close()
+	mirror := newServer()
+	defer mirror.Close()
+
+	var lock sync.Mutex
+	var events []ProgressEvent
+	downloader := &MultiThreadDownloader{}
+	downloader.WithObserver(ProgressObserverFunc(func(event ProgressEvent) {
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, event)
+	})).WithMirrors(mirror.URL)
+	err := downloader.Download(primary.URL, path.Join(t.TempDir(), "target"), 4)
+	assert.Nil(t, err)
+
+	// the chunks of the mirror belong to the file
+	var mirrorChunks int
+	for _, event := range events {
+		assert.Equal(t, primary.URL, event.URL)
+		if event.Chunk > 0 && event.Mirror == mirror.URL {
+			mirrorChunks++
+		}
+	}
+	assert.Greater(t, mirrorChunks, 0)
+}
@@ -2,25 +2,24 @@ package net
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"os/signal"
+	"path/filepath"
 	"sync"
 	"time"
 )
 
 // MultiThreadDownloader is a download with multi-thread
 type MultiThreadDownloader struct {
-	noProxy                 bool
-	keepParts, showProgress bool
-	insecureSkipVerify      bool
-
-	username, password string
-	roundTripper       http.RoundTripper
-	suggestedFilename  string
-	timeout            time.Duration
+	options           Options
+	suggestedFilename string
+	contentType       string
+	// progress reports the progress of the whole file which is being downloaded
+	progress *progressReporter
 }
 
 // GetSuggestedFilename returns the suggested filename
@@ -28,285 +27,676 @@ func (d *MultiThreadDownloader) GetSuggestedFilename() string {
 	return d.suggestedFilename
 }
 
+// GetContentType returns the content type of the target resource
+func (d *MultiThreadDownloader) GetContentType() string {
+	return d.contentType
+}
+
+// WithOptions sets all the options, the thread of the options is not used by Download
+func (d *MultiThreadDownloader) WithOptions(options Options) *MultiThreadDownloader {
+	d.options = options
+	return d
+}
+
 // WithInsecureSkipVerify set if skip the insecure verify
 func (d *MultiThreadDownloader) WithInsecureSkipVerify(insecureSkipVerify bool) *MultiThreadDownloader {
-	d.insecureSkipVerify = insecureSkipVerify
+	d.options.InsecureSkipVerify = insecureSkipVerify
+	return d
+}
+
+// WithTLSConfig sets the TLS config which has the custom CA certificates and the client certificate
+func (d *MultiThreadDownloader) WithTLSConfig(config *tls.Config) *MultiThreadDownloader {
+	d.options.TLSConfig = config
 	return d
 }
 
 // WithTimeout sets the timeout
 func (d *MultiThreadDownloader) WithTimeout(timeout time.Duration) *MultiThreadDownloader {
-	d.timeout = timeout
+	d.options.Timeout = timeout
+	return d
+}
+
+// WithMaxAttempts sets the max times to retry a chunk, zero means there's no retry
+func (d *MultiThreadDownloader) WithMaxAttempts(maxAttempts int) *MultiThreadDownloader {
+	policy := *d.getRetryPolicy()
+	policy.MaxAttempts = maxAttempts
+	d.options.RetryPolicy = &policy
+	return d
+}
+
+// WithRetryPolicy sets the retry policy
+func (d *MultiThreadDownloader) WithRetryPolicy(policy *RetryPolicy) *MultiThreadDownloader {
+	d.options.RetryPolicy = policy
+	return d
+}
+
+// WithRateLimiter sets the rate limiter which is shared by all the threads
+func (d *MultiThreadDownloader) WithRateLimiter(limiter *RateLimiter) *MultiThreadDownloader {
+	d.options.RateLimiter = limiter
+	return d
+}
+
+// WithMirrors sets the mirrors which serve the same file, the chunks will be downloaded from
+// all of them according to the throughput
+func (d *MultiThreadDownloader) WithMirrors(mirrors ...string) *MultiThreadDownloader {
+	d.options.Mirrors = mirrors
+	return d
+}
+
+// WithCache sets the cache, the cached file is used if it matches the remote one
+func (d *MultiThreadDownloader) WithCache(cache *Cache) *MultiThreadDownloader {
+	d.options.Cache = cache
+	return d
+}
+
+// WithHeader sets the custom HTTP headers
+func (d *MultiThreadDownloader) WithHeader(header map[string]string) *MultiThreadDownloader {
+	d.options.Header = header
+	return d
+}
+
+// WithCookieJar sets the cookie jar which is shared by all the threads
+func (d *MultiThreadDownloader) WithCookieJar(jar http.CookieJar) *MultiThreadDownloader {
+	d.options.CookieJar = jar
+	return d
+}
+
+// WithCredentials sets the credentials of the hosts, each mirror takes its own credential
+func (d *MultiThreadDownloader) WithCredentials(credentials CredentialResolver) *MultiThreadDownloader {
+	d.options.Credentials = credentials
 	return d
 }
 
+// WithPieceChecksums sets the checksums of the pieces, the broken pieces will be downloaded again
+func (d *MultiThreadDownloader) WithPieceChecksums(pieces *PieceChecksums) *MultiThreadDownloader {
+	d.options.PieceChecksums = pieces
+	return d
+}
+
+func (d *MultiThreadDownloader) getRetryPolicy() *RetryPolicy {
+	if d.options.RetryPolicy == nil {
+		return DefaultRetryPolicy()
+	}
+	return d.options.RetryPolicy
+}
+
 // WithoutProxy indicates not use HTTP proxy
 func (d *MultiThreadDownloader) WithoutProxy(noProxy bool) *MultiThreadDownloader {
-	d.noProxy = noProxy
+	d.options.NoProxy = noProxy
+	return d
+}
+
+// WithProxy sets the proxy, and the comma-separated hosts which bypass the proxy
+func (d *MultiThreadDownloader) WithProxy(proxy, noProxyHosts string) *MultiThreadDownloader {
+	d.options.Proxy = proxy
+	d.options.NoProxyHosts = noProxyHosts
+	return d
+}
+
+// WithObserver sets the observer of the progress events
+func (d *MultiThreadDownloader) WithObserver(observer ProgressObserver) *MultiThreadDownloader {
+	d.options.Observer = observer
+	return d
+}
+
+// getObserver returns the observer, or the default one if it's going to show the progress
+func (d *MultiThreadDownloader) getObserver() ProgressObserver {
+	return d.options.getObserver()
+}
+
+// notify emits the message of the target URL, see notify
+func (d *MultiThreadDownloader) notify(targetURL, format string, a ...interface{}) {
+	notify(d.getObserver(), targetURL, fmt.Sprintf(format, a...))
+}
+
+// chunkObserver returns the observer of the chunks, it's the same one of the whole file. The events of
+// the chunks carry the URL of the file, and the mirror which the chunk is downloaded from
+func (d *MultiThreadDownloader) chunkObserver(mirror string) ProgressObserver {
+	if d.progress == nil {
+		return nil
+	}
+	observer, targetURL := d.progress.observer, d.progress.url
+	if mirror == targetURL {
+		return observer
+	}
+	return ProgressObserverFunc(func(event ProgressEvent) {
+		if event.URL == mirror {
+			event.URL, event.Mirror = targetURL, mirror
+		}
+		observer.OnProgress(event)
+	})
+}
+
+// scopeCredentials limits the username and password to the host of the target URL, so they're not sent
+// to the mirrors. It returns the function which restores the options.
+func (d *MultiThreadDownloader) scopeCredentials(targetURL string) (restore func()) {
+	options := d.options
+	d.options.Credentials = WithHostCredential(options.Credentials, targetURL, options.Username, options.Password)
+	d.options.Username, d.options.Password = "", ""
+	return func() {
+		d.options = options
+	}
+}
+
+// WithStreamBufferSize sets the max size of the memory which holds the chunks of a stream,
+// the chunks are written into the stream in order
+func (d *MultiThreadDownloader) WithStreamBufferSize(size int64) *MultiThreadDownloader {
+	d.options.StreamBufferSize = size
 	return d
 }
 
 // WithShowProgress indicate if show the download progress
 func (d *MultiThreadDownloader) WithShowProgress(showProgress bool) *MultiThreadDownloader {
-	d.showProgress = showProgress
+	d.options.ShowProgress = showProgress
 	return d
 }
 
 // WithKeepParts indicates if keeping the part files
 func (d *MultiThreadDownloader) WithKeepParts(keepParts bool) *MultiThreadDownloader {
-	d.keepParts = keepParts
+	d.options.KeepParts = keepParts
 	return d
 }
 
 // WithRoundTripper sets RoundTripper
 func (d *MultiThreadDownloader) WithRoundTripper(roundTripper http.RoundTripper) *MultiThreadDownloader {
-	d.roundTripper = roundTripper
+	d.options.RoundTripper = roundTripper
 	return d
 }
 
 // WithBasicAuth sets the basic auth
 func (d *MultiThreadDownloader) WithBasicAuth(username, password string) *MultiThreadDownloader {
-	d.username = username
-	d.password = password
+	d.options.Username = username
+	d.options.Password = password
 	return d
 }
 
 // WithBearerToken sets the bearer token
 func (d *MultiThreadDownloader) WithBearerToken(bearerToken string) *MultiThreadDownloader {
-	d.password = bearerToken
+	d.options.Password = bearerToken
 	return d
 }
 
-// DownloadWithContext starts to download the target URL with context
+// DownloadWithContext starts to download the target URL with context, it returns ErrCanceled once the context is done.
+// The data is written into the writer directly if it implements io.WriterAt and it's not a pipe, otherwise, the chunks are
+// kept in a bounded memory buffer until they could be written into the writer in order. So it's able to
+// write into a stream, for instance: the stdout.
 func (d *MultiThreadDownloader) DownloadWithContext(ctx context.Context, targetURL string, outputWriter io.Writer, thread int) (err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	defer d.scopeCredentials(targetURL)()
 	// get the total size of the target file
-	var total int64
-	var rangeSupport bool
-	if total, rangeSupport, err = DetectSizeWithRoundTripperAndAuthStream(targetURL, outputWriter, d.showProgress,
-		d.noProxy, d.insecureSkipVerify, d.roundTripper, d.username, d.password, d.timeout); rangeSupport && err != nil {
+	var info resourceInfo
+	if info, err = d.detect(ctx, targetURL, d.options.RetryPolicy); info.rangeSupport && err != nil {
+		return
+	} else if ctx.Err() != nil {
+		err = checkCanceled(ctx, err)
 		return
 	}
+	total, rangeSupport := info.total, info.rangeSupport
+	d.suggestedFilename, d.contentType = info.filename, info.contentType
 
 	if rangeSupport {
-		unit := total / int64(thread)
-		offset := total - unit*int64(thread)
-		var wg sync.WaitGroup
-		var m sync.Mutex
-		partItems := make(map[int]string)
+		writerAt, ok := asWriterAt(outputWriter)
+		if !ok {
+			writerAt = newOrderedWriter(outputWriter, d.options.StreamBufferSize)
+		}
 
+		d.progress = newProgressReporter(d.getObserver(), targetURL, "Downloading", 0)
 		defer func() {
-			// remove all partial files
-			for _, part := range partItems {
-				_ = os.RemoveAll(part)
-			}
+			d.progress.finish(err)
+			d.progress = nil
 		}()
 
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		ctx, cancel := context.WithCancel(context.Background())
-		var canceled bool
+		state := newDownloadState(targetURL, "", resourceInfo{total: total}, thread)
+		d.progress.start(total, 0, len(state.Chunks))
+		if err = d.downloadChunks(ctx, d.newMirrorSet(ctx, targetURL, total), writerAt, state, thread); err == nil && !ok {
+			if written := writerAt.(*orderedWriter).written(); written != total {
+				err = fmt.Errorf("only %d of %d bytes were written", written, total)
+			}
+		}
+	} else {
+		d.notify(targetURL, "cannot download it using multiple threads, failed to one")
+		downloader := (&ContinueDownloader{}).WithOptions(d.options).WithContext(ctx)
+		err = downloader.DownloadWithContinueAsStream(targetURL, outputWriter, -1, 0, 0, d.options.ShowProgress)
+		d.suggestedFilename = downloader.GetSuggestedFilename()
+		d.contentType = downloader.GetContentType()
+	}
+	return
+}
 
-		go func() {
-			<-c
-			canceled = true
-			cancel()
-		}()
+// Download starts to download the target URL, see DownloadFileWithContext
+func (d *MultiThreadDownloader) Download(targetURL, targetFilePath string, thread int) (err error) {
+	return d.DownloadFileWithContext(context.Background(), targetURL, targetFilePath, thread)
+}
 
-		fmt.Printf("start to download with %d threads, size: %d, unit: %d", thread, total, unit)
-		for i := 0; i < thread; i++ {
-			fmt.Println() // TODO take position, should take over by progerss bars
-			wg.Add(1)
-			go func(index int, wg *sync.WaitGroup, ctx context.Context) {
-				defer wg.Done()
-				outputFile, err := os.CreateTemp(os.TempDir(), fmt.Sprintf("part-%d", index))
-				if err != nil {
-					fmt.Println("failed to create template file", err)
-				}
-				outputFile.Close()
+// DownloadFileWithContext starts to download the target URL into the target file.
+// The data is written into a preallocated file which has the suffix DownloadingFileSuffix, and the progress
+// is recorded into a state file. It's able to resume the download by running it again. It starts from
+// scratch if the remote resource was changed. The file will be renamed to the target file once it's finished,
+// so there's no broken target file if any chunk failed after all the attempts. It returns ErrCanceled once
+// the context is done, and the progress is kept for resuming.
+func (d *MultiThreadDownloader) DownloadFileWithContext(ctx context.Context, targetURL, targetFilePath string, thread int) (err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	defer d.scopeCredentials(targetURL)()
+	// get the total size of the target file
+	var info resourceInfo
+	if info, err = d.detect(ctx, targetURL, d.options.RetryPolicy); info.rangeSupport && err != nil {
+		return
+	} else if ctx.Err() != nil {
+		err = checkCanceled(ctx, err)
+		return
+	}
+	d.contentType = info.contentType
+	if d.suggestedFilename = info.filename; d.suggestedFilename == filepath.Base(targetFilePath) {
+		d.suggestedFilename = ""
+	}
 
-				m.Lock()
-				partItems[index] = outputFile.Name()
-				m.Unlock()
+	if entry := d.options.Cache.Get(targetURL); err == nil && entry != nil && entry.Matches(info.etag, info.lastModified, info.total) {
+		d.notify(targetURL, "use the cached file of %s", targetURL)
+		err = d.copyFromCache(entry, targetFilePath)
+		return
+	}
 
-				end := unit*int64(index+1) - 1
-				if index == thread-1 {
-					// this is the last part
-					end += offset
-				}
-				start := unit * int64(index)
-
-				downloader := &ContinueDownloader{}
-				downloader.WithoutProxy(d.noProxy).
-					WithRoundTripper(d.roundTripper).
-					WithInsecureSkipVerify(d.insecureSkipVerify).
-					WithBasicAuth(d.username, d.password).
-					WithContext(ctx).WithTimeout(d.timeout)
-				if downloadErr := downloader.DownloadWithContinue(targetURL, outputFile.Name(),
-					int64(index), start, end, d.showProgress); downloadErr != nil {
-					fmt.Println(downloadErr)
-				}
-			}(i, &wg, ctx)
+	if info.rangeSupport {
+		downloadingPath := targetFilePath + DownloadingFileSuffix
+		d.progress = newProgressReporter(d.getObserver(), targetURL, "Downloading", 0)
+		defer func() {
+			d.progress.finish(err)
+			d.progress = nil
+		}()
+
+		state := d.loadOrCreateState(targetURL, targetFilePath, info, thread)
+		d.progress.start(info.total, state.completed(), len(state.Chunks))
+
+		var f *os.File
+		if f, err = openDownloadingFile(downloadingPath, state); err != nil {
+			return
 		}
+		defer func() {
+			_ = f.Close()
+		}()
 
-		wg.Wait()
-		// ProgressIndicator{}.Close()
-		if canceled {
-			err = fmt.Errorf("download process canceled")
+		if err = d.downloadAndVerifyPieces(ctx, d.newMirrorSet(ctx, targetURL, info.total), f, state, thread); err != nil {
 			return
 		}
 
-		// make the cursor right
-		// TODO the progress component should take over it
-		if thread > 1 {
-			// line := GetCurrentLine()
-			time.Sleep(time.Second)
-			fmt.Printf("\033[%dE\n", thread) // move to the target line
-			time.Sleep(time.Second * 5)
+		if err = f.Close(); err == nil {
+			if err = os.Rename(downloadingPath, targetFilePath); err == nil {
+				state.remove()
+			}
 		}
 
-		for i := 0; i < thread; i++ {
-			partFile := partItems[i]
-			if data, ferr := os.ReadFile(partFile); ferr == nil {
-				if _, err = outputWriter.Write(data); err != nil {
-					err = fmt.Errorf("failed to write file: '%s'", partFile)
-					break
-				} else if !d.keepParts {
-					_ = os.RemoveAll(partFile)
-				}
-			} else {
-				err = fmt.Errorf("failed to read file: '%s'", partFile)
-				break
+		if err == nil && d.options.Cache != nil && (info.etag != "" || info.lastModified != "") {
+			if _, cacheErr := d.options.Cache.Put(targetURL, info.etag, info.lastModified, targetFilePath); cacheErr != nil {
+				d.notify(targetURL, "failed to cache the file: %v", cacheErr)
 			}
 		}
+
+		if err == nil && d.options.KeepParts {
+			err = writePartFiles(targetFilePath, state)
+		}
 	} else {
-		fmt.Println("cannot download it using multiple threads, failed to one")
-		downloader := &ContinueDownloader{}
-		downloader.WithoutProxy(d.noProxy)
-		downloader.WithRoundTripper(d.roundTripper)
-		downloader.WithInsecureSkipVerify(d.insecureSkipVerify)
-		downloader.WithTimeout(d.timeout)
-		downloader.WithBasicAuth(d.username, d.password)
-		err = downloader.DownloadWithContinueAsStream(targetURL, outputWriter, -1, 0, 0, true)
+		d.notify(targetURL, "cannot download it using multiple threads, failed to one")
+		downloader := (&ContinueDownloader{}).WithOptions(d.options).WithContext(ctx)
+		if err = downloader.DownloadWithContinue(targetURL, targetFilePath, -1, 0, 0, d.options.ShowProgress); err == nil && d.options.PieceChecksums != nil {
+			err = d.verifyPiecesOfFile(targetFilePath)
+		}
 		d.suggestedFilename = downloader.GetSuggestedFilename()
+		d.contentType = downloader.GetContentType()
 	}
 	return
 }
 
-// Download starts to download the target URL
-func (d *MultiThreadDownloader) Download(targetURL, targetFilePath string, thread int) (err error) {
-	// get the total size of the target file
-	var total int64
-	var rangeSupport bool
-	if total, rangeSupport, err = DetectSizeWithRoundTripperAndAuth(targetURL, targetFilePath, d.showProgress,
-		d.noProxy, d.insecureSkipVerify, d.roundTripper, d.username, d.password, d.timeout); rangeSupport && err != nil {
-		return
+// downloadAndVerifyPieces downloads all the chunks, then verifies the pieces if there are the checksums.
+// The broken pieces are downloaded again until running out of the attempts.
+func (d *MultiThreadDownloader) downloadAndVerifyPieces(ctx context.Context, mirrors *mirrorSet, f *os.File,
+	state *downloadState, thread int) (err error) {
+	for attempt := 0; ; attempt++ {
+		if err = d.downloadChunks(ctx, mirrors, f, state, thread); err != nil || d.options.PieceChecksums == nil {
+			return
+		}
+
+		var broken []int
+		if broken, err = d.options.PieceChecksums.verify(f, state.Total); err != nil || len(broken) == 0 {
+			return
+		}
+
+		for _, index := range broken {
+			start := int64(index) * d.options.PieceChecksums.Length
+			state.rewind(start, start+d.options.PieceChecksums.Length-1)
+		}
+		if attempt >= d.getRetryPolicy().MaxAttempts {
+			_ = state.save()
+			err = fmt.Errorf("%d pieces are broken after %d attempts: %v", len(broken), attempt+1, broken)
+			return
+		}
+		d.notify(state.URL, "%d pieces are broken, download them again: %v", len(broken), broken)
 	}
+}
 
-	if rangeSupport {
-		unit := total / int64(thread)
-		offset := total - unit*int64(thread)
-		var wg sync.WaitGroup
-		var partItems []string
-		var m sync.Mutex
+// verifyPiecesOfFile verifies the pieces of a downloaded file
+func (d *MultiThreadDownloader) verifyPiecesOfFile(filePath string) (err error) {
+	var f *os.File
+	if f, err = os.Open(filePath); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var stat os.FileInfo
+	var broken []int
+	if stat, err = f.Stat(); err == nil {
+		if broken, err = d.options.PieceChecksums.verify(f, stat.Size()); err == nil && len(broken) > 0 {
+			err = fmt.Errorf("%d pieces of '%s' are broken: %v", len(broken), filePath, broken)
+		}
+	}
+	return
+}
 
-		defer func() {
-			// remove all partial files
-			for _, part := range partItems {
-				_ = os.RemoveAll(part)
-			}
-		}()
+// downloadChunks downloads all the unfinished chunks by a pool of workers, each chunk is written
+// into its own range of the writer. All the workers stop once the parent context is done.
+func (d *MultiThreadDownloader) downloadChunks(parent context.Context, mirrors *mirrorSet, writer io.WriterAt,
+	state *downloadState, thread int) (err error) {
+	var wg sync.WaitGroup
 
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		ctx, cancel := context.WithCancel(context.Background())
-		var canceled bool
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
 
+	// a stream could not be resumed, so it stops all the chunks once any of them failed.
+	// The chunks which are waiting for the buffer are woken up as well.
+	stream, isStream := writer.(*orderedWriter)
+	if isStream {
 		go func() {
-			<-c
-			canceled = true
-			cancel()
+			<-ctx.Done()
+			stream.abort()
 		}()
+	}
 
-		fmt.Printf("start to download with %d threads, size: %d, unit: %d", thread, total, unit)
-		for i := 0; i < thread; i++ {
-			fmt.Println() // TODO take position, should take over by progerss bars
-			wg.Add(1)
-			go func(index int, wg *sync.WaitGroup, ctx context.Context) {
-				defer wg.Done()
-				output := fmt.Sprintf("%s-%d", targetFilePath, index)
-
-				m.Lock()
-				partItems = append(partItems, output)
-				m.Unlock()
-
-				end := unit*int64(index+1) - 1
-				if index == thread-1 {
-					// this is the last part
-					end += offset
-				}
-				start := unit * int64(index)
-
-				downloader := &ContinueDownloader{}
-				downloader.WithoutProxy(d.noProxy).
-					WithRoundTripper(d.roundTripper).
-					WithInsecureSkipVerify(d.insecureSkipVerify).
-					WithBasicAuth(d.username, d.password).
-					WithContext(ctx).WithTimeout(d.timeout)
-				if downloadErr := downloader.DownloadWithContinue(targetURL, output,
-					int64(index), start, end, d.showProgress); downloadErr != nil {
-					fmt.Println(downloadErr)
+	if state.path != "" {
+		stopSaving := state.autoSave(time.Second)
+		defer stopSaving()
+	}
+
+	if thread < 1 {
+		thread = 1
+	}
+	scheduler := newChunkScheduler(state)
+	chunkErrs := &MultiError{}
+	for i := 0; i < thread; i++ {
+		wg.Add(1)
+		go func(wg *sync.WaitGroup, ctx context.Context) {
+			defer wg.Done()
+
+			for chunk := scheduler.next(); chunk != nil && ctx.Err() == nil; chunk = scheduler.next() {
+				if chunkErr := d.downloadChunk(ctx, mirrors, writer, state, chunk); chunkErr != nil && ctx.Err() == nil {
+					chunkErrs.Add(chunkErr)
+					if isStream {
+						cancel()
+					}
+				} else if chunkErr == nil {
+					d.progress.chunkDone(state.indexOf(chunk) + 1)
 				}
-			}(i, &wg, ctx)
+				scheduler.done(chunk)
+			}
+		}(&wg, ctx)
+	}
+
+	wg.Wait()
+	if parent.Err() != nil {
+		err = checkCanceled(parent, parent.Err())
+		if state.path != "" {
+			err = fmt.Errorf("%w, run it again to resume the download", err)
 		}
+		return
+	}
 
-		wg.Wait()
-		// ProgressIndicator{}.Close()
-		if canceled {
-			err = fmt.Errorf("download process canceled")
-			return
+	if err = chunkErrs.ErrorOrNil(); err == nil && !state.finished() {
+		err = fmt.Errorf("failed to download all the parts, run it again to resume the download")
+	}
+	return
+}
+
+// downloadChunk downloads the rest of a chunk. It retries from the last written byte
+// until the chunk is finished or running out of the attempts.
+func (d *MultiThreadDownloader) downloadChunk(ctx context.Context, mirrors *mirrorSet, writer io.WriterAt,
+	state *downloadState, chunk *chunkState) (err error) {
+	policy := d.getRetryPolicy()
+	for attempt := 1; ; attempt++ {
+		// retry the rest of the chunk instead of the whole request
+		if err = d.downloadChunkOnce(ctx, mirrors, writer, state, chunk, policy); errors.Is(err, errMirrorDropped) {
+			// switch to another mirror immediately, it does not count as an attempt
+			attempt--
+			continue
+		} else if err == nil || attempt > policy.MaxAttempts || !policy.IsRetryableError(err) {
+			break
 		}
 
-		// make the cursor right
-		// TODO the progress component should take over it
-		if thread > 1 {
-			// line := GetCurrentLine()
-			time.Sleep(time.Second)
-			fmt.Printf("\033[%dE\n", thread) // move to the target line
-			time.Sleep(time.Second * 5)
+		wait := policy.Backoff(attempt)
+		retryAttempt := RetryAttempt{
+			Attempt: attempt,
+			Err:     err,
+			Wait:    wait,
+		}
+		if policy.OnRetry != nil {
+			policy.OnRetry(retryAttempt)
 		}
+		d.progress.retry(state.indexOf(chunk)+1, retryAttempt)
 
-		// concat all these partial files
-		var f *os.File
-		if f, err = os.Create(targetFilePath); err == nil {
-			defer func() {
-				_ = f.Close()
-			}()
-
-			for i := 0; i < thread; i++ {
-				partFile := fmt.Sprintf("%s-%d", targetFilePath, i)
-				if data, ferr := os.ReadFile(partFile); ferr == nil {
-					if _, err = f.Write(data); err != nil {
-						err = fmt.Errorf("failed to write file: '%s'", partFile)
-						break
-					} else if !d.keepParts {
-						_ = os.RemoveAll(partFile)
-					}
-				} else {
-					err = fmt.Errorf("failed to read file: '%s'", partFile)
-					break
-				}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	if err != nil {
+		state.lock.Lock()
+		err = fmt.Errorf("failed to download the range %d-%d: %w", chunk.Start+chunk.Completed, chunk.End, err)
+		state.lock.Unlock()
+	}
+	return
+}
+
+// downloadChunkOnce sends one request for the rest of a chunk to the best mirror
+func (d *MultiThreadDownloader) downloadChunkOnce(ctx context.Context, mirrors *mirrorSet, writer io.WriterAt,
+	state *downloadState, chunk *chunkState, retryPolicy *RetryPolicy) (err error) {
+	state.lock.Lock()
+	index := indexOfChunk(state.Chunks, chunk)
+	start, end := chunk.Start+chunk.Completed, chunk.End
+	finished := chunk.finished()
+	state.lock.Unlock()
+	if finished {
+		return
+	}
+
+	selected := mirrors.pick()
+	if selected == nil {
+		return errNoMirror
+	}
+	begin := time.Now()
+	defer func() {
+		state.lock.Lock()
+		downloaded := chunk.Completed - (start - chunk.Start)
+		state.lock.Unlock()
+		if ctx.Err() != nil {
+			mirrors.release(selected, 0, 0, nil, true)
+		} else if mirrors.release(selected, downloaded, time.Since(begin), err, retryPolicy.IsRetryableError(err)) {
+			d.notify(state.URL, "drop the mirror %s, error: %v", selected.url, err)
+			err = fmt.Errorf("%w: %s, error: %v", errMirrorDropped, selected.url, err)
+		}
+	}()
+
+	// a chunk is retried by downloadChunk, and it's never cached
+	options := d.options
+	options.RetryPolicy = retryPolicy.WithoutRetry()
+	options.Observer = d.chunkObserver(selected.url)
+	options.ShowProgress = false
+	options.Cache = nil
+	downloader := (&ContinueDownloader{}).WithOptions(options).WithContext(ctx)
+	if err = downloader.DownloadWithContinueAsStream(selected.url, &chunkWriter{
+		writer:   writer,
+		state:    state,
+		chunk:    chunk,
+		reporter: d.progress,
+	}, int64(index), start, end, false); errors.Is(err, errChunkFinished) {
+		err = nil
+	}
+
+	if err == nil {
+		state.lock.Lock()
+		if !chunk.finished() {
+			// the connection was closed before getting all the data
+			err = io.ErrUnexpectedEOF
+		}
+		state.lock.Unlock()
+	}
+	return
+}
+
+func indexOfChunk(chunks []*chunkState, chunk *chunkState) int {
+	for i := range chunks {
+		if chunks[i] == chunk {
+			return i
+		}
+	}
+	return -1
+}
+
+// detect finds out the size, range support and validators of the target resource, there's no progress of it
+func (d *MultiThreadDownloader) detect(ctx context.Context, targetURL string, retryPolicy *RetryPolicy) (info resourceInfo, err error) {
+	options := d.options
+	options.RetryPolicy = retryPolicy
+	options.RateLimiter, options.Cache, options.Observer, options.ShowProgress = nil, nil, nil, false
+	downloader := options.newHTTPDownloader(ctx, targetURL, "")
+
+	info, err = detectResource(targetURL, downloader, func() error {
+		// nothing will be written, it only takes the response header
+		return downloader.DownloadAsStream(io.Discard)
+	})
+	return
+}
+
+// newMirrorSet creates the mirror set with the target URL and the mirrors which serve the same file
+func (d *MultiThreadDownloader) newMirrorSet(ctx context.Context, targetURL string, total int64) *mirrorSet {
+	return newMirrorSet(append([]string{targetURL}, d.probeMirrors(ctx, targetURL, total)...)...)
+}
+
+// probeMirrors returns the mirrors which support the range request and have the same size
+func (d *MultiThreadDownloader) probeMirrors(ctx context.Context, targetURL string, total int64) (mirrors []string) {
+	available := make([]bool, len(d.options.Mirrors))
+	wg := sync.WaitGroup{}
+	for i := range d.options.Mirrors {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// drop the unavailable mirror quickly instead of retrying
+			info, err := d.detect(ctx, d.options.Mirrors[i], d.getRetryPolicy().WithoutRetry())
+			size, rangeSupport := info.total, info.rangeSupport
+			switch {
+			case err != nil:
+				d.notify(targetURL, "drop the mirror %s, error: %v", d.options.Mirrors[i], err)
+			case !rangeSupport:
+				d.notify(targetURL, "drop the mirror %s, it does not support the range request", d.options.Mirrors[i])
+			case size != total:
+				d.notify(targetURL, "drop the mirror %s, its size %d is different from %d", d.options.Mirrors[i], size, total)
+			default:
+				available[i] = true
 			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range d.options.Mirrors {
+		if available[i] {
+			mirrors = append(mirrors, d.options.Mirrors[i])
+		}
+	}
+	return
+}
+
+// copyFromCache writes the cached file into the target file
+func (d *MultiThreadDownloader) copyFromCache(entry *CacheEntry, targetFilePath string) (err error) {
+	var cached, target *os.File
+	if cached, err = d.options.Cache.Open(entry); err != nil {
+		return
+	}
+	defer func() {
+		_ = cached.Close()
+	}()
+
+	if target, err = os.Create(targetFilePath); err == nil {
+		_, err = io.Copy(target, cached)
+		if closeErr := target.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return
+}
+
+// loadOrCreateState resumes from the existing state if it belongs to the same remote resource,
+// otherwise it starts from scratch
+func (d *MultiThreadDownloader) loadOrCreateState(targetURL, targetFilePath string, info resourceInfo, thread int) (state *downloadState) {
+	statePath := getStateFilePath(targetFilePath)
+	if state = loadDownloadState(statePath); state != nil {
+		if state.matches(targetURL, info) {
+			d.notify(targetURL, "resume the download from %s", statePath)
+			return
+		}
+		d.notify(targetURL, "the remote file was changed, start to download it from scratch")
+	}
+	state = newDownloadState(targetURL, statePath, info, thread)
+	return
+}
+
+// openDownloadingFile opens the downloading file, and preallocates it with the total size.
+// All the progress of the state will be reset if the file does not match the state.
+func openDownloadingFile(downloadingPath string, state *downloadState) (f *os.File, err error) {
+	if f, err = os.OpenFile(downloadingPath, os.O_CREATE|os.O_RDWR, 0644); err != nil {
+		return
+	}
+
+	var stat os.FileInfo
+	if stat, err = f.Stat(); err == nil && stat.Size() != state.Total {
+		for _, chunk := range state.Chunks {
+			chunk.Completed = 0
+		}
+		if err = f.Truncate(0); err == nil {
+			err = f.Truncate(state.Total)
+		}
+	}
+
+	if err != nil {
+		_ = f.Close()
+		err = fmt.Errorf("failed to preallocate file '%s', error: %v", downloadingPath, err)
+	}
+	return
+}
+
+// writePartFiles writes each chunk of the target file into a part file
+func writePartFiles(targetFilePath string, state *downloadState) (err error) {
+	var f *os.File
+	if f, err = os.Open(targetFilePath); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	for i, chunk := range state.Chunks {
+		var part *os.File
+		if part, err = os.Create(fmt.Sprintf("%s-%d", targetFilePath, i)); err != nil {
+			break
+		}
+
+		_, err = io.Copy(part, io.NewSectionReader(f, chunk.Start, chunk.size()))
+		_ = part.Close()
+		if err != nil {
+			break
 		}
-	} else {
-		fmt.Println("cannot download it using multiple threads, failed to one")
-		downloader := &ContinueDownloader{}
-		downloader.WithoutProxy(d.noProxy)
-		downloader.WithRoundTripper(d.roundTripper)
-		downloader.WithInsecureSkipVerify(d.insecureSkipVerify)
-		downloader.WithTimeout(d.timeout)
-		downloader.WithBasicAuth(d.username, d.password)
-		err = downloader.DownloadWithContinue(targetURL, targetFilePath, -1, 0, 0, true)
-		d.suggestedFilename = downloader.GetSuggestedFilename()
 	}
 	return
 }
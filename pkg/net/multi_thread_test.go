@@ -0,0 +1,154 @@
+package net
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadChunkRetry(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	var failures int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Range") {
+		case "bytes=50-99":
+			if atomic.AddInt32(&failures, 1) <= 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "bytes=0-49":
+			// the connection was closed in the middle
+			w.Header().Set("Content-Range", "bytes 0-49/100")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write([]byte(content[:20]))
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	targetFile := path.Join(t.TempDir(), "target")
+	downloader := &MultiThreadDownloader{}
+	downloader.WithShowProgress(false).WithRetryPolicy(newFastRetryPolicy(3))
+	err := downloader.Download(server.URL, targetFile, 2)
+	assert.Nil(t, err)
+
+	data, err := os.ReadFile(targetFile)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestDownloadChunkFailed(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=50-99" {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	targetFile := path.Join(t.TempDir(), "target")
+	downloader := &MultiThreadDownloader{}
+	downloader.WithShowProgress(false).WithRetryPolicy(newFastRetryPolicy(2))
+	err := downloader.Download(server.URL, targetFile, 2)
+	if assert.NotNil(t, err) {
+		multiErr, ok := err.(*MultiError)
+		assert.True(t, ok)
+		assert.Equal(t, 1, len(multiErr.Errors))
+		assert.Contains(t, err.Error(), "50-99")
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// no broken target file, but keep the progress for resuming
+	assert.NoFileExists(t, targetFile)
+	assert.FileExists(t, targetFile+StateFileSuffix)
+	assert.FileExists(t, targetFile+DownloadingFileSuffix)
+}
+
+func TestDownloadChunkNotRetryable(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=50-99" {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(strings.Repeat("0123456789", 10)))
+	}))
+	defer server.Close()
+
+	downloader := &MultiThreadDownloader{}
+	downloader.WithShowProgress(false).WithMaxAttempts(5)
+	err := downloader.Download(server.URL, path.Join(t.TempDir(), "target"), 2)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestDownloadChunkOnRetry(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=50-99" && atomic.AddInt32(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(strings.Repeat("0123456789", 10)))
+	}))
+	defer server.Close()
+
+	var attempts []int
+	policy := newFastRetryPolicy(3)
+	policy.OnRetry = func(attempt RetryAttempt) {
+		assert.NotNil(t, attempt.Err)
+		attempts = append(attempts, attempt.Attempt)
+	}
+
+	downloader := &MultiThreadDownloader{}
+	downloader.WithShowProgress(false).WithRetryPolicy(policy)
+	err := downloader.Download(server.URL, path.Join(t.TempDir(), "target"), 2)
+	assert.Nil(t, err)
+	// the chunk is retried by the downloader rather than the HTTP client
+	assert.Equal(t, []int{1, 2}, attempts)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func newFastRetryPolicy(maxAttempts int) *RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = maxAttempts
+	policy.InitialInterval = time.Millisecond
+	return policy
+}
+
+func TestDownloadWithHeader(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	var missing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			atomic.AddInt32(&missing, 1)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	targetFile := path.Join(t.TempDir(), "target")
+	downloader := &MultiThreadDownloader{}
+	downloader.WithShowProgress(false).WithHeader(map[string]string{"X-Token": "secret"})
+	assert.Nil(t, downloader.Download(server.URL, targetFile, 2))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&missing))
+
+	data, err := os.ReadFile(targetFile)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+}
@@ -0,0 +1,542 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// MediaTypeOCIManifest is the media type of the OCI image manifest
+	MediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	// MediaTypeOCIIndex is the media type of the OCI image index which points to the manifests of the platforms
+	MediaTypeOCIIndex = "application/vnd.oci.image.index.v1+json"
+	// MediaTypeDockerManifest is the media type of the Docker image manifest
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	// MediaTypeDockerManifestList is the media type of the Docker manifest list
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	// AnnotationTitle is the annotation of the file name of a layer, it's set by ORAS
+	AnnotationTitle = "org.opencontainers.image.title"
+
+	// ociSchemePrefix is the prefix of the OCI references, for instance: oci://ghcr.io/org/repo:tag
+	ociSchemePrefix = "oci://"
+	// maxManifestSize is the max size of a manifest, the registries do not accept the larger ones either
+	maxManifestSize = 4 * 1024 * 1024
+)
+
+// OCIReference is the reference of an OCI artifact, it has a tag or a digest
+type OCIReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// OCIDescriptor describes a manifest or a layer
+type OCIDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *OCIPlatform      `json:"platform,omitempty"`
+}
+
+// OCIPlatform is the platform of a manifest in the index
+type OCIPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// OCIBlob is the resolved layer, it could be downloaded from the URL with the header
+type OCIBlob struct {
+	OCIDescriptor
+	URL    string
+	Header map[string]string
+}
+
+// ociManifest is the image manifest or the index
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Layers    []OCIDescriptor `json:"layers"`
+	Manifests []OCIDescriptor `json:"manifests"`
+}
+
+// IsOCIReference returns true if it's an oci:// reference
+func IsOCIReference(text string) bool {
+	return strings.HasPrefix(text, ociSchemePrefix)
+}
+
+// ParseOCIReference parses the reference like oci://registry/repository:tag or oci://registry/repository@digest,
+// the tag is latest if both of them are missing
+func ParseOCIReference(text string) (ref *OCIReference, err error) {
+	name := strings.TrimPrefix(text, ociSchemePrefix)
+	ref = &OCIReference{}
+	name, ref.Digest, _ = strings.Cut(name, "@")
+
+	slash := strings.Index(name, "/")
+	if slash <= 0 {
+		err = fmt.Errorf("invalid OCI reference '%s', it should be like oci://registry/repository:tag", text)
+		return
+	}
+	ref.Registry, ref.Repository = name[:slash], name[slash+1:]
+	if colon := strings.LastIndex(ref.Repository, ":"); colon > strings.LastIndex(ref.Repository, "/") {
+		ref.Repository, ref.Tag = ref.Repository[:colon], ref.Repository[colon+1:]
+	}
+
+	switch {
+	case ref.Repository == "":
+		err = fmt.Errorf("invalid OCI reference '%s', the repository is missing", text)
+	case ref.Digest != "":
+		if _, err = ParseChecksum(ref.Digest); err != nil {
+			err = fmt.Errorf("invalid digest of the OCI reference '%s', error: %v", text, err)
+		}
+	case ref.Tag == "":
+		ref.Tag = "latest"
+	}
+
+	// the short names of Docker Hub
+	if ref.Registry == "docker.io" {
+		ref.Registry = "registry-1.docker.io"
+		if !strings.Contains(ref.Repository, "/") {
+			ref.Repository = "library/" + ref.Repository
+		}
+	}
+	if err != nil {
+		ref = nil
+	}
+	return
+}
+
+// String returns the reference without the scheme
+func (r *OCIReference) String() string {
+	if r.Digest != "" {
+		return fmt.Sprintf("%s/%s@%s", r.Registry, r.Repository, r.Digest)
+	}
+	return fmt.Sprintf("%s/%s:%s", r.Registry, r.Repository, r.Tag)
+}
+
+// Filename returns the file name of the layer from the title annotation, it's empty if there's no title
+func (d *OCIDescriptor) Filename() string {
+	if title := d.Annotations[AnnotationTitle]; title != "" {
+		return path.Base(path.Clean("/" + title))
+	}
+	return ""
+}
+
+// OCIResolver resolves the layer of an OCI artifact from the registry. It gets the bearer token from the
+// authorization service if the registry asks for it, see https://distribution.github.io/distribution/spec/auth/token/
+type OCIResolver struct {
+	roundTripper       http.RoundTripper
+	noProxy            bool
+	proxy              string
+	noProxyHosts       string
+	insecureSkipVerify bool
+	tlsConfig          *tls.Config
+	timeout            time.Duration
+	username, password string
+	credentials        CredentialResolver
+	retryPolicy        *RetryPolicy
+	plainHTTP          bool
+	os, arch           string
+	mediaType          string
+	filename           string
+
+	client        *RetryClient
+	authorization string
+}
+
+// WithRoundTripper sets the RoundTripper
+func (r *OCIResolver) WithRoundTripper(roundTripper http.RoundTripper) *OCIResolver {
+	r.roundTripper = roundTripper
+	return r
+}
+
+// WithoutProxy indicates no HTTP proxy use
+func (r *OCIResolver) WithoutProxy(noProxy bool) *OCIResolver {
+	r.noProxy = noProxy
+	return r
+}
+
+// WithProxy sets the proxy and the hosts which bypass it
+func (r *OCIResolver) WithProxy(proxy, noProxyHosts string) *OCIResolver {
+	r.proxy = proxy
+	r.noProxyHosts = noProxyHosts
+	return r
+}
+
+// WithInsecureSkipVerify sets if skip the insecure verify
+func (r *OCIResolver) WithInsecureSkipVerify(insecureSkipVerify bool) *OCIResolver {
+	r.insecureSkipVerify = insecureSkipVerify
+	return r
+}
+
+// WithTLSConfig sets the TLS config which has the custom CA certificates and the client certificate
+func (r *OCIResolver) WithTLSConfig(config *tls.Config) *OCIResolver {
+	r.tlsConfig = config
+	return r
+}
+
+// WithTimeout sets the timeout of connecting the registry
+func (r *OCIResolver) WithTimeout(timeout time.Duration) *OCIResolver {
+	r.timeout = timeout
+	return r
+}
+
+// WithBasicAuth sets the username and password which are exchanged for the token
+func (r *OCIResolver) WithBasicAuth(username, password string) *OCIResolver {
+	r.username = username
+	r.password = password
+	return r
+}
+
+// WithCredentials sets the resolver of the credentials, they're used if there's no basic auth
+func (r *OCIResolver) WithCredentials(credentials CredentialResolver) *OCIResolver {
+	r.credentials = credentials
+	return r
+}
+
+// WithRetryPolicy sets the retry policy of the requests
+func (r *OCIResolver) WithRetryPolicy(policy *RetryPolicy) *OCIResolver {
+	r.retryPolicy = policy
+	return r
+}
+
+// WithPlainHTTP connects the registry without TLS, it's the default for the loopback registries
+func (r *OCIResolver) WithPlainHTTP(plainHTTP bool) *OCIResolver {
+	r.plainHTTP = plainHTTP
+	return r
+}
+
+// WithPlatform sets the platform which selects the manifest of an index, the default is the current one
+func (r *OCIResolver) WithPlatform(targetOS, targetArch string) *OCIResolver {
+	r.os = targetOS
+	r.arch = targetArch
+	return r
+}
+
+// WithLayer selects the layer by the media type or the file name of the title annotation,
+// they're optional if there's only one layer
+func (r *OCIResolver) WithLayer(mediaType, filename string) *OCIResolver {
+	r.mediaType = mediaType
+	r.filename = filename
+	return r
+}
+
+// Resolve finds the selected layer of the reference, the manifests are verified by their digests.
+// It returns ErrCanceled once the context is done.
+func (r *OCIResolver) Resolve(ctx context.Context, ref *OCIReference) (blob *OCIBlob, err error) {
+	defer func() {
+		err = checkCanceled(ctx, err)
+	}()
+	baseURL := fmt.Sprintf("%s://%s/v2/%s", r.scheme(ref.Registry), ref.Registry, ref.Repository)
+	if r.client, err = (&HTTPDownloader{
+		RoundTripper:       r.roundTripper,
+		NoProxy:            r.noProxy,
+		Proxy:              r.proxy,
+		NoProxyHosts:       r.noProxyHosts,
+		InsecureSkipVerify: r.insecureSkipVerify,
+		TLSConfig:          r.tlsConfig,
+		Timeout:            r.timeout,
+		Credentials:        r.credentials,
+		RetryPolicy:        r.retryPolicy,
+	}).newClient(r.scheme(ref.Registry)); err != nil {
+		return
+	}
+
+	reference := ref.Digest
+	if reference == "" {
+		reference = ref.Tag
+	}
+	var manifest *ociManifest
+	if manifest, err = r.getManifest(ctx, ref, baseURL, reference, ref.Digest); err != nil {
+		return
+	}
+
+	if manifest.MediaType == MediaTypeOCIIndex || manifest.MediaType == MediaTypeDockerManifestList ||
+		(manifest.MediaType == "" && len(manifest.Manifests) > 0) {
+		var platformManifest *OCIDescriptor
+		if platformManifest, err = r.selectManifest(manifest.Manifests); err != nil {
+			err = fmt.Errorf("cannot resolve %s, error: %v", ref, err)
+			return
+		}
+		if manifest, err = r.getManifest(ctx, ref, baseURL, platformManifest.Digest, platformManifest.Digest); err != nil {
+			return
+		}
+	}
+
+	var layer *OCIDescriptor
+	if layer, err = r.selectLayer(manifest.Layers); err != nil {
+		err = fmt.Errorf("cannot resolve %s, error: %v", ref, err)
+		return
+	}
+
+	blob = &OCIBlob{
+		OCIDescriptor: *layer,
+		URL:           fmt.Sprintf("%s/blobs/%s", baseURL, layer.Digest),
+	}
+	if r.authorization != "" {
+		blob.Header = map[string]string{"Authorization": r.authorization}
+	}
+	return
+}
+
+// scheme returns http if it's a loopback registry or the plain HTTP is required
+func (r *OCIResolver) scheme(registry string) string {
+	host := registry
+	if hostname, _, err := net.SplitHostPort(registry); err == nil {
+		host = hostname
+	}
+	if ip := net.ParseIP(host); r.plainHTTP || host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return "http"
+	}
+	return "https"
+}
+
+// getManifest gets the manifest or the index, it's verified if the digest is not empty
+func (r *OCIResolver) getManifest(ctx context.Context, ref *OCIReference, baseURL, reference, digest string) (
+	manifest *ociManifest, err error) {
+	manifestURL := fmt.Sprintf("%s/manifests/%s", baseURL, reference)
+	accept := strings.Join([]string{MediaTypeOCIManifest, MediaTypeOCIIndex,
+		MediaTypeDockerManifest, MediaTypeDockerManifestList}, ", ")
+
+	var data []byte
+	if data, err = r.get(ctx, ref, manifestURL, accept); err != nil {
+		return
+	}
+	if digest != "" {
+		var checksum *Checksum
+		if checksum, err = ParseChecksum(digest); err == nil {
+			err = checksum.VerifyReader(bytes.NewReader(data), manifestURL)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	manifest = &ociManifest{}
+	if err = json.Unmarshal(data, manifest); err != nil {
+		err = fmt.Errorf("failed to parse the manifest of %s, error: %v", manifestURL, err)
+	}
+	return
+}
+
+// get sends the request to the registry, it authenticates once if the registry asks for it
+func (r *OCIResolver) get(ctx context.Context, ref *OCIReference, targetURL, accept string) (data []byte, err error) {
+	var resp *http.Response
+	for authenticated := false; ; authenticated = true {
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil); err != nil {
+			return
+		}
+		req.Header.Set("Accept", accept)
+		if r.authorization != "" {
+			req.Header.Set("Authorization", r.authorization)
+		}
+
+		if resp, err = r.client.Do(req); err != nil {
+			return
+		}
+		if resp.StatusCode != http.StatusUnauthorized || authenticated {
+			break
+		}
+
+		_ = resp.Body.Close()
+		if err = r.authenticate(ctx, ref, resp.Header.Get("WWW-Authenticate")); err != nil {
+			return
+		}
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		err = &DownloadError{
+			Message:    fmt.Sprintf("failed to get '%s'", targetURL),
+			StatusCode: resp.StatusCode,
+		}
+		return
+	}
+	data, err = io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	return
+}
+
+// authenticate sets the authorization according to the challenge of the registry
+func (r *OCIResolver) authenticate(ctx context.Context, ref *OCIReference, challenge string) (err error) {
+	scheme, params := parseChallenge(challenge)
+	credential := r.getCredential(ref.Registry)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if credential == "" {
+			err = fmt.Errorf("the registry %s requires the credential", ref.Registry)
+		}
+		r.authorization = credential
+	case "bearer":
+		var token string
+		if token, err = r.getToken(ctx, ref, params, credential); err == nil {
+			r.authorization = "Bearer " + token
+		}
+	default:
+		err = fmt.Errorf("unsupported authentication challenge of the registry %s: '%s'", ref.Registry, challenge)
+	}
+	return
+}
+
+// getToken gets the bearer token from the realm, the credential is sent if it's not empty
+func (r *OCIResolver) getToken(ctx context.Context, ref *OCIReference, params map[string]string,
+	credential string) (token string, err error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		err = fmt.Errorf("invalid realm of the registry %s: '%s'", ref.Registry, params["realm"])
+		return
+	}
+
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", ref.Repository)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil); err != nil {
+		return
+	}
+	if credential != "" {
+		req.Header.Set("Authorization", credential)
+	}
+
+	var resp *http.Response
+	if resp, err = r.client.Do(req); err != nil {
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		err = &DownloadError{
+			Message:    fmt.Sprintf("failed to get the token of %s from '%s'", ref.Registry, realm.Host),
+			StatusCode: resp.StatusCode,
+		}
+		return
+	}
+
+	result := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&result); err != nil {
+		err = fmt.Errorf("failed to parse the token of %s, error: %v", ref.Registry, err)
+		return
+	}
+	if token = result.Token; token == "" {
+		token = result.AccessToken
+	}
+	if token == "" {
+		err = fmt.Errorf("no token of %s from '%s'", ref.Registry, realm.Host)
+	}
+	return
+}
+
+// getCredential returns the Authorization header of the registry from the basic auth or the credentials
+func (r *OCIResolver) getCredential(registry string) string {
+	req := &http.Request{Header: http.Header{}, URL: &url.URL{Host: registry}}
+	if r.username != "" || r.password != "" {
+		req.SetBasicAuth(r.username, r.password)
+	} else if r.credentials != nil {
+		if credential := r.credentials.Resolve(req.URL); credential != nil {
+			credential.Apply(req)
+		}
+	}
+	return req.Header.Get("Authorization")
+}
+
+// selectManifest returns the manifest of the platform from the index
+func (r *OCIResolver) selectManifest(manifests []OCIDescriptor) (manifest *OCIDescriptor, err error) {
+	targetOS, targetArch := r.os, r.arch
+	if targetOS == "" {
+		targetOS = runtime.GOOS
+	}
+	if targetArch == "" {
+		targetArch = runtime.GOARCH
+	}
+
+	for i := range manifests {
+		if platform := manifests[i].Platform; platform != nil && platform.OS == targetOS && platform.Architecture == targetArch {
+			manifest = &manifests[i]
+			return
+		}
+	}
+	if len(manifests) == 1 && manifests[0].Platform == nil {
+		manifest = &manifests[0]
+		return
+	}
+	err = fmt.Errorf("no manifest of the platform %s/%s", targetOS, targetArch)
+	return
+}
+
+// selectLayer returns the only layer which matches the media type and the file name
+func (r *OCIResolver) selectLayer(layers []OCIDescriptor) (layer *OCIDescriptor, err error) {
+	var candidates []string
+	for i := range layers {
+		if (r.mediaType == "" || layers[i].MediaType == r.mediaType) &&
+			(r.filename == "" || layers[i].Filename() == r.filename) {
+			layer = &layers[i]
+			candidates = append(candidates, fmt.Sprintf("%s (%s)", layers[i].Filename(), layers[i].MediaType))
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		err = fmt.Errorf("no layer matches the media type '%s' and the file name '%s'", r.mediaType, r.filename)
+	case 1:
+	default:
+		layer = nil
+		err = fmt.Errorf("there are %d layers, please select one by the media type or the file name: %s",
+			len(candidates), strings.Join(candidates, ", "))
+	}
+	return
+}
+
+// parseChallenge parses the WWW-Authenticate header, for instance:
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull"
+func parseChallenge(header string) (scheme string, params map[string]string) {
+	params = map[string]string{}
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimLeft(rest, ", ") {
+		var key string
+		if key, rest, _ = strings.Cut(rest, "="); key == "" {
+			break
+		}
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			// the quoted value might have commas, for instance: repository:foo:pull,push
+			end := strings.Index(rest[1:], `"`) + 1
+			if end <= 0 {
+				end = len(rest)
+			}
+			value, rest = rest[1:end], rest[end:]
+			rest = strings.TrimPrefix(rest, `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return
+}
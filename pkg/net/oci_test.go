@@ -0,0 +1,253 @@
+package net_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRegistry is a registry:2 compatible server which requires the bearer token of a user
+type fakeRegistry struct {
+	*httptest.Server
+	blobs     map[string][]byte
+	manifests map[string][]byte
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	registry := &fakeRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+	registry.Server = httptest.NewServer(http.HandlerFunc(registry.serve))
+	t.Cleanup(registry.Close)
+	return registry
+}
+
+func digestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// pushBlob adds a blob and returns its descriptor
+func (r *fakeRegistry) pushBlob(mediaType, title string, data []byte) net.OCIDescriptor {
+	descriptor := net.OCIDescriptor{MediaType: mediaType, Digest: digestOf(data), Size: int64(len(data))}
+	if title != "" {
+		descriptor.Annotations = map[string]string{net.AnnotationTitle: title}
+	}
+	r.blobs[descriptor.Digest] = data
+	return descriptor
+}
+
+// pushManifest adds a manifest with the tag, and returns its descriptor
+func (r *fakeRegistry) pushManifest(tag, mediaType string, manifest interface{}) net.OCIDescriptor {
+	data, _ := json.Marshal(manifest)
+	descriptor := net.OCIDescriptor{MediaType: mediaType, Digest: digestOf(data), Size: int64(len(data))}
+	r.manifests[descriptor.Digest] = data
+	if tag != "" {
+		r.manifests[tag] = data
+	}
+	return descriptor
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if user, password, ok := req.BasicAuth(); !ok || user != "rick" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("scope") != "repository:org/tool:pull" || req.URL.Query().Get("service") != "fake" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token": "fake-token"}`))
+		return
+	}
+
+	if req.Header.Get("Authorization") != "Bearer fake-token" {
+		w.Header().Set("WWW-Authenticate",
+			fmt.Sprintf(`Bearer realm="%s/token",service="fake",scope="repository:org/tool:pull"`, r.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	prefix := "/v2/org/tool/"
+	if !strings.HasPrefix(req.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	kind, reference, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, prefix), "/")
+	var data []byte
+	var ok bool
+	switch kind {
+	case "manifests":
+		data, ok = r.manifests[reference]
+	case "blobs":
+		data, ok = r.blobs[reference]
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(data))
+}
+
+func TestParseOCIReference(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		expect  *net.OCIReference
+		wantErr bool
+	}{{
+		name:   "tag",
+		text:   "oci://ghcr.io/org/tool:v1.0.0",
+		expect: &net.OCIReference{Registry: "ghcr.io", Repository: "org/tool", Tag: "v1.0.0"},
+	}, {
+		name:   "default tag with port",
+		text:   "oci://localhost:5000/org/tool",
+		expect: &net.OCIReference{Registry: "localhost:5000", Repository: "org/tool", Tag: "latest"},
+	}, {
+		name: "digest",
+		text: "oci://ghcr.io/org/tool@sha256:c31b829ca8935a8054312faaf42a5392756e65abfa94b91d41c306409542ef98",
+		expect: &net.OCIReference{Registry: "ghcr.io", Repository: "org/tool",
+			Digest: "sha256:c31b829ca8935a8054312faaf42a5392756e65abfa94b91d41c306409542ef98"},
+	}, {
+		name:   "Docker Hub",
+		text:   "oci://docker.io/alpine:3",
+		expect: &net.OCIReference{Registry: "registry-1.docker.io", Repository: "library/alpine", Tag: "3"},
+	}, {
+		name:    "no repository",
+		text:    "oci://ghcr.io",
+		wantErr: true,
+	}, {
+		name:    "invalid digest",
+		text:    "oci://ghcr.io/org/tool@sha256:invalid",
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := net.ParseOCIReference(tt.text)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expect, ref)
+			}
+		})
+	}
+}
+
+func TestOCIResolver(t *testing.T) {
+	registry := newFakeRegistry(t)
+	content := strings.Repeat("0123456789", 1000)
+	binary := registry.pushBlob("application/vnd.foo.binary", "bin/tool", []byte(content))
+	readme := registry.pushBlob("text/markdown", "README.md", []byte("readme"))
+	config := registry.pushBlob("application/vnd.oci.empty.v1+json", "", []byte("{}"))
+	manifest := registry.pushManifest("v1", net.MediaTypeOCIManifest, map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     net.MediaTypeOCIManifest,
+		"config":        config,
+		"layers":        []net.OCIDescriptor{binary, readme},
+	})
+	single := registry.pushManifest("", net.MediaTypeOCIManifest, map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     net.MediaTypeOCIManifest,
+		"layers":        []net.OCIDescriptor{readme},
+	})
+	single.Platform = &net.OCIPlatform{OS: "linux", Architecture: "arm64"}
+	registry.pushManifest("index", net.MediaTypeOCIIndex, map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     net.MediaTypeOCIIndex,
+		"manifests":     []net.OCIDescriptor{single},
+	})
+	// the loopback registry is connected by plain HTTP
+	reference := "oci://" + strings.TrimPrefix(registry.URL, "http://") + "/org/tool"
+
+	resolve := func(suffix string, setup func(*net.OCIResolver)) (*net.OCIBlob, error) {
+		ref, err := net.ParseOCIReference(reference + suffix)
+		if err != nil {
+			return nil, err
+		}
+		resolver := &net.OCIResolver{}
+		resolver.WithBasicAuth("rick", "secret")
+		if setup != nil {
+			setup(resolver)
+		}
+		return resolver.Resolve(context.Background(), ref)
+	}
+
+	t.Run("select by the file name", func(t *testing.T) {
+		blob, err := resolve(":v1", func(resolver *net.OCIResolver) {
+			resolver.WithLayer("", "tool")
+		})
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, "tool", blob.Filename())
+		assert.Equal(t, binary.Digest, blob.Digest)
+		assert.Equal(t, map[string]string{"Authorization": "Bearer fake-token"}, blob.Header)
+
+		// the blob is downloaded by the multi-thread downloader with the token
+		buf := &bytes.Buffer{}
+		downloader := &net.MultiThreadDownloader{}
+		downloader.WithHeader(blob.Header)
+		assert.Nil(t, downloader.DownloadWithContext(context.Background(), blob.URL, buf, 4))
+		assert.Equal(t, content, buf.String())
+	})
+
+	t.Run("select by the media type and digest", func(t *testing.T) {
+		blob, err := resolve("@"+manifest.Digest, func(resolver *net.OCIResolver) {
+			resolver.WithLayer("text/markdown", "")
+		})
+		if assert.Nil(t, err) {
+			assert.Equal(t, readme.Digest, blob.Digest)
+		}
+	})
+
+	t.Run("the manifest of the platform", func(t *testing.T) {
+		blob, err := resolve(":index", func(resolver *net.OCIResolver) {
+			resolver.WithPlatform("linux", "arm64")
+		})
+		if assert.Nil(t, err) {
+			assert.Equal(t, readme.Digest, blob.Digest)
+		}
+
+		_, err = resolve(":index", func(resolver *net.OCIResolver) {
+			resolver.WithPlatform("windows", "amd64")
+		})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ambiguous layers", func(t *testing.T) {
+		_, err := resolve(":v1", nil)
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "README.md (text/markdown)")
+		}
+	})
+
+	t.Run("digest mismatched", func(t *testing.T) {
+		other := digestOf([]byte("other"))
+		registry.manifests[other] = registry.manifests["v1"]
+		_, err := resolve("@"+other, nil)
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "checksum")
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		_, err := resolve(":v1", func(resolver *net.OCIResolver) {
+			resolver.WithBasicAuth("rick", "wrong")
+		})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("tag not found", func(t *testing.T) {
+		_, err := resolve(":v2", nil)
+		assert.NotNil(t, err)
+	})
+}
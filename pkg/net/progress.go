@@ -1,16 +1,20 @@
 package net
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/k0kubun/go-ansi"
 	"github.com/schollz/progressbar/v3"
 )
 
 // ProgressIndicator hold the progress of io operation
+// Deprecated, the downloaders emit the events into a ProgressObserver instead
 type ProgressIndicator struct {
 	Writer io.Writer
 	Reader io.Reader
@@ -33,8 +37,10 @@ func GetCurrentLine() int {
 
 // Init set the default value for progress indicator
 func (i *ProgressIndicator) Init() {
+	guard.Lock()
 	i.line = line
 	line++
+	guard.Unlock()
 	i.bar = progressbar.NewOptions64(int64(i.Total),
 		progressbar.OptionSetWriter(ansi.NewAnsiStdout()),
 		progressbar.OptionEnableColorCodes(true),
@@ -79,3 +85,191 @@ func (i *ProgressIndicator) Read(p []byte) (n int, err error) {
 	n, err = io.MultiReader(i.Reader, i.bar).Read(p)
 	return
 }
+
+// ProgressEventType is the type of the progress event
+type ProgressEventType string
+
+const (
+	// ProgressStarted means the response is accepted, and it's going to write the data
+	ProgressStarted ProgressEventType = "started"
+	// ProgressBytes means some bytes were written, the events are throttled
+	ProgressBytes ProgressEventType = "bytes"
+	// ProgressRetry means a failed request or chunk is going to be retried
+	ProgressRetry ProgressEventType = "retry"
+	// ProgressChunkDone means a chunk of the multi-thread download is finished
+	ProgressChunkDone ProgressEventType = "chunk_done"
+	// ProgressFinished means the download is finished
+	ProgressFinished ProgressEventType = "finished"
+	// ProgressFailed means the download is failed
+	ProgressFailed ProgressEventType = "failed"
+	// ProgressMessage is a notice of the download, for instance: a mirror was dropped
+	ProgressMessage ProgressEventType = "message"
+)
+
+// ProgressEvent is emitted by the downloaders
+type ProgressEvent struct {
+	Type  ProgressEventType `json:"type"`
+	Time  time.Time         `json:"time"`
+	URL   string            `json:"url"`
+	Title string            `json:"title,omitempty"`
+	// Chunk is the number of the chunk which starts from 1, zero means the whole file
+	Chunk int `json:"chunk,omitempty"`
+	// Chunks is the count of the chunks, it's only set in the started event of a multi-thread download
+	Chunks int `json:"chunks,omitempty"`
+	// Total is the size of the file or the chunk, it's -1 if the size is unknown
+	Total int64 `json:"total"`
+	// Downloaded is the count of the written bytes of the file or the chunk
+	Downloaded int64 `json:"downloaded"`
+	// Attempt is the failed attempt of the retry event, it starts from 1
+	Attempt int `json:"attempt,omitempty"`
+	// Wait is the duration before the next attempt of the retry event
+	Wait  time.Duration `json:"wait,omitempty"`
+	Error string        `json:"error,omitempty"`
+	// Message is the text of the message event
+	Message string `json:"message,omitempty"`
+	// Mirror is the URL which the chunk is downloaded from, it's empty if it's the URL of the file
+	Mirror string `json:"mirror,omitempty"`
+}
+
+// ProgressObserver receives the progress events, it should be safe for concurrent use
+type ProgressObserver interface {
+	OnProgress(event ProgressEvent)
+}
+
+// ProgressObserverFunc is an adapter to allow the use of ordinary functions as ProgressObserver
+type ProgressObserverFunc func(event ProgressEvent)
+
+// OnProgress calls f(event)
+func (f ProgressObserverFunc) OnProgress(event ProgressEvent) {
+	f(event)
+}
+
+// notify emits the message event to the observer. The message is written into the stderr if there's no
+// observer, because the stdout might be the downloaded data, for instance: hd get <url> -o -
+func notify(observer ProgressObserver, targetURL, message string) {
+	if observer == nil {
+		fmt.Fprintln(os.Stderr, message)
+		return
+	}
+	observer.OnProgress(ProgressEvent{Type: ProgressMessage, Time: time.Now(), URL: targetURL, Message: message})
+}
+
+// progressInterval is the minimum interval between two bytes events
+const progressInterval = 200 * time.Millisecond
+
+// progressReporter emits the progress events of a file or a chunk, a nil reporter does nothing
+type progressReporter struct {
+	observer   ProgressObserver
+	url, title string
+	chunk      int
+	total      int64
+	downloaded atomic.Int64
+	lastEmit   atomic.Int64
+	started    atomic.Bool
+}
+
+func newProgressReporter(observer ProgressObserver, targetURL, title string, chunk int) *progressReporter {
+	if observer == nil {
+		return nil
+	}
+	return &progressReporter{observer: observer, url: targetURL, title: title, chunk: chunk, total: -1}
+}
+
+func (r *progressReporter) emit(event ProgressEvent) {
+	event.Time = time.Now()
+	event.URL = r.url
+	event.Title = r.title
+	if event.Chunk == 0 {
+		event.Chunk = r.chunk
+	}
+	event.Total = r.total
+	event.Downloaded = r.downloaded.Load()
+	r.observer.OnProgress(event)
+}
+
+// start emits the started event, the downloaded bytes are the ones of the previous downloads
+func (r *progressReporter) start(total, downloaded int64, chunks int) {
+	if r == nil {
+		return
+	}
+	r.total = total
+	r.downloaded.Store(downloaded)
+	r.lastEmit.Store(time.Now().UnixNano())
+	r.started.Store(true)
+	r.emit(ProgressEvent{Type: ProgressStarted, Chunks: chunks})
+}
+
+// add records the written bytes, the bytes event is emitted if it's long enough since the last one
+func (r *progressReporter) add(n int64) {
+	if r == nil || n <= 0 {
+		return
+	}
+	r.downloaded.Add(n)
+
+	now := time.Now().UnixNano()
+	if last := r.lastEmit.Load(); now-last >= int64(progressInterval) && r.lastEmit.CompareAndSwap(last, now) {
+		r.emit(ProgressEvent{Type: ProgressBytes})
+	}
+}
+
+// retry emits the retry event of the chunk, zero means the reporter's own chunk
+func (r *progressReporter) retry(chunk int, attempt RetryAttempt) {
+	if r == nil {
+		return
+	}
+	event := ProgressEvent{Type: ProgressRetry, Chunk: chunk, Attempt: attempt.Attempt, Wait: attempt.Wait}
+	if attempt.Err != nil {
+		event.Error = attempt.Err.Error()
+	} else if attempt.Response != nil {
+		event.Error = attempt.Response.Status
+	}
+	r.emit(event)
+}
+
+// chunkDone emits the chunk done event with the progress of the file
+func (r *progressReporter) chunkDone(chunk int) {
+	if r == nil {
+		return
+	}
+	r.emit(ProgressEvent{Type: ProgressChunkDone, Chunk: chunk})
+}
+
+// finish emits the failed event if there's an error, otherwise emits the finished event if it was started
+func (r *progressReporter) finish(err error) {
+	if r == nil {
+		return
+	}
+	if err != nil && !errors.Is(err, errChunkFinished) {
+		r.emit(ProgressEvent{Type: ProgressFailed, Error: err.Error()})
+	} else if r.started.Load() {
+		r.emit(ProgressEvent{Type: ProgressFinished})
+	}
+}
+
+// withRetry returns a copy of the policy which emits the retry events
+func (r *progressReporter) withRetry(policy *RetryPolicy) *RetryPolicy {
+	if r == nil || policy == nil {
+		return policy
+	}
+	observed := *policy
+	observed.OnRetry = func(attempt RetryAttempt) {
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt)
+		}
+		r.retry(0, attempt)
+	}
+	return &observed
+}
+
+// progressWriter reports the written bytes
+type progressWriter struct {
+	writer   io.Writer
+	reporter *progressReporter
+}
+
+// Write writes the data, then reports the bytes
+func (w *progressWriter) Write(p []byte) (n int, err error) {
+	n, err = w.writer.Write(p)
+	w.reporter.add(int64(n))
+	return
+}
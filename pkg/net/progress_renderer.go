@@ -0,0 +1,494 @@
+package net
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/k0kubun/go-ansi"
+	"golang.org/x/term"
+)
+
+const (
+	// ProgressAuto renders the progress bars in a terminal, otherwise renders the plain lines
+	ProgressAuto = "auto"
+	// ProgressBar renders the progress bars
+	ProgressBar = "bar"
+	// ProgressPlain renders a line for each important event, it's friendly to the CI logs
+	ProgressPlain = "plain"
+	// ProgressJSON renders each event as a JSON line
+	ProgressJSON = "json"
+	// ProgressNone renders nothing
+	ProgressNone = "none"
+)
+
+// NewProgressRenderer creates the renderer of the progress events by the mode which could be
+// auto, bar, plain, json or none. The auto mode picks the bar if the writer is a terminal, and
+// the bar has no color if the environment variable NO_COLOR is set.
+func NewProgressRenderer(mode string, writer io.Writer) (observer ProgressObserver, err error) {
+	switch ResolveProgressMode(mode, writer) {
+	case ProgressBar:
+		observer = NewBarRenderer(writer, os.Getenv("NO_COLOR") == "")
+	case ProgressPlain:
+		observer = NewPlainRenderer(writer)
+	case ProgressJSON:
+		observer = NewJSONRenderer(writer)
+	case ProgressNone:
+	default:
+		err = fmt.Errorf("unknown progress mode '%s', it should be auto, bar, plain, json or none", mode)
+	}
+	return
+}
+
+// ResolveProgressMode returns the bar mode if the writer is a terminal, and returns the plain mode if it's not.
+// The other modes are returned directly.
+func ResolveProgressMode(mode string, writer io.Writer) string {
+	if mode == "" || mode == ProgressAuto {
+		if isTerminal(writer) && os.Getenv("TERM") != "dumb" {
+			mode = ProgressBar
+		} else {
+			mode = ProgressPlain
+		}
+	}
+	return mode
+}
+
+// isTerminal returns true if the writer is a terminal
+func isTerminal(writer io.Writer) bool {
+	f, ok := writer.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+var (
+	defaultObserver     ProgressObserver
+	defaultObserverOnce sync.Once
+)
+
+// defaultProgressObserver renders the progress bars in the stdout, it's used when there's no observer.
+// All the downloads share the same one, so their bars do not overwrite each other.
+func defaultProgressObserver() ProgressObserver {
+	defaultObserverOnce.Do(func() {
+		defaultObserver = NewBarRenderer(os.Stdout, os.Getenv("NO_COLOR") == "")
+	})
+	return defaultObserver
+}
+
+const (
+	// barRedrawInterval is the minimum interval between two redraws of the bytes events
+	barRedrawInterval = 100 * time.Millisecond
+	barWidth          = 20
+	defaultLineWidth  = 80
+)
+
+// barRenderer is a container of the progress bars, it owns the lines below the cursor and redraws them in place.
+// Each download takes a bar, a multi-thread download has an aggregate bar with the total speed and ETA, and
+// a bar for each unfinished chunk below it. The lines are left on the screen once all the downloads are done,
+// the next downloads start from a new region.
+type barRenderer struct {
+	writer io.Writer
+	color  bool
+	width  int
+
+	lock     sync.Mutex
+	tasks    []*barTask
+	drawn    int
+	lastDraw time.Time
+}
+
+// barTask is the state of a bar
+type barTask struct {
+	url, name   string
+	chunk       int
+	multiThread bool
+	total       int64
+	downloaded  int64
+	// resumed is the downloaded bytes before starting, they're not counted in the speed
+	resumed int64
+	// offset is the downloaded bytes of a chunk in the previous attempts
+	offset  int64
+	started time.Time
+	updated time.Time
+	done    bool
+	note    string
+	err     string
+	chunks  []*barTask
+}
+
+// NewBarRenderer creates a renderer which renders the progress bars, it's safe to share it
+// between the parallel downloads
+func NewBarRenderer(writer io.Writer, color bool) ProgressObserver {
+	width := defaultLineWidth
+	if f, ok := writer.(*os.File); ok && isTerminal(f) {
+		if w, _, err := term.GetSize(int(f.Fd())); err == nil && w > 0 {
+			width = w
+		}
+	}
+
+	switch writer {
+	case os.Stdout:
+		writer = ansi.NewAnsiStdout()
+	case os.Stderr:
+		writer = ansi.NewAnsiStderr()
+	}
+	return &barRenderer{writer: writer, color: color, width: width}
+}
+
+// OnProgress updates the bar of the event, then redraws the bars
+func (r *barRenderer) OnProgress(event ProgressEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if event.Type == ProgressMessage {
+		r.printMessage(event)
+		return
+	}
+	if event.Chunk == 0 {
+		r.updateFile(event)
+	} else {
+		r.updateChunk(event)
+	}
+
+	if event.Type != ProgressBytes || event.Time.Sub(r.lastDraw) >= barRedrawInterval {
+		r.draw(event.Time)
+	}
+}
+
+// printMessage prints the message on the first line of the bars, then redraws the bars below it
+func (r *barRenderer) printMessage(event ProgressEvent) {
+	buf := &strings.Builder{}
+	if r.drawn > 0 {
+		fmt.Fprintf(buf, "\033[%dA", r.drawn)
+	}
+	fmt.Fprintf(buf, "\r\033[J%s\n", event.Message)
+	_, _ = io.WriteString(r.writer, buf.String())
+
+	r.drawn = 0
+	if len(r.tasks) > 0 {
+		r.draw(event.Time)
+	}
+}
+
+// updateFile updates the bar of a whole file
+func (r *barRenderer) updateFile(event ProgressEvent) {
+	task := r.findFile(event.URL)
+	if task == nil {
+		if event.Type != ProgressStarted {
+			return
+		}
+		task = &barTask{url: event.URL, name: displayName(event.URL, event.Title)}
+		r.tasks = append(r.tasks, task)
+	}
+
+	task.updated = event.Time
+	task.total = event.Total
+	task.downloaded = event.Downloaded
+	switch event.Type {
+	case ProgressStarted:
+		task.multiThread = event.Chunks > 0
+		task.resumed = event.Downloaded
+		task.started = event.Time
+	case ProgressRetry:
+		task.note = fmt.Sprintf("retry #%d: %s", event.Attempt, event.Error)
+	case ProgressFinished:
+		task.done = true
+		task.chunks = nil
+	case ProgressFailed:
+		task.done = true
+		task.err = event.Error
+		task.chunks = nil
+	default:
+		task.note = ""
+	}
+}
+
+// updateChunk updates the bar of a chunk, it's below the bar of its file
+func (r *barRenderer) updateChunk(event ProgressEvent) {
+	file := r.findFile(event.URL)
+	if file == nil || !file.multiThread {
+		return
+	}
+
+	var task *barTask
+	for _, chunk := range file.chunks {
+		if chunk.chunk == event.Chunk {
+			task = chunk
+		}
+	}
+
+	switch event.Type {
+	case ProgressStarted:
+		if task == nil {
+			task = &barTask{url: event.URL, name: fmt.Sprintf("chunk %d", event.Chunk), chunk: event.Chunk, started: event.Time}
+			file.chunks = append(file.chunks, task)
+		}
+		// a retried chunk continues from where it stopped
+		task.offset = task.downloaded
+		task.total = task.offset + event.Total
+		task.downloaded = task.offset + event.Downloaded
+		task.note = ""
+	case ProgressBytes, ProgressFinished:
+		if task != nil {
+			task.downloaded = task.offset + event.Downloaded
+		}
+	case ProgressRetry:
+		if task != nil {
+			task.note = fmt.Sprintf("retry #%d: %s", event.Attempt, event.Error)
+		}
+	case ProgressChunkDone:
+		// the finished chunk gives its line back
+		for i, chunk := range file.chunks {
+			if chunk.chunk == event.Chunk {
+				file.chunks = append(file.chunks[:i], file.chunks[i+1:]...)
+				break
+			}
+		}
+		file.downloaded = event.Downloaded
+		file.updated = event.Time
+	}
+	if task != nil {
+		task.updated = event.Time
+	}
+}
+
+// findFile returns the unfinished bar of a file
+func (r *barRenderer) findFile(targetURL string) *barTask {
+	for _, task := range r.tasks {
+		if task.url == targetURL && !task.done {
+			return task
+		}
+	}
+	return nil
+}
+
+// draw moves the cursor to the first line of the bars, then redraws all of them. The region is released
+// once all the downloads are done, so the other outputs are not overwritten.
+// See also https://en.wikipedia.org/wiki/ANSI_escape_code#Sequence_elements
+func (r *barRenderer) draw(now time.Time) {
+	r.lastDraw = now
+
+	var lines []string
+	running := false
+	for _, task := range r.tasks {
+		lines = append(lines, r.format(task, ""))
+		for _, chunk := range task.chunks {
+			lines = append(lines, r.format(chunk, "  "))
+		}
+		running = running || !task.done
+	}
+
+	buf := &strings.Builder{}
+	if r.drawn > 0 {
+		fmt.Fprintf(buf, "\033[%dA", r.drawn)
+	}
+	for _, line := range lines {
+		fmt.Fprintf(buf, "\r\033[2K%s\n", line)
+	}
+	if extra := r.drawn - len(lines); extra > 0 {
+		// clear the lines of the finished chunks
+		buf.WriteString(strings.Repeat("\033[2K\n", extra))
+		fmt.Fprintf(buf, "\033[%dA", extra)
+	}
+	_, _ = io.WriteString(r.writer, buf.String())
+
+	if r.drawn = len(lines); !running {
+		r.tasks = nil
+		r.drawn = 0
+	}
+}
+
+// format returns a line of the bar which fits the width, for instance:
+// bar.tar.gz [=========>          ]  48% 1.2M/2.5M 3.1M/s ETA 1s
+func (r *barRenderer) format(task *barTask, indent string) string {
+	var stats string
+	elapsed := task.updated.Sub(task.started)
+	speed := float64(0)
+	if elapsed > 0 {
+		speed = float64(task.downloaded-task.resumed) / elapsed.Seconds()
+	}
+
+	switch {
+	case task.err != "":
+		stats = "failed: " + task.err
+	case task.done:
+		stats = fmt.Sprintf("%s in %v", FormatSize(task.downloaded), elapsed.Round(time.Millisecond))
+	case task.total > 0:
+		stats = fmt.Sprintf("%3d%% %s/%s", percentOf(task.downloaded, task.total),
+			FormatSize(task.downloaded), FormatSize(task.total))
+	default:
+		stats = FormatSize(task.downloaded)
+	}
+	if !task.done && task.chunk == 0 && speed > 0 {
+		stats += fmt.Sprintf(" %s/s", FormatSize(int64(speed)))
+		if task.total > 0 {
+			eta := time.Duration(float64(task.total-task.downloaded) / speed * float64(time.Second))
+			stats += fmt.Sprintf(" ETA %v", eta.Round(time.Second))
+		}
+	}
+	if task.note != "" && !task.done {
+		stats += " " + task.note
+	}
+
+	fill, filled := "", 0
+	if task.total > 0 && task.err == "" {
+		if filled = int(int64(barWidth) * task.downloaded / task.total); filled > barWidth {
+			filled = barWidth
+		}
+		if fill = strings.Repeat("=", filled); filled > 0 && filled < barWidth {
+			fill = fill[1:] + ">"
+		}
+	}
+	barLen := 0
+	if task.total > 0 && task.err == "" {
+		barLen = barWidth + 3
+	}
+
+	// the line must not be wrapped, otherwise the cursor moves to the wrong line
+	name := indent + task.name
+	maxLen := r.width - 1
+	if room := maxLen - barLen - len(stats) - 1; len(name) > room {
+		if room < 8 {
+			room = 8
+		}
+		if len(name) > room {
+			name = name[:room-3] + "..."
+		}
+	}
+	if room := maxLen - len(name) - 1 - barLen; len(stats) > room {
+		if room < 0 {
+			room = 0
+		}
+		stats = stats[:room]
+	}
+
+	if r.color {
+		if task.err != "" {
+			return "\033[31m" + name + " " + stats + "\033[0m"
+		}
+		name = "\033[36m" + name + "\033[0m"
+		fill = "\033[32m" + fill + "\033[0m"
+	}
+	if barLen == 0 {
+		return name + " " + stats
+	}
+	return name + " [" + fill + strings.Repeat(" ", barWidth-filled) + "] " + stats
+}
+
+// displayName returns the file name of the URL, or the title if there's no file name
+func displayName(targetURL, title string) string {
+	if u, err := url.Parse(targetURL); err == nil {
+		if name := path.Base(u.Path); name != "" && name != "/" && name != "." {
+			return name
+		}
+	}
+	return title
+}
+
+// plainRenderer writes a line for each important event of the whole files
+type plainRenderer struct {
+	writer io.Writer
+
+	lock     sync.Mutex
+	percents map[string]int64
+	starts   map[string]time.Time
+}
+
+// NewPlainRenderer creates a renderer which writes the lines without any control characters.
+// The progress is written every 10 percent.
+func NewPlainRenderer(writer io.Writer) ProgressObserver {
+	return &plainRenderer{writer: writer, percents: map[string]int64{}, starts: map[string]time.Time{}}
+}
+
+// OnProgress writes the line of the event
+func (r *plainRenderer) OnProgress(event ProgressEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	switch event.Type {
+	case ProgressStarted:
+		if event.Chunk != 0 {
+			return
+		}
+		r.starts[event.URL] = event.Time
+		r.percents[event.URL] = percentOf(event.Downloaded, event.Total) / 10 * 10
+		size := "unknown size"
+		if event.Total >= 0 {
+			size = FormatSize(event.Total)
+		}
+		if event.Chunks > 0 {
+			fmt.Fprintf(r.writer, "downloading %s (%s) with %d chunks\n", event.URL, size, event.Chunks)
+		} else {
+			fmt.Fprintf(r.writer, "downloading %s (%s)\n", event.URL, size)
+		}
+	case ProgressBytes:
+		if event.Chunk != 0 || event.Total <= 0 {
+			return
+		}
+		if percent := percentOf(event.Downloaded, event.Total) / 10 * 10; percent > r.percents[event.URL] {
+			r.percents[event.URL] = percent
+			fmt.Fprintf(r.writer, "%s: %d%% (%s/%s)\n", event.URL, percent,
+				FormatSize(event.Downloaded), FormatSize(event.Total))
+		}
+	case ProgressRetry:
+		fmt.Fprintf(r.writer, "%s: retry%s after %v, attempt %d failed: %s\n", event.URL, chunkSuffix(event.Chunk),
+			event.Wait.Round(time.Millisecond), event.Attempt, event.Error)
+	case ProgressChunkDone:
+		fmt.Fprintf(r.writer, "%s: chunk %d done\n", event.URL, event.Chunk)
+	case ProgressFinished:
+		if event.Chunk != 0 {
+			return
+		}
+		elapsed := event.Time.Sub(r.starts[event.URL]).Round(time.Millisecond)
+		fmt.Fprintf(r.writer, "%s: finished, %s in %v\n", event.URL, FormatSize(event.Downloaded), elapsed)
+		r.forget(event.URL)
+	case ProgressFailed:
+		fmt.Fprintf(r.writer, "%s: failed%s, %s\n", event.URL, chunkSuffix(event.Chunk), event.Error)
+		if event.Chunk == 0 {
+			r.forget(event.URL)
+		}
+	case ProgressMessage:
+		fmt.Fprintf(r.writer, "%s: %s\n", event.URL, event.Message)
+	}
+}
+
+func (r *plainRenderer) forget(targetURL string) {
+	delete(r.percents, targetURL)
+	delete(r.starts, targetURL)
+}
+
+func percentOf(downloaded, total int64) int64 {
+	if total <= 0 {
+		return 0
+	}
+	return downloaded * 100 / total
+}
+
+func chunkSuffix(chunk int) string {
+	if chunk == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" of chunk %d", chunk)
+}
+
+// jsonRenderer writes each event as a JSON line
+type jsonRenderer struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONRenderer creates a renderer which writes the events as newline-delimited JSON
+func NewJSONRenderer(writer io.Writer) ProgressObserver {
+	return &jsonRenderer{encoder: json.NewEncoder(writer)}
+}
+
+// OnProgress writes the event as a JSON line
+func (r *jsonRenderer) OnProgress(event ProgressEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_ = r.encoder.Encode(event)
+}
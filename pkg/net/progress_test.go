@@ -0,0 +1,290 @@
+package net_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+// eventRecorder records the progress events
+type eventRecorder struct {
+	lock   sync.Mutex
+	events []net.ProgressEvent
+}
+
+func (r *eventRecorder) OnProgress(event net.ProgressEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+}
+
+// filter returns the events of a type
+func (r *eventRecorder) filter(eventType net.ProgressEventType) (events []net.ProgressEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, event := range r.events {
+		if event.Type == eventType {
+			events = append(events, event)
+		}
+	}
+	return
+}
+
+func TestProgressEvents(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case "/flaky":
+			if atomic.AddInt32(&requests, 1) <= 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	t.Run("finished", func(t *testing.T) {
+		recorder := &eventRecorder{}
+		downloader := &net.HTTPDownloader{
+			URL:            server.URL,
+			TargetFilePath: path.Join(t.TempDir(), "target"),
+			Observer:       recorder,
+		}
+		assert.Nil(t, downloader.DownloadFile())
+
+		if assert.NotEmpty(t, recorder.events) {
+			assert.Equal(t, net.ProgressStarted, recorder.events[0].Type)
+			assert.Equal(t, int64(100), recorder.events[0].Total)
+			assert.Equal(t, server.URL, recorder.events[0].URL)
+
+			last := recorder.events[len(recorder.events)-1]
+			assert.Equal(t, net.ProgressFinished, last.Type)
+			assert.Equal(t, int64(100), last.Downloaded)
+		}
+		assert.Empty(t, recorder.filter(net.ProgressFailed))
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		policy := net.DefaultRetryPolicy()
+		policy.InitialInterval = time.Millisecond
+
+		recorder := &eventRecorder{}
+		downloader := &net.HTTPDownloader{
+			URL:            server.URL + "/flaky",
+			TargetFilePath: path.Join(t.TempDir(), "target"),
+			Observer:       recorder,
+			RetryPolicy:    policy,
+		}
+		assert.Nil(t, downloader.DownloadFile())
+
+		retries := recorder.filter(net.ProgressRetry)
+		if assert.Equal(t, 1, len(retries)) {
+			assert.Equal(t, 1, retries[0].Attempt)
+			assert.NotEmpty(t, retries[0].Error)
+		}
+		assert.Equal(t, 1, len(recorder.filter(net.ProgressFinished)))
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		recorder := &eventRecorder{}
+		downloader := &net.HTTPDownloader{
+			URL:            server.URL + "/missing",
+			TargetFilePath: path.Join(t.TempDir(), "target"),
+			Observer:       recorder,
+		}
+		assert.NotNil(t, downloader.DownloadFile())
+
+		failures := recorder.filter(net.ProgressFailed)
+		if assert.Equal(t, 1, len(failures)) {
+			assert.NotEmpty(t, failures[0].Error)
+		}
+		assert.Empty(t, recorder.filter(net.ProgressFinished))
+	})
+}
+
+func TestMultiThreadProgressEvents(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	recorder := &eventRecorder{}
+	downloader := &net.MultiThreadDownloader{}
+	downloader.WithObserver(recorder)
+	assert.Nil(t, downloader.Download(server.URL, path.Join(t.TempDir(), "target"), 2))
+
+	var started net.ProgressEvent
+	for _, event := range recorder.filter(net.ProgressStarted) {
+		if event.Chunk == 0 {
+			started = event
+		}
+	}
+	assert.Equal(t, 2, started.Chunks)
+	assert.Equal(t, int64(100), started.Total)
+
+	var chunks []int
+	for _, event := range recorder.filter(net.ProgressChunkDone) {
+		chunks = append(chunks, event.Chunk)
+	}
+	assert.ElementsMatch(t, []int{1, 2}, chunks)
+
+	var finished []net.ProgressEvent
+	for _, event := range recorder.filter(net.ProgressFinished) {
+		if event.Chunk == 0 {
+			finished = append(finished, event)
+		}
+	}
+	if assert.Equal(t, 1, len(finished)) {
+		assert.Equal(t, int64(100), finished[0].Downloaded)
+	}
+}
+
+func TestProgressRenderers(t *testing.T) {
+	start := time.Now()
+	events := []net.ProgressEvent{
+		{Type: net.ProgressStarted, Time: start, URL: "http://foo/bar", Total: 1024},
+		{Type: net.ProgressBytes, Time: start, URL: "http://foo/bar", Total: 1024, Downloaded: 512},
+		{Type: net.ProgressRetry, Time: start, URL: "http://foo/bar", Chunk: 2, Attempt: 1,
+			Wait: time.Second, Error: "bad gateway"},
+		{Type: net.ProgressChunkDone, Time: start, URL: "http://foo/bar", Chunk: 2},
+		{Type: net.ProgressMessage, Time: start, URL: "http://foo/bar", Message: "drop the mirror http://mirror/bar"},
+		{Type: net.ProgressFinished, Time: start.Add(time.Second), URL: "http://foo/bar", Total: 1024, Downloaded: 1024},
+	}
+
+	t.Run("plain", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		renderer := net.NewPlainRenderer(buf)
+		for _, event := range events {
+			renderer.OnProgress(event)
+		}
+		assert.Equal(t, `downloading http://foo/bar (1.0K)
+http://foo/bar: 50% (512B/1.0K)
+http://foo/bar: retry of chunk 2 after 1s, attempt 1 failed: bad gateway
+http://foo/bar: chunk 2 done
+http://foo/bar: drop the mirror http://mirror/bar
+http://foo/bar: finished, 1.0K in 1s
+`, buf.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		renderer := net.NewJSONRenderer(buf)
+		for _, event := range events {
+			renderer.OnProgress(event)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if assert.Equal(t, len(events), len(lines)) {
+			for i, line := range lines {
+				event := net.ProgressEvent{}
+				assert.Nil(t, json.Unmarshal([]byte(line), &event))
+				assert.Equal(t, events[i].Type, event.Type)
+				assert.Equal(t, events[i].Downloaded, event.Downloaded)
+				assert.Equal(t, events[i].Chunk, event.Chunk)
+			}
+		}
+	})
+
+	t.Run("bar without color", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		renderer := net.NewBarRenderer(buf, false)
+		for _, event := range events {
+			renderer.OnProgress(event)
+		}
+		assert.NotEmpty(t, buf.String())
+		assert.NotContains(t, buf.String(), "\033[3")
+	})
+}
+
+func TestBarRenderer(t *testing.T) {
+	start := time.Now()
+	targetURL := "http://foo/bar.tar.gz"
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	buf := &bytes.Buffer{}
+	renderer := net.NewBarRenderer(buf, false)
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressStarted, Time: at(0), URL: targetURL, Total: 4096, Chunks: 2})
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressStarted, Time: at(0), URL: targetURL, Chunk: 1, Total: 2048})
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressStarted, Time: at(0), URL: targetURL, Chunk: 2, Total: 2048})
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressBytes, Time: at(1), URL: targetURL, Total: 4096, Downloaded: 2048})
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressBytes, Time: at(1), URL: targetURL, Chunk: 1, Total: 2048, Downloaded: 1024})
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressRetry, Time: at(1), URL: targetURL, Chunk: 2, Attempt: 1, Error: "EOF"})
+
+	// the aggregate bar has the speed and ETA, the chunks have their own bars
+	assert.True(t, strings.HasSuffix(buf.String(), "\033[3A"+
+		"\r\033[2Kbar.tar.gz [=========>          ]  50% 2.0K/4.0K 2.0K/s ETA 1s\n"+
+		"\r\033[2K  chunk 1 [=========>          ]  50% 1.0K/2.0K\n"+
+		"\r\033[2K  chunk 2 [                    ]   0% 0B/2.0K retry #1: EOF\n"), buf.String())
+
+	// a retried chunk continues its bar, and the finished chunk gives its line back
+	buf.Reset()
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressStarted, Time: at(1), URL: targetURL, Chunk: 2, Total: 2048})
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressBytes, Time: at(2), URL: targetURL, Chunk: 2, Total: 2048, Downloaded: 512})
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressChunkDone, Time: at(2), URL: targetURL, Chunk: 1, Total: 4096, Downloaded: 3584})
+	assert.True(t, strings.HasSuffix(buf.String(), "\033[3A"+
+		"\r\033[2Kbar.tar.gz [================>   ]  87% 3.5K/4.0K 1.8K/s ETA 0s\n"+
+		"\r\033[2K  chunk 2 [====>               ]  25% 512B/2.0K\n"+
+		"\033[2K\n\033[1A"), buf.String())
+
+	// the message takes the first line of the bars, the bars are redrawn below it
+	buf.Reset()
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressMessage, Time: at(2), URL: targetURL, Message: "drop the mirror"})
+	assert.Equal(t, "\033[2A\r\033[Jdrop the mirror\n"+
+		"\r\033[2Kbar.tar.gz [================>   ]  87% 3.5K/4.0K 1.8K/s ETA 0s\n"+
+		"\r\033[2K  chunk 2 [====>               ]  25% 512B/2.0K\n", buf.String())
+
+	// the lines of the chunks are cleared, the region is released once it's finished
+	buf.Reset()
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressFinished, Time: at(2), URL: targetURL, Total: 4096, Downloaded: 4096})
+	assert.Equal(t, "\033[2A\r\033[2Kbar.tar.gz [====================] 4.0K in 2s\n\033[2K\n\033[1A", buf.String())
+
+	buf.Reset()
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressStarted, Time: at(3), URL: "http://foo/", Title: "Downloading"})
+	renderer.OnProgress(net.ProgressEvent{Type: net.ProgressFailed, Time: at(3), URL: "http://foo/", Error: "not found"})
+	assert.Equal(t, "\r\033[2KDownloading 0B\n\033[1A\r\033[2KDownloading failed: not found\n", buf.String())
+}
+
+func TestNewProgressRenderer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.Equal(t, net.ProgressPlain, net.ResolveProgressMode(net.ProgressAuto, buf))
+	assert.Equal(t, net.ProgressPlain, net.ResolveProgressMode("", buf))
+	assert.Equal(t, net.ProgressJSON, net.ResolveProgressMode(net.ProgressJSON, buf))
+
+	observer, err := net.NewProgressRenderer(net.ProgressNone, buf)
+	assert.Nil(t, err)
+	assert.Nil(t, observer)
+
+	for _, mode := range []string{net.ProgressAuto, net.ProgressBar, net.ProgressPlain, net.ProgressJSON} {
+		observer, err = net.NewProgressRenderer(mode, buf)
+		assert.Nil(t, err, mode)
+		assert.NotNil(t, observer, mode)
+	}
+
+	_, err = net.NewProgressRenderer("fake", buf)
+	assert.NotNil(t, err)
+
+	// the function adapter
+	var received net.ProgressEventType
+	net.ProgressObserverFunc(func(event net.ProgressEvent) {
+		received = event.Type
+	}).OnProgress(net.ProgressEvent{Type: net.ProgressFailed, Error: "fake"})
+	assert.Equal(t, net.ProgressFailed, received)
+}
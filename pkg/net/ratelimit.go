@@ -0,0 +1,173 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minRateBurst is the minimum burst size of a RateLimiter, it avoids too many small reads
+const minRateBurst = 4 * 1024
+
+// RateLimiter limits the bandwidth with a token bucket. It's safe to share one limiter
+// between many goroutines, all of them share the same bandwidth.
+type RateLimiter struct {
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	lock   sync.Mutex
+}
+
+// NewRateLimiter creates a limiter with the given bytes per second, returns nil if the rate is not positive
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	burst := float64(bytesPerSecond) / 4
+	if burst < minRateBurst {
+		burst = minRateBurst
+	}
+	return &RateLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Rate returns the bytes per second
+func (l *RateLimiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	return int64(l.rate)
+}
+
+// WaitN blocks until the n bytes are allowed or the context is done. A nil limiter never blocks.
+func (l *RateLimiter) WaitN(ctx context.Context, n int) (err error) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.lock.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	// take the tokens in advance, the following callers need to wait longer
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.lock.Unlock()
+
+	if wait <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+	}
+	return
+}
+
+// NewRateLimitReader returns a reader which is limited by the limiter, returns the reader itself if the limiter is nil
+func NewRateLimitReader(ctx context.Context, reader io.Reader, limiter *RateLimiter) io.Reader {
+	if limiter == nil {
+		return reader
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &rateLimitReader{ctx: ctx, reader: reader, limiter: limiter}
+}
+
+type rateLimitReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *RateLimiter
+}
+
+// Read reads no more than the burst size, then waits for the tokens
+func (r *rateLimitReader) Read(p []byte) (n int, err error) {
+	if burst := int(r.limiter.burst); len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err = r.reader.Read(p)
+	if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return
+}
+
+// ParseRate parses the rate text to bytes per second, for instance: 500K, 1.5M, 2G, 1024.
+// The units are based on 1024, the suffix "B" and "/s" are optional. Zero means no limit.
+func ParseRate(text string) (bytesPerSecond int64, err error) {
+	value := strings.TrimSpace(text)
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "/s"), "/S")
+	if bytesPerSecond, err = ParseSize(value); err != nil {
+		err = fmt.Errorf("invalid rate '%s', it should be like: 500K, 1.5M, 2G", text)
+	}
+	return
+}
+
+// ParseSize parses the size text to bytes, for instance: 500K, 1.5M, 2G, 1024.
+// The units are based on 1024, the suffix "B" is optional.
+func ParseSize(text string) (size int64, err error) {
+	value := strings.ToUpper(strings.TrimSpace(text))
+	value = strings.TrimSuffix(value, "B")
+	value = strings.TrimSuffix(value, "I")
+	if value == "" {
+		return
+	}
+
+	unit := float64(1)
+	switch value[len(value)-1] {
+	case 'K':
+		unit = 1 << 10
+	case 'M':
+		unit = 1 << 20
+	case 'G':
+		unit = 1 << 30
+	case 'T':
+		unit = 1 << 40
+	}
+	if unit > 1 {
+		value = value[:len(value)-1]
+	}
+
+	var number float64
+	if number, err = strconv.ParseFloat(value, 64); err != nil || number < 0 {
+		err = fmt.Errorf("invalid size '%s', it should be like: 500K, 1.5M, 2G", text)
+		return
+	}
+	size = int64(number * unit)
+	return
+}
+
+// FormatSize returns the human-readable size, for instance: 1.5M
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	value := float64(size)
+	units := []string{"K", "M", "G", "T"}
+	var i int
+	for value /= unit; value >= unit && i < len(units)-1; i++ {
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f%s", value, units[i])
+}
@@ -0,0 +1,110 @@
+package net_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		text   string
+		expect int64
+		hasErr bool
+	}{{
+		text: "",
+	}, {
+		text: "0",
+	}, {
+		text:   "1024",
+		expect: 1024,
+	}, {
+		text:   "500K",
+		expect: 500 * 1024,
+	}, {
+		text:   "5m",
+		expect: 5 * 1024 * 1024,
+	}, {
+		text:   "1.5MB",
+		expect: 1536 * 1024,
+	}, {
+		text:   "2GiB/s",
+		expect: 2 * 1024 * 1024 * 1024,
+	}, {
+		text:   "fast",
+		hasErr: true,
+	}, {
+		text:   "-1M",
+		hasErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			rate, err := net.ParseRate(tt.text)
+			assert.Equal(t, tt.hasErr, err != nil, err)
+			assert.Equal(t, tt.expect, rate)
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	assert.Nil(t, net.NewRateLimiter(0))
+	var limiter *net.RateLimiter
+	assert.Nil(t, limiter.WaitN(context.Background(), 1024))
+	assert.Equal(t, int64(0), limiter.Rate())
+
+	// the bandwidth is shared by all the goroutines
+	limiter = net.NewRateLimiter(64 * 1024)
+	assert.Equal(t, int64(64*1024), limiter.Rate())
+	begin := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 4; j++ {
+				assert.Nil(t, limiter.WaitN(context.Background(), 4*1024))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, time.Since(begin), 400*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, limiter.WaitN(ctx, 64*1024), context.Canceled)
+}
+
+func TestDownloadWithRateLimiter(t *testing.T) {
+	content := strings.Repeat("a", 48*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	buf := new(bytes.Buffer)
+	downloader := &net.HTTPDownloader{
+		URL:         server.URL,
+		RateLimiter: net.NewRateLimiter(64 * 1024),
+	}
+	begin := time.Now()
+	assert.Nil(t, downloader.DownloadAsStream(buf))
+	assert.GreaterOrEqual(t, time.Since(begin), 400*time.Millisecond)
+	assert.Equal(t, content, buf.String())
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "0B", net.FormatSize(0))
+	assert.Equal(t, "1023B", net.FormatSize(1023))
+	assert.Equal(t, "1.0K", net.FormatSize(1024))
+	assert.Equal(t, "1.5M", net.FormatSize(1536*1024))
+	assert.Equal(t, "2.0G", net.FormatSize(2*1024*1024*1024))
+	assert.Equal(t, "2048.0T", net.FormatSize(2*1024*1024*1024*1024*1024))
+}
@@ -1,16 +1,27 @@
 package net
 
 import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
-	"strings"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 )
 
 // RetryClient is the wrap of http.Client
 type RetryClient struct {
 	http.Client
-	MaxAttempts     int
-	currentAttempts int
+	// MaxAttempts takes effect only if the Policy is nil
+	MaxAttempts int
+	Policy      *RetryPolicy
 }
 
 // NewRetryClient creates the instance of RetryClient
@@ -21,18 +32,232 @@ func NewRetryClient(client http.Client) *RetryClient {
 	}
 }
 
-// Do is the wrap of http.Client.Do
+// Do is the wrap of http.Client.Do, it retries the request according to the policy
 func (c *RetryClient) Do(req *http.Request) (rsp *http.Response, err error) {
-	rsp, err = c.Client.Do(req)
-	// fmt.Println("client error", err, c.Client.Timeout, reflect.TypeOf(err))
+	policy := c.Policy
+	if policy == nil {
+		policy = DefaultRetryPolicy()
+		policy.MaxAttempts = c.MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		rsp, err = c.Client.Do(req)
+		if attempt > policy.MaxAttempts || !policy.ShouldRetry(req, rsp, err) {
+			return
+		}
+
+		wait := policy.WaitTime(attempt, rsp)
+		if policy.OnRetry != nil {
+			policy.OnRetry(RetryAttempt{
+				Attempt:  attempt,
+				Request:  req,
+				Response: rsp,
+				Err:      err,
+				Wait:     wait,
+			})
+		}
 
-	if _, ok := err.(*url.Error); ok && !strings.Contains(err.Error(), "context canceled") {
-		// fmt.Println("retry", c.currentAttempts, c.MaxAttempts)
-		if c.currentAttempts < c.MaxAttempts {
-			c.currentAttempts++
-			// fmt.Println("try", c.currentAttempts)
-			return c.Do(req)
+		if rsp != nil {
+			// drain the body to reuse the connection
+			_, _ = io.Copy(io.Discard, io.LimitReader(rsp.Body, 4096))
+			_ = rsp.Body.Close()
+		}
+		if req.GetBody != nil {
+			var body io.ReadCloser
+			if body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
 		}
 	}
+}
+
+// RetryAttempt represents an attempt which is going to be retried
+type RetryAttempt struct {
+	// Attempt starts from 1
+	Attempt int
+	// Request is nil when retrying the rest of a chunk
+	Request *http.Request
+	// Response might be nil if there's an error
+	Response *http.Response
+	Err      error
+	// Wait is the duration before the next attempt
+	Wait time.Duration
+}
+
+// RetryPolicy decides whether and when to retry a request
+type RetryPolicy struct {
+	// MaxAttempts is the max times to retry, zero means there's no retry
+	MaxAttempts int
+	// InitialInterval is the interval before the first retry, it grows by the Multiplier
+	InitialInterval time.Duration
+	// MaxInterval is the upper limit of the interval
+	MaxInterval time.Duration
+	Multiplier  float64
+	// Jitter is the randomization factor of the interval, it should be between 0 and 1
+	Jitter float64
+	// RetryStatusCodes are the HTTP status codes which are worth to retry
+	RetryStatusCodes []int
+	// OnRetry will be called before each retry
+	OnRetry func(RetryAttempt)
+}
+
+// maxRetryAfter is the upper limit of the Retry-After header
+const maxRetryAfter = 10 * time.Minute
+
+// DefaultRetryStatusCodes are the HTTP status codes which are retried by default
+var DefaultRetryStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultRetryPolicy returns a policy with exponential backoff
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:      3,
+		InitialInterval:  time.Second,
+		MaxInterval:      30 * time.Second,
+		Multiplier:       2,
+		Jitter:           0.2,
+		RetryStatusCodes: DefaultRetryStatusCodes,
+	}
+}
+
+// WithoutRetry returns a copy of the policy which does not retry
+func (p *RetryPolicy) WithoutRetry() *RetryPolicy {
+	policy := *p
+	policy.MaxAttempts = 0
+	return &policy
+}
+
+// ShouldRetry checks if the request is worth to retry according to the response or error
+func (p *RetryPolicy) ShouldRetry(req *http.Request, rsp *http.Response, err error) bool {
+	if req.Context().Err() != nil || !isIdempotent(req) {
+		return false
+	}
+
+	if err != nil {
+		return p.IsRetryableError(err)
+	}
+	return rsp != nil && p.isRetryableStatus(rsp.StatusCode)
+}
+
+// IsRetryableError checks if the error is worth to retry, the client errors are not retryable
+func (p *RetryPolicy) IsRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return p.isRetryableStatus(downloadErr.StatusCode)
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// the error of sending a request is retryable only if it's a network error,
+		// it's not worth to retry in case of an invalid URL or certificate
+		var netErr net.Error
+		return errors.As(urlErr.Err, &netErr) || errors.Is(urlErr.Err, io.EOF) ||
+			errors.Is(urlErr.Err, io.ErrUnexpectedEOF)
+	}
+
+	// it's not worth to retry if failed to write the file, for instance: no space left or permission denied
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return false
+	}
+	// the errors of reading the response body
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ETIMEDOUT)
+}
+
+func (p *RetryPolicy) isRetryableStatus(code int) bool {
+	for _, item := range p.RetryStatusCodes {
+		if item == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns the interval before the given attempt which starts from 1
+func (p *RetryPolicy) Backoff(attempt int) (interval time.Duration) {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	interval = time.Duration(float64(p.InitialInterval) * math.Pow(multiplier, float64(attempt-1)))
+	if p.MaxInterval > 0 && (interval > p.MaxInterval || interval < 0) {
+		interval = p.MaxInterval
+	}
+
+	if p.Jitter > 0 {
+		delta := p.Jitter * float64(interval)
+		interval = time.Duration(float64(interval) - delta + 2*delta*randomFloat())
+	}
+	return
+}
+
+// WaitTime returns the interval before the next attempt, it takes the Retry-After header first
+func (p *RetryPolicy) WaitTime(attempt int, rsp *http.Response) time.Duration {
+	if rsp != nil {
+		if wait, ok := parseRetryAfter(rsp.Header.Get("Retry-After")); ok {
+			return wait
+		}
+	}
+	return p.Backoff(attempt)
+}
+
+// parseRetryAfter parses the Retry-After header which could be seconds or an HTTP date
+func parseRetryAfter(value string) (wait time.Duration, ok bool) {
+	if value == "" {
+		return
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		wait, ok = time.Duration(seconds)*time.Second, true
+	} else if date, err := http.ParseTime(value); err == nil {
+		if wait = time.Until(date); wait < 0 {
+			wait = 0
+		}
+		ok = true
+	}
+
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
 	return
 }
+
+// isIdempotent checks if the request could be sent again safely
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+var (
+	random     = rand.New(rand.NewSource(time.Now().UnixNano()))
+	randomLock sync.Mutex
+)
+
+func randomFloat() float64 {
+	randomLock.Lock()
+	defer randomLock.Unlock()
+	return random.Float64()
+}
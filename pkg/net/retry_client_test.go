@@ -2,11 +2,21 @@ package net
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
 	"reflect"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/linuxsuren/http-downloader/mock/mhttp"
@@ -43,3 +53,167 @@ func TestRetry(t *testing.T) {
 	assert.NotNil(t, response)
 	assert.Equal(t, http.StatusOK, response.StatusCode)
 }
+
+func TestRetryWithPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		failures       int32
+		status         int
+		maxAttempts    int
+		expectStatus   int
+		expectRequests int32
+	}{{
+		name:           "retry on the service unavailable",
+		method:         http.MethodGet,
+		failures:       2,
+		status:         http.StatusServiceUnavailable,
+		maxAttempts:    3,
+		expectStatus:   http.StatusOK,
+		expectRequests: 3,
+	}, {
+		name:           "running out of the attempts",
+		method:         http.MethodGet,
+		failures:       5,
+		status:         http.StatusTooManyRequests,
+		maxAttempts:    2,
+		expectStatus:   http.StatusTooManyRequests,
+		expectRequests: 3,
+	}, {
+		name:           "client error is not retryable",
+		method:         http.MethodGet,
+		failures:       5,
+		status:         http.StatusNotFound,
+		maxAttempts:    3,
+		expectStatus:   http.StatusNotFound,
+		expectRequests: 1,
+	}, {
+		name:           "POST is not idempotent",
+		method:         http.MethodPost,
+		failures:       5,
+		status:         http.StatusBadGateway,
+		maxAttempts:    3,
+		expectStatus:   http.StatusBadGateway,
+		expectRequests: 1,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= tt.failures {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(tt.status)
+					return
+				}
+				_, _ = w.Write([]byte("ok"))
+			}))
+			defer server.Close()
+
+			var attempts int
+			policy := DefaultRetryPolicy()
+			policy.MaxAttempts = tt.maxAttempts
+			policy.OnRetry = func(attempt RetryAttempt) {
+				attempts++
+				assert.Equal(t, attempts, attempt.Attempt)
+				assert.Equal(t, time.Duration(0), attempt.Wait)
+				assert.Equal(t, tt.status, attempt.Response.StatusCode)
+			}
+			client := &RetryClient{Policy: policy}
+
+			request, _ := http.NewRequest(tt.method, server.URL, nil)
+			response, err := client.Do(request)
+			assert.Nil(t, err)
+			if assert.NotNil(t, response) {
+				assert.Equal(t, tt.expectStatus, response.StatusCode)
+				_ = response.Body.Close()
+			}
+			assert.Equal(t, tt.expectRequests, atomic.LoadInt32(&requests))
+			assert.Equal(t, int(tt.expectRequests)-1, attempts)
+		})
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := DefaultRetryPolicy()
+	policy.InitialInterval = time.Hour
+	policy.OnRetry = func(RetryAttempt) {
+		cancel()
+	}
+	client := &RetryClient{Policy: policy}
+
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	_, err := client.Do(request)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestIsRetryableError(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	assert.False(t, policy.IsRetryableError(context.Canceled))
+	assert.False(t, policy.IsRetryableError(fmt.Errorf("wrapped: %w", &DownloadError{StatusCode: http.StatusForbidden})))
+	assert.True(t, policy.IsRetryableError(&DownloadError{StatusCode: http.StatusBadGateway}))
+	assert.True(t, policy.IsRetryableError(&url.Error{Op: "Get", URL: fakeURL, Err: io.ErrUnexpectedEOF}))
+	assert.True(t, policy.IsRetryableError(&url.Error{Op: "Get", URL: fakeURL, Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}))
+	assert.False(t, policy.IsRetryableError(&url.Error{Op: "Get", URL: fakeURL, Err: errors.New("unsupported protocol scheme")}))
+	assert.True(t, policy.IsRetryableError(io.ErrUnexpectedEOF))
+
+	// the errors of reading the response body
+	assert.True(t, policy.IsRetryableError(fmt.Errorf("failed to read: %w", &net.OpError{Op: "read", Err: syscall.ECONNRESET})))
+	assert.True(t, policy.IsRetryableError(fmt.Errorf("failed to read: %w", syscall.ECONNRESET)))
+	assert.False(t, policy.IsRetryableError(errors.New("unknown")))
+
+	// the errors of writing the file
+	assert.False(t, policy.IsRetryableError(&os.PathError{Op: "write", Path: "target", Err: syscall.ENOSPC}))
+	assert.False(t, policy.IsRetryableError(fmt.Errorf("failed: %w", &fs.PathError{Op: "open", Path: "target", Err: syscall.EACCES})))
+	assert.False(t, policy.IsRetryableError(&os.PathError{Op: "open", Path: "target", Err: syscall.EROFS}))
+}
+
+func TestBackoff(t *testing.T) {
+	policy := &RetryPolicy{
+		InitialInterval: time.Second,
+		MaxInterval:     5 * time.Second,
+		Multiplier:      2,
+	}
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 4*time.Second, policy.Backoff(3))
+	assert.Equal(t, 5*time.Second, policy.Backoff(4))
+	assert.Equal(t, 5*time.Second, policy.Backoff(100))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		interval := policy.Backoff(2)
+		assert.GreaterOrEqual(t, interval, time.Second)
+		assert.LessOrEqual(t, interval, 3*time.Second)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	wait, ok := parseRetryAfter("")
+	assert.False(t, ok)
+	assert.Equal(t, time.Duration(0), wait)
+
+	wait, ok = parseRetryAfter("120")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, wait)
+
+	wait, ok = parseRetryAfter("99999")
+	assert.True(t, ok)
+	assert.Equal(t, maxRetryAfter, wait)
+
+	wait, ok = parseRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), wait)
+
+	wait, ok = parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.True(t, wait > 50*time.Second && wait <= time.Minute, wait)
+
+	_, ok = parseRetryAfter("invalid")
+	assert.False(t, ok)
+}
@@ -0,0 +1,221 @@
+package net
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/linuxsuren/http-downloader/pkg/common"
+	"github.com/mitchellh/go-homedir"
+)
+
+// s3SchemePrefix is the prefix of the S3 objects, for instance: s3://bucket/key
+const s3SchemePrefix = "s3://"
+
+// S3Object is an object of a bucket
+type S3Object struct {
+	Bucket string
+	Key    string
+}
+
+// S3Config is the configuration of the S3-compatible storage
+type S3Config struct {
+	Region string
+	// Endpoint is the URL of the S3-compatible storage, for instance: http://minio.foo.com:9000.
+	// It's the virtual-hosted-style URL of AWS if it's empty.
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// IsS3URL returns true if it's an s3:// URL
+func IsS3URL(text string) bool {
+	return strings.HasPrefix(text, s3SchemePrefix)
+}
+
+// ParseS3URL parses the URL like s3://bucket/key
+func ParseS3URL(text string) (object *S3Object, err error) {
+	if !IsS3URL(text) {
+		err = fmt.Errorf("invalid S3 URL '%s', it should be like s3://bucket/key", text)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(text, s3SchemePrefix), "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		err = fmt.Errorf("invalid S3 URL '%s', it should be like s3://bucket/key", text)
+		return
+	}
+	object = &S3Object{Bucket: bucket, Key: key}
+	return
+}
+
+// DefaultAWSCredentialsFile returns the path of the AWS shared credentials file, it could be changed
+// by the environment variable AWS_SHARED_CREDENTIALS_FILE
+func DefaultAWSCredentialsFile() string {
+	return defaultAWSFile("AWS_SHARED_CREDENTIALS_FILE", "credentials")
+}
+
+// DefaultAWSConfigFile returns the path of the AWS shared config file, it could be changed by the
+// environment variable AWS_CONFIG_FILE
+func DefaultAWSConfigFile() string {
+	return defaultAWSFile("AWS_CONFIG_FILE", "config")
+}
+
+func defaultAWSFile(env, name string) string {
+	if filePath := common.GetEnvironment(env); filePath != "" {
+		return filePath
+	}
+
+	userHome, err := homedir.Dir()
+	if err != nil {
+		userHome = os.TempDir()
+	}
+	return filepath.Join(userHome, ".aws", name)
+}
+
+// LoadS3Config loads the config of the profile from the environment variables and the AWS shared files,
+// the missing files are ignored. The profile is AWS_PROFILE or default if it's empty. The environment
+// variables take precedence over the credentials file, and the credentials file takes precedence over
+// the config file.
+func LoadS3Config(profile, credentialsFilePath, configFilePath string) (config *S3Config, err error) {
+	if profile == "" {
+		if profile = common.GetEnvironment("AWS_PROFILE"); profile == "" {
+			profile = "default"
+		}
+	}
+	configSection := "profile " + profile
+	if profile == "default" {
+		configSection = profile
+	}
+
+	var credentials, settings map[string]string
+	if credentials, err = loadAWSSection(credentialsFilePath, profile); err != nil {
+		return
+	}
+	if settings, err = loadAWSSection(configFilePath, configSection); err != nil {
+		return
+	}
+	lookup := func(key string) string {
+		if value := credentials[key]; value != "" {
+			return value
+		}
+		return settings[key]
+	}
+
+	config = &S3Config{
+		Region:   common.GetEnvironment("AWS_REGION", "AWS_DEFAULT_REGION"),
+		Endpoint: common.GetEnvironment("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+	}
+	if config.Region == "" {
+		config.Region = lookup("region")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = lookup("endpoint_url")
+	}
+
+	// the access key and the secret key should come from the same place
+	if accessKeyID, secretAccessKey := common.GetEnvironment("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY"),
+		common.GetEnvironment("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY"); accessKeyID != "" && secretAccessKey != "" {
+		config.AccessKeyID, config.SecretAccessKey = accessKeyID, secretAccessKey
+		config.SessionToken = common.GetEnvironment("AWS_SESSION_TOKEN")
+	} else if credentials["aws_access_key_id"] != "" {
+		config.AccessKeyID, config.SecretAccessKey = credentials["aws_access_key_id"], credentials["aws_secret_access_key"]
+		config.SessionToken = credentials["aws_session_token"]
+	} else {
+		config.AccessKeyID, config.SecretAccessKey = settings["aws_access_key_id"], settings["aws_secret_access_key"]
+		config.SessionToken = settings["aws_session_token"]
+	}
+	return
+}
+
+// loadAWSSection returns the keys of a section of the INI file, it's empty if the file does not exist
+func loadAWSSection(filePath, section string) (values map[string]string, err error) {
+	values = map[string]string{}
+	var f *os.File
+	if f, err = os.Open(filePath); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var current string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			current = strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+		case current == section:
+			// the nested settings, for instance: s3 = \n  addressing_style = path, are not supported
+			if key, value, ok := strings.Cut(line, "="); ok {
+				values[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		err = fmt.Errorf("failed to parse the AWS file '%s', error: %v", filePath, err)
+	}
+	return
+}
+
+// ObjectURL returns the URL of the object. It's the path-style URL if there's an endpoint or the bucket
+// has dots, otherwise it's the virtual-hosted-style URL of AWS.
+func (c *S3Config) ObjectURL(object *S3Object) (objectURL string, err error) {
+	region := c.Region
+	if region == "" {
+		region = awsDefaultRegion
+	}
+
+	var endpoint *url.URL
+	if c.Endpoint != "" {
+		endpointText := c.Endpoint
+		if !strings.Contains(endpointText, "://") {
+			endpointText = "https://" + endpointText
+		}
+		if endpoint, err = url.Parse(endpointText); err != nil || endpoint.Host == "" {
+			err = fmt.Errorf("invalid S3 endpoint '%s'", c.Endpoint)
+			return
+		}
+		endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + object.Bucket + "/" + object.Key
+	} else if strings.Contains(object.Bucket, ".") {
+		endpoint = &url.URL{Scheme: "https", Host: fmt.Sprintf("s3.%s.amazonaws.com", region),
+			Path: "/" + object.Bucket + "/" + object.Key}
+	} else {
+		endpoint = &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", object.Bucket, region),
+			Path: "/" + object.Key}
+	}
+	objectURL = endpoint.String()
+	return
+}
+
+// Credential returns the credential which signs the requests of the object URL, it's nil if there's
+// no access key, then the public objects are still accessible
+func (c *S3Config) Credential(objectURL string) *Credential {
+	u, err := url.Parse(objectURL)
+	if err != nil || c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return nil
+	}
+
+	region := c.Region
+	if region == "" {
+		region = awsDefaultRegion
+	}
+	return &Credential{
+		Host:     u.Host,
+		Type:     CredentialAWSSigV4,
+		Username: c.AccessKeyID,
+		Password: c.SecretAccessKey,
+		Token:    c.SessionToken,
+		Region:   region,
+		Service:  awsDefaultService,
+	}
+}
@@ -0,0 +1,135 @@
+package net_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+// clearAWSEnv makes sure the environment variables of the host do not affect the tests
+func clearAWSEnv(t *testing.T) {
+	for _, env := range []string{"AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ENDPOINT_URL_S3",
+		"AWS_ENDPOINT_URL", "AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY",
+		"AWS_SESSION_TOKEN"} {
+		t.Setenv(env, "")
+	}
+}
+
+func TestParseS3URL(t *testing.T) {
+	object, err := net.ParseS3URL("s3://bucket/dir/foo.tar.gz")
+	assert.Nil(t, err)
+	assert.Equal(t, &net.S3Object{Bucket: "bucket", Key: "dir/foo.tar.gz"}, object)
+
+	for _, text := range []string{"https://bucket/foo", "s3://bucket", "s3://bucket/", "s3:///foo", "s3://bucket/dir/"} {
+		_, err = net.ParseS3URL(text)
+		assert.NotNil(t, err, text)
+	}
+}
+
+func TestLoadS3Config(t *testing.T) {
+	clearAWSEnv(t)
+	dir := t.TempDir()
+	credentialsFile := path.Join(dir, "credentials")
+	configFile := path.Join(dir, "config")
+	assert.Nil(t, os.WriteFile(credentialsFile, []byte(`[default]
+aws_access_key_id = default-key
+aws_secret_access_key = default-secret
+
+[minio]
+aws_access_key_id=minio-key
+aws_secret_access_key=minio-secret
+`), 0600))
+	assert.Nil(t, os.WriteFile(configFile, []byte(`# comment
+[default]
+region = eu-west-1
+
+[profile minio]
+region = us-east-1
+endpoint_url = http://localhost:9000
+`), 0600))
+
+	config, err := net.LoadS3Config("", credentialsFile, configFile)
+	assert.Nil(t, err)
+	assert.Equal(t, &net.S3Config{Region: "eu-west-1", AccessKeyID: "default-key", SecretAccessKey: "default-secret"}, config)
+
+	t.Setenv("AWS_PROFILE", "minio")
+	config, err = net.LoadS3Config("", credentialsFile, configFile)
+	assert.Nil(t, err)
+	assert.Equal(t, &net.S3Config{Region: "us-east-1", Endpoint: "http://localhost:9000",
+		AccessKeyID: "minio-key", SecretAccessKey: "minio-secret"}, config)
+
+	// the environment variables take precedence
+	t.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	t.Setenv("AWS_SESSION_TOKEN", "env-token")
+	t.Setenv("AWS_REGION", "ap-east-1")
+	config, err = net.LoadS3Config("default", credentialsFile, path.Join(dir, "missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, &net.S3Config{Region: "ap-east-1", AccessKeyID: "env-key", SecretAccessKey: "env-secret",
+		SessionToken: "env-token"}, config)
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	object := &net.S3Object{Bucket: "bucket", Key: "dir/foo bar.tar.gz"}
+
+	objectURL, err := (&net.S3Config{}).ObjectURL(object)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://bucket.s3.us-east-1.amazonaws.com/dir/foo%20bar.tar.gz", objectURL)
+
+	objectURL, err = (&net.S3Config{Region: "eu-west-1"}).ObjectURL(&net.S3Object{Bucket: "foo.com", Key: "bar"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://s3.eu-west-1.amazonaws.com/foo.com/bar", objectURL)
+
+	objectURL, err = (&net.S3Config{Endpoint: "http://localhost:9000/"}).ObjectURL(object)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:9000/bucket/dir/foo%20bar.tar.gz", objectURL)
+
+	objectURL, err = (&net.S3Config{Endpoint: "minio.foo.com"}).ObjectURL(object)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://minio.foo.com/bucket/dir/foo%20bar.tar.gz", objectURL)
+
+	_, err = (&net.S3Config{Endpoint: "http://"}).ObjectURL(object)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, (&net.S3Config{}).Credential(objectURL))
+	assert.Equal(t, &net.Credential{Host: "minio.foo.com", Type: net.CredentialAWSSigV4, Username: "key",
+		Password: "secret", Region: "us-east-1", Service: "s3"},
+		(&net.S3Config{AccessKeyID: "key", SecretAccessKey: "secret"}).Credential(objectURL))
+}
+
+func TestDownloadS3Object(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=key/") || r.Header.Get("X-Amz-Date") == "" ||
+			(r.Header.Get("Range") != "" && !strings.Contains(auth, "SignedHeaders=host;range;")) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	config := &net.S3Config{Endpoint: server.URL, AccessKeyID: "key", SecretAccessKey: "secret"}
+	objectURL, err := config.ObjectURL(&net.S3Object{Bucket: "bucket", Key: "foo.tar.gz"})
+	assert.Nil(t, err)
+
+	buf := &bytes.Buffer{}
+	downloader := &net.MultiThreadDownloader{}
+	downloader.WithCredentials(&net.CredentialStore{Credentials: []*net.Credential{config.Credential(objectURL)}})
+	assert.Nil(t, downloader.DownloadWithContext(context.Background(), objectURL, buf, 4))
+	assert.Equal(t, content, buf.String())
+
+	// it's forbidden without the credential
+	downloader.WithCredentials(nil)
+	assert.NotNil(t, downloader.DownloadWithContext(context.Background(), objectURL, &bytes.Buffer{}, 4))
+}
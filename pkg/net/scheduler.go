@@ -0,0 +1,138 @@
+package net
+
+import (
+	"time"
+)
+
+var (
+	// minChunkSize is the minimum size of a chunk, a range smaller than twice of it won't be split
+	minChunkSize int64 = 256 * 1024
+	// chunksPerThread is the number of chunks for each thread when splitting the file
+	chunksPerThread = 4
+)
+
+// chunkScheduler hands out the chunks to a pool of workers. Once there's no pending chunk,
+// an idle worker splits the largest remaining range of the slowest worker.
+type chunkScheduler struct {
+	state   *downloadState
+	pending []*chunkState
+	active  map[*chunkState]*chunkProgress
+}
+
+// chunkProgress is used to measure the speed of a chunk
+type chunkProgress struct {
+	startTime      time.Time
+	startCompleted int64
+}
+
+func newChunkScheduler(state *downloadState) *chunkScheduler {
+	scheduler := &chunkScheduler{
+		state:  state,
+		active: map[*chunkState]*chunkProgress{},
+	}
+	for _, chunk := range state.Chunks {
+		if !chunk.finished() {
+			scheduler.pending = append(scheduler.pending, chunk)
+		}
+	}
+	return scheduler
+}
+
+// next returns a chunk to download, returns nil if there's nothing left to do
+func (s *chunkScheduler) next() (chunk *chunkState) {
+	s.state.lock.Lock()
+	defer s.state.lock.Unlock()
+
+	if len(s.pending) > 0 {
+		chunk = s.pending[0]
+		s.pending = s.pending[1:]
+	} else {
+		chunk = s.steal()
+	}
+
+	if chunk != nil {
+		s.active[chunk] = &chunkProgress{
+			startTime:      time.Now(),
+			startCompleted: chunk.Completed,
+		}
+	}
+	return
+}
+
+// steal splits the active chunk which is expected to be the last one to finish
+func (s *chunkScheduler) steal() (chunk *chunkState) {
+	var victim *chunkState
+	var victimCost float64
+	now := time.Now()
+	for item, progress := range s.active {
+		remain := item.size() - item.Completed
+		if remain < 2*minChunkSize {
+			continue
+		}
+
+		// the estimated time to finish, treat the chunk without progress as the slowest one
+		cost := float64(remain) * float64(time.Hour)
+		if downloaded := item.Completed - progress.startCompleted; downloaded > 0 {
+			cost = float64(remain) * float64(now.Sub(progress.startTime)) / float64(downloaded)
+		}
+
+		if victim == nil || cost > victimCost {
+			victim, victimCost = item, cost
+		}
+	}
+
+	if victim != nil {
+		remain := victim.size() - victim.Completed
+		mid := victim.Start + victim.Completed + remain/2
+		chunk = &chunkState{
+			Start: mid,
+			End:   victim.End,
+		}
+		victim.End = mid - 1
+		s.state.Chunks = append(s.state.Chunks, chunk)
+	}
+	return
+}
+
+// done marks the chunk is not in progress
+func (s *chunkScheduler) done(chunk *chunkState) {
+	s.state.lock.Lock()
+	defer s.state.lock.Unlock()
+	delete(s.active, chunk)
+}
+
+// splitChunks splits the file into many chunks, the number of chunks depends on the thread
+func splitChunks(total int64, thread int) (chunks []*chunkState) {
+	count := int64(thread * chunksPerThread)
+	if count <= 0 {
+		count = 1
+	}
+	if maxCount := total / minChunkSize; count > maxCount {
+		count = maxCount
+	}
+	if count < int64(thread) {
+		// still keep one chunk for each thread for a small file
+		count = int64(thread)
+	}
+	if count > total {
+		count = total
+	}
+	if count <= 0 {
+		count = 1
+	}
+
+	unit := total / count
+	offset := total - unit*count
+	for i := int64(0); i < count; i++ {
+		end := unit*(i+1) - 1
+		if i == count-1 {
+			// this is the last part
+			end += offset
+		}
+		chunks = append(chunks, &chunkState{
+			Start: unit * i,
+			End:   end,
+		})
+	}
+	return
+}
@@ -0,0 +1,107 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitChunks(t *testing.T) {
+	defer func(size int64) {
+		minChunkSize = size
+	}(minChunkSize)
+	minChunkSize = 10
+
+	// split into many chunks
+	chunks := splitChunks(100, 2)
+	assert.Equal(t, 8, len(chunks))
+	assert.Equal(t, int64(0), chunks[0].Start)
+	assert.Equal(t, int64(99), chunks[7].End)
+	for i := 1; i < len(chunks); i++ {
+		assert.Equal(t, chunks[i-1].End+1, chunks[i].Start)
+	}
+
+	// limited by the minimum chunk size
+	assert.Equal(t, 5, len(splitChunks(50, 4)))
+	// one chunk for each thread at least
+	assert.Equal(t, 3, len(splitChunks(15, 3)))
+	// cannot be more than the total size
+	assert.Equal(t, 2, len(splitChunks(2, 3)))
+	assert.Equal(t, 1, len(splitChunks(0, 3)))
+}
+
+func TestChunkScheduler(t *testing.T) {
+	defer func(size int64) {
+		minChunkSize = size
+	}(minChunkSize)
+	minChunkSize = 5
+
+	state := &downloadState{
+		Total: 100,
+		Chunks: []*chunkState{
+			{Start: 0, End: 39, Completed: 40},
+			{Start: 40, End: 59},
+			{Start: 60, End: 99},
+		},
+	}
+	scheduler := newChunkScheduler(state)
+
+	// the finished chunk will be skipped
+	first := scheduler.next()
+	assert.Equal(t, state.Chunks[1], first)
+	second := scheduler.next()
+	assert.Equal(t, state.Chunks[2], second)
+
+	// the second chunk is faster than the first one
+	scheduler.active[first].startTime = time.Now().Add(-time.Second)
+	scheduler.active[second].startTime = time.Now().Add(-time.Second)
+	state.addCompleted(first, 2)
+	state.addCompleted(second, 20)
+
+	// steal the rest of the slowest one
+	stolen := scheduler.next()
+	if assert.NotNil(t, stolen) {
+		assert.Equal(t, &chunkState{Start: 51, End: 59}, stolen)
+		assert.Equal(t, int64(50), first.End)
+		assert.Equal(t, 4, len(state.Chunks))
+	}
+
+	// all the ranges are too small to split
+	minChunkSize = 50
+	assert.Nil(t, scheduler.next())
+
+	scheduler.done(first)
+	scheduler.done(second)
+	scheduler.done(stolen)
+	assert.Empty(t, scheduler.active)
+}
+
+func TestDownloadWithWorkStealing(t *testing.T) {
+	defer func(size int64) {
+		minChunkSize = size
+	}(minChunkSize)
+	minChunkSize = 8
+
+	content := strings.Repeat("0123456789", 50)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") {
+			// the first chunk is very slow
+			time.Sleep(100 * time.Millisecond)
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	downloader := &MultiThreadDownloader{}
+	downloader.WithShowProgress(false)
+	buf := new(bytes.Buffer)
+	err := downloader.DownloadWithContext(context.Background(), server.URL, buf, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, content, buf.String())
+}
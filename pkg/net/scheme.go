@@ -0,0 +1,276 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SchemeHandler downloads the resources of a URL scheme except http and https, they're
+// handled by HTTPDownloader. See also RegisterSchemeHandler.
+type SchemeHandler interface {
+	// Probe returns the size of the resource, -1 means it's unknown. The rangeSupport means
+	// it's able to read the resource from an offset, so the download could be resumed.
+	Probe(ctx context.Context, resource *url.URL) (size int64, rangeSupport bool, err error)
+	// Open returns the reader of the resource which starts from the offset
+	Open(ctx context.Context, resource *url.URL, offset int64) (io.ReadCloser, error)
+}
+
+// temporary is implemented by the errors which are worth to retry
+type temporary interface {
+	Temporary() bool
+}
+
+var schemeHandlers = struct {
+	sync.RWMutex
+	handlers map[string]SchemeHandler
+}{handlers: map[string]SchemeHandler{
+	"file": &FileHandler{},
+	"ftp":  &FTPHandler{},
+}}
+
+// RegisterSchemeHandler registers the handler of a URL scheme, the existing one will be replaced.
+// The http and https schemes could not be registered.
+func RegisterSchemeHandler(scheme string, handler SchemeHandler) (err error) {
+	scheme = strings.ToLower(scheme)
+	switch {
+	case scheme == "":
+		err = errors.New("the scheme cannot be empty")
+	case scheme == "http" || scheme == "https":
+		err = fmt.Errorf("the scheme %s is handled by the HTTP downloaders", scheme)
+	case handler == nil:
+		err = fmt.Errorf("the handler of the scheme %s cannot be nil", scheme)
+	default:
+		schemeHandlers.Lock()
+		schemeHandlers.handlers[scheme] = handler
+		schemeHandlers.Unlock()
+	}
+	return
+}
+
+// GetSchemeHandler returns the registered handler of the URL's scheme, it's nil if there's no handler
+func GetSchemeHandler(targetURL string) SchemeHandler {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return nil
+	}
+
+	schemeHandlers.RLock()
+	defer schemeHandlers.RUnlock()
+	return schemeHandlers.handlers[strings.ToLower(u.Scheme)]
+}
+
+// IsSupportedURL returns true if the URL is http, https or one of the registered schemes
+func IsSupportedURL(targetURL string) bool {
+	return strings.HasPrefix(targetURL, "http://") || strings.HasPrefix(targetURL, "https://") ||
+		GetSchemeHandler(targetURL) != nil
+}
+
+// SchemeDownloader downloads the resources by the registered scheme handlers. The failed
+// transfer continues from where it stopped if the handler supports the range.
+type SchemeDownloader struct {
+	Context context.Context
+	Title   string
+	// Observer receives the progress events
+	Observer ProgressObserver
+	// RetryPolicy decides how to retry the failed transfer, the default policy is used if it's nil
+	RetryPolicy *RetryPolicy
+	// RateLimiter limits the bandwidth, it could be shared with other downloaders
+	RateLimiter *RateLimiter
+}
+
+// DownloadFile downloads the resource into the file. It continues from the offset if it's not
+// negative, the data after the offset in the existing file will be dropped.
+func (d *SchemeDownloader) DownloadFile(targetURL, targetFilePath string, continueAt int64) (err error) {
+	var f *os.File
+	if f, err = openFileAt(targetFilePath, continueAt); err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	err = d.DownloadAsStream(targetURL, f, continueAt)
+	return
+}
+
+// DownloadAsStream writes the resource into the writer, it starts from the offset if it's positive
+func (d *SchemeDownloader) DownloadAsStream(targetURL string, writer io.Writer, continueAt int64) (err error) {
+	if d.Title == "" {
+		d.Title = "Downloading"
+	}
+	reporter := newProgressReporter(d.Observer, targetURL, d.Title, 0)
+	defer func() {
+		err = checkCanceled(d.Context, err)
+		reporter.finish(err)
+	}()
+
+	var resource *url.URL
+	if resource, err = url.Parse(targetURL); err != nil {
+		return
+	}
+	handler := GetSchemeHandler(targetURL)
+	if handler == nil {
+		err = fmt.Errorf("not support the scheme of %s", targetURL)
+		return
+	}
+
+	ctx := d.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	policy := d.RetryPolicy
+	if policy == nil {
+		policy = DefaultRetryPolicy()
+	}
+
+	var size int64
+	var rangeSupport bool
+	if size, rangeSupport, err = handler.Probe(ctx, resource); err != nil {
+		err = fmt.Errorf("cannot download from %s, error: %w", targetURL, err)
+		return
+	}
+	offset := continueAt
+	if offset < 0 {
+		offset = 0
+	} else if offset > 0 && !rangeSupport {
+		err = fmt.Errorf("cannot continue at %d, %s does not support the range", offset, targetURL)
+		return
+	}
+	if size >= 0 {
+		size -= offset
+	}
+	reporter.start(size, 0, 0)
+
+	var written int64
+	for attempt := 1; ; attempt++ {
+		var n int64
+		if n, err = d.transfer(ctx, handler, resource, offset+written, writer, reporter); err == nil {
+			break
+		}
+		written += n
+
+		// the rest could be downloaded only if the handler supports the range
+		if (n > 0 && !rangeSupport) || attempt > policy.MaxAttempts || !isTransientError(err) {
+			err = fmt.Errorf("cannot download from %s, error: %w", targetURL, err)
+			break
+		}
+
+		wait := policy.Backoff(attempt)
+		retryAttempt := RetryAttempt{Attempt: attempt, Err: err, Wait: wait}
+		if policy.OnRetry != nil {
+			policy.OnRetry(retryAttempt)
+		}
+		reporter.retry(0, retryAttempt)
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-time.After(wait):
+		}
+	}
+	return
+}
+
+// transfer copies the resource from the offset into the writer
+func (d *SchemeDownloader) transfer(ctx context.Context, handler SchemeHandler, resource *url.URL, offset int64,
+	writer io.Writer, reporter *progressReporter) (n int64, err error) {
+	var reader io.ReadCloser
+	if reader, err = handler.Open(ctx, resource, offset); err != nil {
+		return
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	n, err = io.Copy(&progressWriter{writer: writer, reporter: reporter}, NewRateLimitReader(ctx, reader, d.RateLimiter))
+	return
+}
+
+// isTransientError returns true if it's a network error, or the error says it's temporary
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var tempErr temporary
+	if errors.As(err, &tempErr) {
+		return tempErr.Temporary()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// FileHandler reads the local files of the file:// URLs, for instance: file:///tmp/foo.tar.gz
+type FileHandler struct{}
+
+// Probe returns the size of the file
+func (h *FileHandler) Probe(_ context.Context, resource *url.URL) (size int64, rangeSupport bool, err error) {
+	var filePath string
+	if filePath, err = localPath(resource); err != nil {
+		return
+	}
+
+	var info os.FileInfo
+	if info, err = os.Stat(filePath); err == nil {
+		if info.IsDir() {
+			err = fmt.Errorf("%s is a directory", filePath)
+		} else {
+			size, rangeSupport = info.Size(), true
+		}
+	}
+	return
+}
+
+// Open opens the file, and seeks to the offset
+func (h *FileHandler) Open(_ context.Context, resource *url.URL, offset int64) (reader io.ReadCloser, err error) {
+	var filePath string
+	if filePath, err = localPath(resource); err != nil {
+		return
+	}
+
+	var f *os.File
+	if f, err = os.Open(filePath); err != nil {
+		return
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return
+	}
+	reader = f
+	return
+}
+
+// localPath returns the file path of a file:// URL, the host must be empty or localhost
+func localPath(resource *url.URL) (filePath string, err error) {
+	if resource.Host != "" && resource.Host != "localhost" {
+		err = fmt.Errorf("the host of %s should be empty or localhost", resource.String())
+		return
+	}
+
+	filePath = resource.Path
+	if filePath == "" {
+		// the opaque URL, for instance: file:foo.tar.gz
+		filePath = resource.Opaque
+	}
+	// the path of Windows looks like: /C:/foo.tar.gz
+	if len(filePath) > 2 && filePath[0] == '/' && filePath[2] == ':' {
+		filePath = filePath[1:]
+	}
+	if filePath == "" {
+		err = fmt.Errorf("no file path in %s", resource.String())
+	}
+	filePath = filepath.FromSlash(filePath)
+	return
+}
@@ -0,0 +1,136 @@
+package net_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyHandler serves the content from memory, the first transfer is broken in the middle
+type flakyHandler struct {
+	content      string
+	rangeSupport bool
+	broken       bool
+	offsets      []int64
+}
+
+func (h *flakyHandler) Probe(_ context.Context, _ *url.URL) (int64, bool, error) {
+	return int64(len(h.content)), h.rangeSupport, nil
+}
+
+func (h *flakyHandler) Open(_ context.Context, _ *url.URL, offset int64) (io.ReadCloser, error) {
+	h.offsets = append(h.offsets, offset)
+	reader := io.Reader(strings.NewReader(h.content[offset:]))
+	if !h.broken {
+		h.broken = true
+		reader = io.MultiReader(strings.NewReader(h.content[offset:offset+4]), &brokenReader{})
+	}
+	return io.NopCloser(reader), nil
+}
+
+type brokenReader struct{}
+
+func (r *brokenReader) Read([]byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestRegisterSchemeHandler(t *testing.T) {
+	assert.NotNil(t, net.RegisterSchemeHandler("", &flakyHandler{}))
+	assert.NotNil(t, net.RegisterSchemeHandler("HTTPS", &flakyHandler{}))
+	assert.NotNil(t, net.RegisterSchemeHandler("fake", nil))
+	assert.Nil(t, net.RegisterSchemeHandler("Fake", &flakyHandler{}))
+
+	assert.NotNil(t, net.GetSchemeHandler("fake://foo/bar"))
+	assert.NotNil(t, net.GetSchemeHandler("file:///tmp/foo"))
+	assert.NotNil(t, net.GetSchemeHandler("ftp://foo.com/bar"))
+	assert.Nil(t, net.GetSchemeHandler("https://foo.com"))
+	assert.Nil(t, net.GetSchemeHandler("linuxsuren/http-downloader"))
+
+	assert.True(t, net.IsSupportedURL("https://foo.com"))
+	assert.True(t, net.IsSupportedURL("fake://foo/bar"))
+	assert.False(t, net.IsSupportedURL("linuxsuren/http-downloader"))
+	assert.False(t, net.IsSupportedURL("unknown://foo"))
+}
+
+func TestSchemeDownloaderRetry(t *testing.T) {
+	content := "0123456789"
+	policy := net.DefaultRetryPolicy()
+	policy.InitialInterval = time.Millisecond
+
+	t.Run("continue from the broken offset", func(t *testing.T) {
+		handler := &flakyHandler{content: content, rangeSupport: true}
+		assert.Nil(t, net.RegisterSchemeHandler("flaky", handler))
+
+		buf := &bytes.Buffer{}
+		recorder := &eventRecorder{}
+		downloader := &net.SchemeDownloader{RetryPolicy: policy, Observer: recorder}
+		assert.Nil(t, downloader.DownloadAsStream("flaky://foo/bar", buf, 2))
+		assert.Equal(t, content[2:], buf.String())
+		assert.Equal(t, []int64{2, 6}, handler.offsets)
+		assert.Equal(t, 1, len(recorder.filter(net.ProgressRetry)))
+
+		finished := recorder.filter(net.ProgressFinished)
+		if assert.Equal(t, 1, len(finished)) {
+			assert.Equal(t, int64(8), finished[0].Downloaded)
+			assert.Equal(t, int64(8), finished[0].Total)
+		}
+	})
+
+	t.Run("no range support", func(t *testing.T) {
+		handler := &flakyHandler{content: content}
+		assert.Nil(t, net.RegisterSchemeHandler("flaky", handler))
+
+		downloader := &net.SchemeDownloader{RetryPolicy: policy}
+		assert.NotNil(t, downloader.DownloadAsStream("flaky://foo/bar", &bytes.Buffer{}, -1))
+		assert.Equal(t, []int64{0}, handler.offsets)
+		assert.NotNil(t, downloader.DownloadAsStream("flaky://foo/bar", &bytes.Buffer{}, 2))
+	})
+
+	t.Run("canceled while waiting for the retry", func(t *testing.T) {
+		handler := &flakyHandler{content: content, rangeSupport: true}
+		assert.Nil(t, net.RegisterSchemeHandler("flaky", handler))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		downloader := &net.SchemeDownloader{Context: ctx, RetryPolicy: policy}
+		err := downloader.DownloadAsStream("flaky://foo/bar", &bytes.Buffer{}, 0)
+		assert.True(t, errors.Is(err, net.ErrCanceled), err)
+		assert.Equal(t, []int64{0}, handler.offsets)
+	})
+}
+
+func TestFileHandler(t *testing.T) {
+	dir := t.TempDir()
+	source := path.Join(dir, "source.txt")
+	assert.Nil(t, os.WriteFile(source, []byte("0123456789"), 0644))
+	sourceURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(source)}).String()
+
+	downloader := &net.SchemeDownloader{}
+	target := path.Join(dir, "sub", "target.txt")
+	assert.Nil(t, downloader.DownloadFile(sourceURL, target, -1))
+	data, err := os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, "0123456789", string(data))
+
+	// continue from the offset, and drop the rest of the existing file
+	assert.Nil(t, os.WriteFile(target, []byte("0123xxxxxxxxxx"), 0644))
+	assert.Nil(t, downloader.DownloadFile(sourceURL, target, 4))
+	data, err = os.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, "0123456789", string(data))
+
+	assert.NotNil(t, downloader.DownloadFile(sourceURL+".missing", target, -1))
+	assert.NotNil(t, downloader.DownloadFile("file://"+filepath.ToSlash(dir), target, -1))
+	assert.NotNil(t, downloader.DownloadFile("file://foo.com/"+filepath.ToSlash(source), target, -1))
+}
@@ -0,0 +1,138 @@
+package net
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	awsSigV4Algorithm  = "AWS4-HMAC-SHA256"
+	awsTimeFormat      = "20060102T150405Z"
+	awsDefaultRegion   = "us-east-1"
+	awsDefaultService  = "s3"
+	awsUnsignedPayload = "UNSIGNED-PAYLOAD"
+	// awsEmptyPayloadHash is the SHA256 of the empty body
+	awsEmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// awsSignedHeaders are the headers which are signed if they exist, the host is always signed
+var awsSignedHeaders = []string{"range", "x-amz-content-sha256", "x-amz-date", "x-amz-security-token"}
+
+// signAWSv4 signs the request by the AWS Signature Version 4 in the Authorization header. Each request
+// is signed separately, so the range requests of the multi-thread download work as well.
+// See https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+func signAWSv4(req *http.Request, credential *Credential, now time.Time) {
+	region, service := credential.Region, credential.Service
+	if region == "" {
+		region = awsDefaultRegion
+	}
+	if service == "" {
+		service = awsDefaultService
+	}
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	amzDate := now.UTC().Format(awsTimeFormat)
+	payloadHash := awsEmptyPayloadHash
+	if req.Body != nil && req.Body != http.NoBody {
+		payloadHash = awsUnsignedPayload
+	}
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if credential.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", credential.Token)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	names := []string{"host"}
+	headers := map[string]string{"host": host}
+	for _, name := range awsSignedHeaders {
+		if value := req.Header.Get(name); value != "" {
+			names = append(names, name)
+			headers[name] = strings.TrimSpace(value)
+		}
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalPath := "/"
+	if req.URL.Path != "" {
+		canonicalPath = awsEscape(req.URL.Path, false)
+		// send the signed path, net/http does not escape the sub-delims like + and (
+		req.URL.RawPath = canonicalPath
+	}
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalPath,
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", amzDate[:8], region, service)
+	stringToSign := strings.Join([]string{awsSigV4Algorithm, amzDate, scope, sha256Hex(canonicalRequest)}, "\n")
+
+	key := []byte("AWS4" + credential.Password)
+	for _, item := range []string{amzDate[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, item)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigV4Algorithm, credential.Username, scope, signedHeaders, signature))
+}
+
+// awsCanonicalQuery returns the query which is sorted by the names and the values
+func awsCanonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(name, true)+"="+awsEscape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape encodes all the characters except the unreserved ones, the slash is kept if it's a path
+func awsEscape(text string, encodeSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			builder.WriteByte(c)
+		} else {
+			builder.WriteString(fmt.Sprintf("%%%02X", c))
+		}
+	}
+	return builder.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
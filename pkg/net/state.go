@@ -0,0 +1,236 @@
+package net
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// StateFileSuffix is the suffix of the state file which records the progress of a multi-thread download
+	StateFileSuffix = ".hd-state"
+	// DownloadingFileSuffix is the suffix of the file which is being downloaded with multi-thread
+	DownloadingFileSuffix = ".hd-downloading"
+)
+
+// downloadState is the manifest of a multi-thread download, it's used to resume the download
+type downloadState struct {
+	URL          string        `json:"url"`
+	ETag         string        `json:"etag,omitempty"`
+	LastModified string        `json:"lastModified,omitempty"`
+	Total        int64         `json:"total"`
+	Chunks       []*chunkState `json:"chunks"`
+
+	path string
+	lock sync.Mutex
+}
+
+// chunkState represents a range of the target file, the end is inclusive
+type chunkState struct {
+	Start     int64 `json:"start"`
+	End       int64 `json:"end"`
+	Completed int64 `json:"completed"`
+}
+
+func (c *chunkState) size() int64 {
+	return c.End - c.Start + 1
+}
+
+func (c *chunkState) finished() bool {
+	return c.Completed >= c.size()
+}
+
+// resourceInfo holds the metadata of a remote resource
+type resourceInfo struct {
+	total        int64
+	rangeSupport bool
+	etag         string
+	lastModified string
+	contentType  string
+	// filename is the suggested filename of the response, see suggestFilename
+	filename string
+}
+
+func getStateFilePath(targetFilePath string) string {
+	return targetFilePath + StateFileSuffix
+}
+
+// newDownloadState splits the target resource into the chunks for the threads
+func newDownloadState(targetURL, statePath string, info resourceInfo, thread int) (state *downloadState) {
+	state = &downloadState{
+		URL:          targetURL,
+		ETag:         info.etag,
+		LastModified: info.lastModified,
+		Total:        info.total,
+		path:         statePath,
+	}
+
+	state.Chunks = splitChunks(info.total, thread)
+	return
+}
+
+// loadDownloadState loads the state from the file, returns nil if it does not exist or is invalid
+func loadDownloadState(statePath string) (state *downloadState) {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return
+	}
+
+	state = &downloadState{}
+	if err = json.Unmarshal(data, state); err != nil || len(state.Chunks) == 0 {
+		return nil
+	}
+	state.path = statePath
+	return
+}
+
+// matches checks if the state belongs to the same remote resource
+func (s *downloadState) matches(targetURL string, info resourceInfo) bool {
+	if s.URL != targetURL || s.Total != info.total {
+		return false
+	}
+
+	if s.ETag != "" || info.etag != "" {
+		return s.ETag == info.etag
+	}
+	return s.LastModified == info.lastModified
+}
+
+func (s *downloadState) addCompleted(chunk *chunkState, n int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	chunk.Completed += n
+	if size := chunk.size(); chunk.Completed > size {
+		// the end of chunk was moved during the writing
+		chunk.Completed = size
+	}
+}
+
+// rewind marks the range as unfinished, so that it will be downloaded again
+func (s *downloadState) rewind(start, end int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, chunk := range s.Chunks {
+		if chunk.Start > end || chunk.End < start {
+			continue
+		}
+		// each chunk is written in order, all the data after the start needs to be downloaded again
+		if offset := start - chunk.Start; offset <= 0 {
+			chunk.Completed = 0
+		} else if chunk.Completed > offset {
+			chunk.Completed = offset
+		}
+	}
+}
+
+// indexOf returns the index of the chunk, -1 means not found
+func (s *downloadState) indexOf(chunk *chunkState) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return indexOfChunk(s.Chunks, chunk)
+}
+
+// completed returns the count of the downloaded bytes of all the chunks
+func (s *downloadState) completed() (completed int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, chunk := range s.Chunks {
+		completed += chunk.Completed
+	}
+	return
+}
+
+func (s *downloadState) finished() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, chunk := range s.Chunks {
+		if !chunk.finished() {
+			return false
+		}
+	}
+	return true
+}
+
+// save writes the state into a temporary file first, then renames it to avoid a broken state file
+func (s *downloadState) save() (err error) {
+	s.lock.Lock()
+	data, err := json.Marshal(s)
+	s.lock.Unlock()
+	if err != nil {
+		return
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+	return
+}
+
+// autoSave saves the state periodically until the returned function is called
+func (s *downloadState) autoSave(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_ = s.save()
+			case <-done:
+				_ = s.save()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (s *downloadState) remove() {
+	_ = os.Remove(s.path)
+}
+
+// errChunkFinished indicates all the data of a chunk was written
+var errChunkFinished = errors.New("chunk finished")
+
+// chunkWriter writes the data into the range of a chunk, and records the progress into the state
+type chunkWriter struct {
+	writer   io.WriterAt
+	state    *downloadState
+	chunk    *chunkState
+	reporter *progressReporter
+}
+
+// Write writes the data which does not exceed the chunk. The end of the chunk
+// might be changed when another worker takes over the rest of it.
+func (w *chunkWriter) Write(p []byte) (n int, err error) {
+	w.state.lock.Lock()
+	offset := w.chunk.Start + w.chunk.Completed
+	remain := w.chunk.size() - w.chunk.Completed
+	w.state.lock.Unlock()
+
+	data := p
+	if remain <= 0 {
+		data = nil
+	} else if int64(len(data)) > remain {
+		data = data[:remain]
+	}
+
+	if len(data) > 0 {
+		n, err = w.writer.WriteAt(data, offset)
+		w.state.addCompleted(w.chunk, int64(n))
+		w.reporter.add(int64(n))
+	}
+	if err == nil && n < len(p) {
+		err = errChunkFinished
+	}
+	return
+}
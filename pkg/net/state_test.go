@@ -0,0 +1,90 @@
+package net
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDownloadState(t *testing.T) {
+	state := newDownloadState(fakeURL, "state", resourceInfo{total: 10}, 3)
+	assert.Equal(t, []*chunkState{{Start: 0, End: 2}, {Start: 3, End: 5}, {Start: 6, End: 9}}, state.Chunks)
+	assert.False(t, state.finished())
+
+	for _, chunk := range state.Chunks {
+		state.addCompleted(chunk, chunk.size())
+	}
+	assert.True(t, state.finished())
+}
+
+func TestDownloadStateSaveAndLoad(t *testing.T) {
+	statePath := path.Join(t.TempDir(), "target"+StateFileSuffix)
+	assert.Nil(t, loadDownloadState(statePath))
+
+	state := newDownloadState(fakeURL, statePath, resourceInfo{total: 10, etag: `"v1"`}, 2)
+	state.addCompleted(state.Chunks[0], 3)
+	stop := state.autoSave(time.Hour)
+	stop()
+
+	loaded := loadDownloadState(statePath)
+	if assert.NotNil(t, loaded) {
+		assert.Equal(t, state.Chunks, loaded.Chunks)
+		assert.True(t, loaded.matches(fakeURL, resourceInfo{total: 10, etag: `"v1"`}))
+		assert.False(t, loaded.matches(fakeURL, resourceInfo{total: 10, etag: `"v2"`}))
+		assert.False(t, loaded.matches(fakeURL, resourceInfo{total: 11, etag: `"v1"`}))
+		assert.False(t, loaded.matches("http://other", resourceInfo{total: 10, etag: `"v1"`}))
+	}
+
+	loaded.remove()
+	assert.Nil(t, loadDownloadState(statePath))
+}
+
+func TestDownloadStateMatchesLastModified(t *testing.T) {
+	state := &downloadState{URL: fakeURL, Total: 10, LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}
+	assert.True(t, state.matches(fakeURL, resourceInfo{total: 10, lastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}))
+	assert.False(t, state.matches(fakeURL, resourceInfo{total: 10}))
+}
+
+func TestChunkWriter(t *testing.T) {
+	state := newDownloadState(fakeURL, "", resourceInfo{total: 12}, 2)
+	f, err := os.Create(path.Join(t.TempDir(), "target"))
+	assert.Nil(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+	writer := &chunkWriter{writer: f, state: state, chunk: state.Chunks[1]}
+
+	n, err := writer.Write([]byte("012"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	// the data beyond the chunk will be dropped
+	n, err = writer.Write([]byte("345678"))
+	assert.Equal(t, errChunkFinished, err)
+	assert.Equal(t, 3, n)
+	assert.True(t, state.Chunks[1].finished())
+	assert.False(t, state.finished())
+
+	data, err := os.ReadFile(f.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, "\x00\x00\x00\x00\x00\x00012345", string(data))
+}
+
+func TestDownloadStateRewind(t *testing.T) {
+	state := &downloadState{Chunks: []*chunkState{
+		{Start: 0, End: 9, Completed: 10},
+		{Start: 10, End: 19, Completed: 10},
+		{Start: 20, End: 29, Completed: 4},
+	}}
+	state.rewind(5, 14)
+	assert.Equal(t, int64(5), state.Chunks[0].Completed)
+	assert.Equal(t, int64(0), state.Chunks[1].Completed)
+	assert.Equal(t, int64(4), state.Chunks[2].Completed)
+
+	state.rewind(22, 25)
+	assert.Equal(t, int64(2), state.Chunks[2].Completed)
+	assert.False(t, state.finished())
+}
@@ -0,0 +1,123 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// DefaultStreamBufferSize is the default size of the memory which holds the chunks of a stream
+// before they could be written in order
+const DefaultStreamBufferSize int64 = 32 * 1024 * 1024
+
+// errStreamAborted indicates the stream was stopped since a chunk failed, or it was canceled
+var errStreamAborted = errors.New("the stream was aborted")
+
+// orderedWriter writes the data of the chunks into a writer sequentially. The data which comes
+// before its turn is kept in memory, WriteAt blocks if the buffer is full until the data before
+// it is written. It does not deadlock because the earliest unfinished chunk is always being
+// downloaded and written directly.
+type orderedWriter struct {
+	writer io.Writer
+	limit  int64
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	offset   int64
+	pending  map[int64][]byte
+	buffered int64
+	err      error
+}
+
+// asWriterAt returns the writer if it's able to write at any offset. The stdout is an *os.File which
+// implements io.WriterAt, but it's not seekable if it's a pipe or a terminal.
+func asWriterAt(writer io.Writer) (writerAt io.WriterAt, ok bool) {
+	if f, isFile := writer.(*os.File); isFile {
+		if stat, err := f.Stat(); err != nil || !stat.Mode().IsRegular() {
+			return
+		}
+	}
+	writerAt, ok = writer.(io.WriterAt)
+	return
+}
+
+func newOrderedWriter(writer io.Writer, limit int64) *orderedWriter {
+	if limit <= 0 {
+		limit = DefaultStreamBufferSize
+	}
+	w := &orderedWriter{writer: writer, limit: limit, pending: map[int64][]byte{}}
+	w.cond = sync.NewCond(&w.lock)
+	return w
+}
+
+// WriteAt writes the data if it's the turn of the offset, otherwise keeps it in the buffer
+func (w *orderedWriter) WriteAt(p []byte, off int64) (n int, err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for {
+		if w.err != nil {
+			return 0, w.err
+		}
+
+		if off < w.offset {
+			// the data must not be written twice
+			w.fail(fmt.Errorf("the range from %d was written already", off))
+			return 0, w.err
+		} else if off == w.offset {
+			if n, err = w.writer.Write(p); err != nil {
+				w.fail(err)
+				return
+			}
+			w.offset += int64(n)
+			err = w.flush()
+			return
+		}
+
+		// a single write is accepted by an empty buffer even if it's larger than the limit
+		if w.buffered == 0 || w.buffered+int64(len(p)) <= w.limit {
+			w.pending[off] = append([]byte(nil), p...)
+			w.buffered += int64(len(p))
+			return len(p), nil
+		}
+		w.cond.Wait()
+	}
+}
+
+// flush writes the buffered data which is continuous with the written one
+func (w *orderedWriter) flush() (err error) {
+	for data, ok := w.pending[w.offset]; ok; data, ok = w.pending[w.offset] {
+		delete(w.pending, w.offset)
+		w.buffered -= int64(len(data))
+		if _, err = w.writer.Write(data); err != nil {
+			w.fail(err)
+			return
+		}
+		w.offset += int64(len(data))
+	}
+	w.cond.Broadcast()
+	return
+}
+
+func (w *orderedWriter) fail(err error) {
+	w.err = err
+	w.cond.Broadcast()
+}
+
+// abort wakes up all the blocked writes, and fails the rest of them
+func (w *orderedWriter) abort() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.err == nil {
+		w.fail(errStreamAborted)
+	}
+}
+
+// written returns the size of the data which was written into the writer
+func (w *orderedWriter) written() int64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.offset
+}
@@ -0,0 +1,113 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer := newOrderedWriter(buf, 4)
+
+	// the data after the written offset is buffered
+	n, err := writer.WriteAt([]byte("cd"), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Empty(t, buf.String())
+
+	// it blocks once the buffer is full
+	written := make(chan error)
+	go func() {
+		_, err := writer.WriteAt([]byte("efg"), 4)
+		written <- err
+	}()
+	select {
+	case <-written:
+		assert.Fail(t, "the buffer should be full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, err = writer.WriteAt([]byte("ab"), 0)
+	assert.Nil(t, err)
+	assert.Nil(t, <-written)
+	assert.Equal(t, "abcdefg", buf.String())
+	assert.Equal(t, int64(7), writer.written())
+
+	_, err = writer.WriteAt([]byte("a"), 0)
+	assert.NotNil(t, err)
+}
+
+func TestOrderedWriterAbort(t *testing.T) {
+	writer := newOrderedWriter(&bytes.Buffer{}, 1)
+	_, err := writer.WriteAt([]byte("b"), 1)
+	assert.Nil(t, err)
+
+	written := make(chan error)
+	go func() {
+		_, err := writer.WriteAt([]byte("c"), 2)
+		written <- err
+	}()
+	writer.abort()
+	assert.ErrorIs(t, <-written, errStreamAborted)
+}
+
+func TestAsWriterAt(t *testing.T) {
+	_, ok := asWriterAt(&bytes.Buffer{})
+	assert.False(t, ok)
+
+	f, err := os.Create(path.Join(t.TempDir(), "target"))
+	assert.Nil(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+	_, ok = asWriterAt(f)
+	assert.True(t, ok)
+
+	// a pipe is not seekable
+	reader, writer, err := os.Pipe()
+	assert.Nil(t, err)
+	defer func() {
+		_ = reader.Close()
+		_ = writer.Close()
+	}()
+	_, ok = asWriterAt(writer)
+	assert.False(t, ok)
+}
+
+func TestDownloadIntoStream(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=2500-4999" && strings.HasSuffix(r.URL.Path, "/broken") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	// the buffer is smaller than a chunk
+	buf := &bytes.Buffer{}
+	downloader := &MultiThreadDownloader{}
+	downloader.WithStreamBufferSize(100)
+	assert.Nil(t, downloader.DownloadWithContext(context.Background(), server.URL, buf, 4))
+	assert.Equal(t, content, buf.String())
+
+	// the chunks which are waiting for the buffer stop once a chunk failed
+	buf.Reset()
+	err := downloader.DownloadWithContext(context.Background(), server.URL+"/broken", buf, 4)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "2500-4999")
+	}
+	// the data before the failed chunk might be written
+	assert.LessOrEqual(t, buf.Len(), 2500)
+	assert.True(t, strings.HasPrefix(content, buf.String()))
+}
@@ -0,0 +1,92 @@
+package net
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// NewTLSConfig returns the TLS config with the custom CA certificates and the client certificate,
+// it returns nil if all of them are empty.
+// The CA certificates are trusted besides the system ones. The caCert is a PEM file which could have
+// many certificates, the caPath is a directory of the PEM files. The key could be empty if it's in the cert file.
+func NewTLSConfig(caCert, caPath, cert, key string) (config *tls.Config, err error) {
+	if caCert == "" && caPath == "" && cert == "" && key == "" {
+		return
+	}
+	config = &tls.Config{}
+
+	if caCert != "" || caPath != "" {
+		if config.RootCAs, err = x509.SystemCertPool(); err != nil || config.RootCAs == nil {
+			config.RootCAs = x509.NewCertPool()
+		}
+
+		if caCert != "" {
+			if err = appendCertsFromFile(config.RootCAs, caCert); err != nil {
+				config = nil
+				return
+			}
+		}
+		if caPath != "" {
+			if err = appendCertsFromDir(config.RootCAs, caPath); err != nil {
+				config = nil
+				return
+			}
+		}
+	}
+
+	if cert == "" && key != "" {
+		err = fmt.Errorf("the client certificate is required by the key '%s'", key)
+	} else if cert != "" {
+		if key == "" {
+			key = cert
+		}
+
+		var certificate tls.Certificate
+		if certificate, err = tls.LoadX509KeyPair(cert, key); err != nil {
+			err = fmt.Errorf("failed to load the client certificate '%s', error: %v", cert, err)
+		} else {
+			config.Certificates = []tls.Certificate{certificate}
+		}
+	}
+
+	if err != nil {
+		config = nil
+	}
+	return
+}
+
+func appendCertsFromFile(pool *x509.CertPool, certFile string) (err error) {
+	var data []byte
+	if data, err = os.ReadFile(certFile); err == nil && !pool.AppendCertsFromPEM(data) {
+		err = fmt.Errorf("no PEM certificate found in '%s'", certFile)
+	}
+	return
+}
+
+// appendCertsFromDir appends the certificates of all the files in the directory, the files which
+// are not PEM certificates are ignored, for instance: the CRL files of a c_rehash directory
+func appendCertsFromDir(pool *x509.CertPool, certDir string) (err error) {
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(certDir); err != nil {
+		return
+	}
+
+	var found bool
+	for _, entry := range entries {
+		// the entry might be a symbolic link
+		certFile := filepath.Join(certDir, entry.Name())
+		if info, statErr := os.Stat(certFile); statErr != nil || info.IsDir() {
+			continue
+		}
+		if appendCertsFromFile(pool, certFile) == nil {
+			found = true
+		}
+	}
+	if !found {
+		err = fmt.Errorf("no PEM certificate found in the directory '%s'", certDir)
+	}
+	return
+}
@@ -0,0 +1,145 @@
+package net_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/http-downloader/pkg/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	config, err := net.NewTLSConfig("", "", "", "")
+	assert.Nil(t, err)
+	assert.Nil(t, config)
+
+	dir := t.TempDir()
+	invalidFile := path.Join(dir, "invalid.pem")
+	assert.Nil(t, os.WriteFile(invalidFile, []byte("invalid"), 0600))
+
+	_, err = net.NewTLSConfig(invalidFile, "", "", "")
+	assert.NotNil(t, err)
+	_, err = net.NewTLSConfig(path.Join(dir, "missing.pem"), "", "", "")
+	assert.NotNil(t, err)
+	_, err = net.NewTLSConfig("", dir, "", "")
+	assert.NotNil(t, err)
+	_, err = net.NewTLSConfig("", "", invalidFile, "")
+	assert.NotNil(t, err)
+	_, err = net.NewTLSConfig("", "", "", invalidFile)
+	assert.NotNil(t, err)
+}
+
+func TestDownloadWithClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	clientCertFile, clientKeyFile := path.Join(dir, "client.crt"), path.Join(dir, "client.key")
+	clientCert := writeClientCertificate(t, clientCertFile, clientKeyFile)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	// the CA certificate is in both a single file and a directory
+	caDir := path.Join(dir, "certs")
+	caFile := path.Join(caDir, "ca.pem")
+	assert.Nil(t, os.MkdirAll(caDir, 0755))
+	assert.Nil(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	assert.Nil(t, os.WriteFile(path.Join(caDir, "README"), []byte("not a certificate"), 0600))
+
+	tests := []struct {
+		name    string
+		caCert  string
+		caPath  string
+		cert    string
+		key     string
+		wantErr bool
+	}{{
+		name:   "CA file",
+		caCert: caFile,
+		cert:   clientCertFile,
+		key:    clientKeyFile,
+	}, {
+		name:   "CA directory",
+		caPath: caDir,
+		cert:   clientCertFile,
+		key:    clientKeyFile,
+	}, {
+		name:    "without client certificate",
+		caCert:  caFile,
+		wantErr: true,
+	}, {
+		name:    "unknown CA",
+		cert:    clientCertFile,
+		key:     clientKeyFile,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := net.NewTLSConfig(tt.caCert, tt.caPath, tt.cert, tt.key)
+			assert.Nil(t, err)
+
+			targetFile := path.Join(t.TempDir(), "file")
+			downloader := &net.HTTPDownloader{
+				URL:            server.URL,
+				TargetFilePath: targetFile,
+				TLSConfig:      config,
+				RetryPolicy:    net.DefaultRetryPolicy().WithoutRetry(),
+			}
+			err = downloader.DownloadFile()
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+
+			data, err := os.ReadFile(targetFile)
+			assert.Nil(t, err)
+			assert.Equal(t, "hd-client", string(data))
+		})
+	}
+}
+
+// writeClientCertificate writes a self-signed client certificate and its key
+func writeClientCertificate(t *testing.T, certFile, keyFile string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "hd-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	assert.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert
+}
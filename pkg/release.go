@@ -2,7 +2,11 @@ package pkg
 
 import (
 	"context"
+	"crypto/tls"
+	"net/http"
+
 	"github.com/google/go-github/v29/github"
+	"github.com/linuxsuren/http-downloader/pkg/net"
 )
 
 // ReleaseClient is the client of jcli github
@@ -10,6 +14,10 @@ type ReleaseClient struct {
 	Client *github.Client
 	Org    string
 	Repo   string
+	// Credentials provides the credential of api.github.com, it should be set before Init
+	Credentials net.CredentialResolver
+	// TLSConfig has the custom CA certificates and the client certificate, it should be set before Init
+	TLSConfig *tls.Config
 
 	ctx context.Context
 }
@@ -22,7 +30,17 @@ type ReleaseAsset struct {
 
 // Init init the GitHub client
 func (g *ReleaseClient) Init() {
-	g.Client = github.NewClient(nil)
+	var httpClient *http.Client
+	if g.Credentials != nil || g.TLSConfig != nil {
+		var transport http.RoundTripper
+		if g.TLSConfig != nil {
+			tr := http.DefaultTransport.(*http.Transport).Clone()
+			tr.TLSClientConfig = g.TLSConfig
+			transport = tr
+		}
+		httpClient = &http.Client{Transport: net.NewCredentialTransport(transport, g.Credentials)}
+	}
+	g.Client = github.NewClient(httpClient)
 	g.ctx = context.TODO()
 }
 